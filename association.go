@@ -1,11 +1,20 @@
 package ngorm
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/ngorm/ngorm/builder"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/hooks"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
 	"github.com/ngorm/ngorm/util"
 )
 
@@ -14,11 +23,84 @@ type Association struct {
 	db     *DB
 	column string
 	field  *model.Field
+	query  []func(*DB) *DB
+
+	// join is copied into the records of the join model created when linking
+	// records.
+	join interface{}
 }
 
-// Find find out all related associations
+// Find find out all related associations. The conditions added with Where,
+// Order and Limit are applied to the query, after the preloads, selects and
+// order of the query the association was created from.
+//
+//	a.Where("name = ?", "EN").Order("name").Find(&languages)
 func (a *Association) Find(v interface{}) error {
-	return a.db.Related(v, a.column)
+	if err := a.single("Find"); err != nil {
+		return err
+	}
+	return a.db.related(a.db.e.Scope.Value, v, a.query, a.column)
+}
+
+// FindSQL generates SQL query for Find.
+func (a *Association) FindSQL(v interface{}) (*model.Expr, error) {
+	if err := a.single("Find"); err != nil {
+		return nil, err
+	}
+	return a.db.relatedSQL(a.db.e.Scope.Value, v, a.query, a.column)
+}
+
+// WithJoin sets the value used for the extra columns of the join model of a
+// many_to_many relationship, when records are linked with Append, Save or
+// Replace. The foreign keys and timestamps are set by ngorm.
+//
+//	a.WithJoin(&UserRole{GrantedBy: "admin"}).Append(&role)
+func (a *Association) WithJoin(value interface{}) *Association {
+	a.join = value
+	return a
+}
+
+// single returns an error when the association is on a slice of records, op
+// is only supported for a single record.
+func (a *Association) single(op string) error {
+	if reflect.Indirect(a.db.e.Scope.ValueOf()).Kind() == reflect.Slice {
+		return fmt.Errorf("association %s is not supported on a slice of records", op)
+	}
+	return nil
+}
+
+// Where returns a copy of a with a condition on the associated records. The
+// conditions apply to Find and Count, and limit the records whose
+// association is removed by Delete, Replace and Clear.
+//
+//	a.Where("primary = ?", false).Clear()
+func (a *Association) Where(query interface{}, args ...interface{}) *Association {
+	return a.with(func(db *DB) *DB {
+		return db.Where(query, args...)
+	})
+}
+
+// Order returns a copy of a which orders the associated records, see Where.
+func (a *Association) Order(value interface{}, reorder ...bool) *Association {
+	return a.with(func(db *DB) *DB {
+		return db.Order(value, reorder...)
+	})
+}
+
+// Limit returns a copy of a which limits the number of associated records, see
+// Where.
+func (a *Association) Limit(limit interface{}) *Association {
+	return a.with(func(db *DB) *DB {
+		return db.Limit(limit)
+	})
+}
+
+// with returns a copy of a with q added to the query of the associated
+// records.
+func (a *Association) with(q func(*DB) *DB) *Association {
+	c := *a
+	c.query = append(append([]func(*DB) *DB(nil), a.query...), q)
+	return &c
 }
 
 // Append append new associations for many2many, has_many, replace current
@@ -34,6 +116,9 @@ func (a *Association) Append(values ...interface{}) error {
 // for a has_one, belongs_to relationships. You can pass one or more values for
 // many_to_many relationship.
 func (a *Association) Save(values ...interface{}) error {
+	if parents := reflect.Indirect(a.db.e.Scope.ValueOf()); parents.Kind() == reflect.Slice {
+		return a.saveAll(parents, values)
+	}
 	if len(values) > 0 {
 		e := a.db.e
 		field := a.field
@@ -69,83 +154,938 @@ func (a *Association) Save(values ...interface{}) error {
 			}
 			return a.db.Begin().Save(vp.Interface())
 		}
-		v = reflect.MakeSlice(field.Struct.Type, 0, 0)
-		if v.Kind() == reflect.Ptr {
-			v = v.Elem()
+		if rel.Kind == "belongs_to" {
+			if len(values) > 1 {
+				return fmt.Errorf("relation %s expect one struct value got %d", rel.Kind, len(values))
+			}
+			v = reflect.Indirect(reflect.ValueOf(values[0]))
+			if rel.IsPolymorphicBelongsTo() {
+				// the interface field keeps a pointer, so the primary key of
+				// the saved record is set on values[0].
+				v = reflect.ValueOf(values[0])
+			}
+			err := field.Set(v)
+			if err != nil {
+				return err
+			}
+			return a.db.Begin().Save(e.Scope.Value)
 		}
+
+		// only the new values are saved, the source itself is left untouched.
+		v = reflect.New(field.Struct.Type).Elem()
+		isPtr := field.Struct.Type.Elem().Kind() == reflect.Ptr
 		for _, value := range values {
 			fv := reflect.ValueOf(value)
-			if fv.Kind() == reflect.Ptr {
-				fv = fv.Elem()
+			if isPtr {
+				if fv.Kind() != reflect.Ptr {
+					p := reflect.New(fv.Type())
+					p.Elem().Set(fv)
+					fv = p
+				}
+			} else {
+				fv = reflect.Indirect(fv)
 			}
 			v = reflect.Append(v, fv)
 		}
-		field.Field.Set(v)
-		return a.db.Begin().Save(e.Scope.Value)
+		saved := *field
+		saved.Field = reflect.New(field.Struct.Type).Elem()
+		saved.Field.Set(v)
+		ne := a.db.NewEngine()
+		defer engine.Put(ne)
+		ne.Scope.ContextValue(e.Scope.Value)
+		if a.join != nil {
+			ne.Scope.Set(model.JoinValue, a.join)
+		}
+		fds, err := scope.Fields(ne, e.Scope.Value)
+		if err != nil {
+			return err
+		}
+		err = hooks.SaveFieldAssociation(ne, &saved, fds)
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			if fv := reflect.ValueOf(value); !isPtr && fv.Kind() == reflect.Ptr {
+				fv.Elem().Set(saved.Field.Index(i))
+			}
+		}
+		field.Field.Set(reflect.AppendSlice(field.Field, saved.Field))
+	}
+	return nil
+}
+
+// saveAll saves the associations of a slice of parents. values[i] is a value,
+// or a slice of values, associated with the i-th parent. For many_to_many
+// relations all the missing rows of the join table are inserted in a single
+// statement, has_many, has_one and belongs_to records are saved for each
+// parent in turn.
+func (a *Association) saveAll(parents reflect.Value, values []interface{}) error {
+	if len(values) != parents.Len() {
+		return fmt.Errorf("expected %d values one for each parent got %d", parents.Len(), len(values))
+	}
+	var (
+		rel  = a.field.Relationship
+		rows [][]interface{}
+	)
+	for i := 0; i < parents.Len(); i++ {
+		parent := parentAddr(parents.Index(i))
+		field, err := scope.FieldByName(a.db.e, parent, a.column)
+		if err != nil {
+			return err
+		}
+		elems := associated(values[i])
+		switch rel.Kind {
+		case "many_to_many":
+			for _, elem := range elems {
+				ne := a.db.NewEngine()
+				ne.Scope.ContextValue(elem.Interface())
+				err = hooks.SaveAssociation(ne)
+				engine.Put(ne)
+				if err != nil {
+					return err
+				}
+				if rel.JoinTableHandler.Model != nil {
+					err = a.addJoinModel(parent, elem.Interface())
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				m := scope.GetSearchMap(a.db.e, rel.JoinTableHandler, parent, elem.Interface())
+				var row []interface{}
+				for _, column := range joinColumns(rel.JoinTableHandler) {
+					row = append(row, m[column])
+				}
+				rows = append(rows, row)
+			}
+		case "belongs_to":
+			if len(elems) != 1 {
+				return fmt.Errorf("relation %s expect one struct value got %d", rel.Kind, len(elems))
+			}
+			ne := a.db.NewEngine()
+			ne.Scope.ContextValue(elems[0].Interface())
+			err = hooks.SaveAssociation(ne)
+			engine.Put(ne)
+			if err != nil {
+				return err
+			}
+			attrs := make(map[string]interface{})
+			for idx, fk := range rel.ForeignFieldNames {
+				af, err := scope.FieldByName(a.db.e, elems[0].Interface(), rel.AssociationForeignFieldNames[idx])
+				if err != nil {
+					return err
+				}
+				f, err := scope.FieldByName(a.db.e, parent, fk)
+				if err != nil {
+					return err
+				}
+				err = f.Set(af.Field.Interface())
+				if err != nil {
+					return err
+				}
+				attrs[f.DBName] = af.Field.Interface()
+			}
+			if rel.IsPolymorphicBelongsTo() {
+				value, err := scope.PolymorphicValue(a.db.e, rel, elems[0].Interface())
+				if err != nil {
+					return err
+				}
+				f, err := scope.FieldByName(a.db.e, parent, rel.PolymorphicType)
+				if err != nil {
+					return err
+				}
+				err = f.Set(value)
+				if err != nil {
+					return err
+				}
+				attrs[rel.PolymorphicDBName] = value
+				field.Field.Set(elems[0])
+			} else {
+				field.Field.Set(elems[0].Elem())
+			}
+			err = a.db.Begin().Model(parent).UpdateColumns(attrs)
+			if err != nil {
+				return err
+			}
+			continue
+		default:
+			if rel.Kind == "has_one" && len(elems) != 1 {
+				return fmt.Errorf("relation %s expect one struct value got %d", rel.Kind, len(elems))
+			}
+			ne := a.db.NewEngine()
+			ne.Scope.ContextValue(parent)
+			fds, err := scope.Fields(ne, parent)
+			if err != nil {
+				engine.Put(ne)
+				return err
+			}
+			saved := *field
+			saved.Field = reflect.New(field.Struct.Type).Elem()
+			if saved.Field.Kind() == reflect.Slice {
+				saved.Field.Set(appendAssociated(saved.Field, elems))
+			} else {
+				saved.Field.Set(elems[0].Elem())
+			}
+			err = hooks.SaveFieldAssociation(ne, &saved, fds)
+			engine.Put(ne)
+			if err != nil {
+				return err
+			}
+			if saved.Field.Kind() != reflect.Slice {
+				elems[0].Elem().Set(saved.Field)
+				field.Field.Set(saved.Field)
+				continue
+			}
+			for j, elem := range elems {
+				elem.Elem().Set(reflect.Indirect(saved.Field.Index(j)))
+			}
+		}
+		field.Field.Set(appendAssociated(field.Field, elems))
+	}
+	if len(rows) > 0 {
+		return a.link(rows)
 	}
 	return nil
 }
 
+// addJoinModel links source and destination with a record of the join model.
+func (a *Association) addJoinModel(source, destination interface{}) error {
+	ne := a.db.NewEngine()
+	defer engine.Put(ne)
+	if a.join != nil {
+		ne.Scope.Set(model.JoinValue, a.join)
+	}
+	return hooks.AddJoinModel(ne, a.field.Relationship.JoinTableHandler, source, destination)
+}
+
+// link inserts rows into the join table of a many_to_many relation, skipping
+// the ones which are already there. It is only used for join tables without a
+// model, which have no tenant column, the records of a join model are created
+// with hooks.AddJoinModel.
+func (a *Association) link(rows [][]interface{}) error {
+	h := a.field.Relationship.JoinTableHandler
+	columns := joinColumns(h)
+	e := a.db.NewEngine()
+	defer engine.Put(e)
+	var matches []string
+	for _, row := range rows {
+		var match []string
+		for idx, column := range columns {
+			match = append(match, fmt.Sprintf("%v = %v",
+				scope.Quote(e, column), scope.AddToVars(e, row[idx])))
+		}
+		matches = append(matches, "("+strings.Join(match, " AND ")+")")
+	}
+	var quoted []string
+	for _, column := range columns {
+		quoted = append(quoted, scope.Quote(e, column))
+	}
+	existing, err := a.db.SQLCommon().Query(fmt.Sprintf("SELECT %v FROM %v WHERE %v",
+		strings.Join(quoted, ", "), scope.Quote(e, h.TableName), strings.Join(matches, " OR ")),
+		e.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = existing.Close() }()
+	seen := make(map[string]bool)
+	for existing.Next() {
+		row := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		err = existing.Scan(dest...)
+		if err != nil {
+			return err
+		}
+		seen[util.ToString(row)] = true
+	}
+	if err = existing.Err(); err != nil {
+		return err
+	}
+
+	ie := a.db.NewEngine()
+	defer engine.Put(ie)
+	var placeholders []string
+	for _, row := range rows {
+		key := util.ToString(row)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		var vars []string
+		for _, v := range row {
+			vars = append(vars, scope.AddToVars(ie, v))
+		}
+		placeholders = append(placeholders, "("+strings.Join(vars, ", ")+")")
+	}
+	if len(placeholders) == 0 {
+		return nil
+	}
+	query := fmt.Sprintf("INSERT INTO %v (%v) VALUES %v",
+		scope.Quote(ie, h.TableName), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+	if isQL(a.db) {
+		query = util.WrapTX(query)
+	}
+	_, err = model.ExecTx(ie.SQLDB, query, ie.Scope.SQLVars...)
+	return err
+}
+
+// joinColumns returns the columns of the join table, the foreign keys of the
+// source are first. The type columns of polymorphic join tables follow the
+// foreign keys they qualify.
+func joinColumns(h *model.JoinTableHandler) []string {
+	var columns []string
+	for _, side := range []model.JoinTableSource{h.Source, h.Destination} {
+		for _, fk := range side.ForeignKeys {
+			columns = append(columns, fk.DBName)
+		}
+		if side.PolymorphicDBName != "" {
+			columns = append(columns, side.PolymorphicDBName)
+		}
+	}
+	return columns
+}
+
+// associated returns pointers to the values in v, which is either a single
+// value or a slice of values.
+func associated(v interface{}) []reflect.Value {
+	var elems []reflect.Value
+	add := func(rv reflect.Value) {
+		if rv.Kind() != reflect.Ptr {
+			p := reflect.New(rv.Type())
+			p.Elem().Set(rv)
+			rv = p
+		}
+		elems = append(elems, rv)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Slice {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			if elem.Kind() != reflect.Ptr {
+				elem = elem.Addr()
+			}
+			add(elem)
+		}
+		return elems
+	}
+	add(rv)
+	return elems
+}
+
+// appendAssociated appends elems to the association slice s.
+func appendAssociated(s reflect.Value, elems []reflect.Value) reflect.Value {
+	isPtr := s.Type().Elem().Kind() == reflect.Ptr
+	for _, elem := range elems {
+		if isPtr {
+			s = reflect.Append(s, elem)
+		} else {
+			s = reflect.Append(s, elem.Elem())
+		}
+	}
+	return s
+}
+
+// parentAddr returns a pointer to the parent v.
+func parentAddr(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		return v.Interface()
+	}
+	return v.Addr().Interface()
+}
+
 func isZero(v reflect.Value) bool {
 	return v.Interface() == reflect.Zero(v.Type()).Interface()
 }
 
-// Count return the count of current associations
+// Count returns the number of associated records. For associations on a slice
+// of parents this is the total for all the parents, see Counts.
 func (a *Association) Count() (int, error) {
+	if a.field.Relationship.IsPolymorphicBelongsTo() {
+		counts, err := a.polymorphicCounts()
+		if err != nil {
+			return 0, err
+		}
+		count := 0
+		for _, n := range counts {
+			count += n
+		}
+		return count, nil
+	}
+	count := 0
+	query, _, _, err := a.countQuery()
+	if err != nil {
+		return 0, err
+	}
+	err = query.Count(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Counts returns the number of associated records of each parent, in the order
+// of the parents, with a single query. When the model is a single record there
+// is one count.
+//
+//	a, err := db.Model(&users).Association("Languages")
+//	if err != nil {
+//		return err
+//	}
+//	counts, err := a.Counts()
+func (a *Association) Counts() ([]int, error) {
+	if a.field.Relationship.IsPolymorphicBelongsTo() {
+		return a.polymorphicCounts()
+	}
+	query, columns, parentKeys, err := a.countQuery()
+	if err != nil {
+		return nil, err
+	}
+	search.Order(query.e, nil, true)
+	keys := make([]string, len(columns))
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		keys[i] = fmt.Sprintf("parent_key_%d", i)
+		selects[i] = fmt.Sprintf("%v AS %s", column, keys[i])
+	}
+	db := query.e.SQLDB
+
+	// the keys are grouped by in an outer query, ql does not accept qualified
+	// column names in GROUP BY. The groups are ordered, without ORDER BY the
+	// rows of a ql GROUP BY share the values of the last row.
+	inner, err := query.Select(strings.Join(selects, ", ")).FindSQL(&[]map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	group := strings.Join(keys, ", ")
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, count(*) AS total FROM (%s) AS parents GROUP BY %s ORDER BY %s",
+		group, inner.Q, group, group), inner.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	totals := make(map[string]int)
+	for rows.Next() {
+		values := make([]interface{}, len(keys)+1)
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(util.ToString(values[len(keys)]))
+		if err != nil {
+			return nil, err
+		}
+		totals[util.ToString(values[:len(keys)])] = n
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	parents := a.parents()
+	counts := make([]int, len(parents))
+	for i, parent := range parents {
+		values := make([]interface{}, len(parentKeys))
+		for j, key := range parentKeys {
+			f, err := scope.FieldByName(a.db.e, parent, key)
+			if err != nil {
+				return nil, err
+			}
+			values[j] = f.Field.Interface()
+			if v, ok := values[j].(driver.Valuer); ok {
+				values[j], err = v.Value()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		counts[i] = totals[util.ToString(values)]
+	}
+	return counts, nil
+}
+
+// countQuery returns the query matching the associated records. It also
+// returns the columns linking the records to their parent, and the names of
+// the fields of the parent they refer to.
+func (a *Association) countQuery() (query *DB, columns, parentKeys []string, err error) {
 	var (
-		count      = 0
 		rel        = a.field.Relationship
-		fieldValue = a.field.Field.Interface()
-		query      = a.db.Model(fieldValue)
+		fieldValue = a.destination()
+		parents    = a.db.e.Scope.ValueOf()
 	)
+	query = a.db.Model(fieldValue)
+	search.Scoping(query.e, a.db.e)
+	for _, q := range a.query {
+		query = q(query)
+	}
+	table := scope.QuotedTableName(query.e, fieldValue)
 	if rel.Kind == "many_to_many" {
 		if isQL(a.db) {
-			err := scope.JoinWithQL(
-				rel.JoinTableHandler,
-				query.e, a.db.e.Scope.ValueOf())
-			if err != nil {
-				return 0, err
-			}
+			err = scope.JoinWithQL(rel.JoinTableHandler, query.e, parents)
 		} else {
-			err := scope.JoinWith(
-				rel.JoinTableHandler,
-				query.e, a.db.e.Scope.ValueOf())
-			if err != nil {
-				return 0, err
-			}
+			err = scope.JoinWith(rel.JoinTableHandler, query.e, parents)
+		}
+		if err != nil {
+			return nil, nil, nil, err
 		}
-
 		query.e.Scope.ContextValue(fieldValue)
+		for _, fk := range rel.JoinTableHandler.Source.ForeignKeys {
+			columns = append(columns, scope.Quote(query.e, rel.JoinTableHandler.TableName)+"."+scope.Quote(query.e, fk.DBName))
+			parentKeys = append(parentKeys, fk.AssociationDBName)
+		}
 	} else if rel.Kind == "has_many" || rel.Kind == "has_one" {
-		primaryKeys := util.ColumnAsArray(rel.AssociationForeignFieldNames, a.db.e.Scope.ValueOf())
+		primaryKeys := util.ColumnAsArray(rel.AssociationForeignFieldNames, parents)
 		query = query.Where(
 			fmt.Sprintf("%v IN (%v)",
 				scope.ToQueryCondition(a.db.e, rel.ForeignDBNames),
 				util.ToQueryMarks(primaryKeys)),
 			util.ToQueryValues(primaryKeys)...,
 		)
+		for _, fk := range rel.ForeignDBNames {
+			columns = append(columns, scope.Quote(query.e, fk))
+		}
+		parentKeys = rel.AssociationForeignFieldNames
 	} else if rel.Kind == "belongs_to" {
-		primaryKeys := util.ColumnAsArray(rel.ForeignFieldNames, a.db.e.Scope.ValueOf())
+		primaryKeys := util.ColumnAsArray(rel.ForeignFieldNames, parents)
 		query = query.Where(
 			fmt.Sprintf("%v IN (%v)",
 				scope.ToQueryCondition(a.db.e, rel.AssociationForeignDBNames),
 				util.ToQueryMarks(primaryKeys)),
 			util.ToQueryValues(primaryKeys)...,
 		)
+		for _, fk := range rel.AssociationForeignDBNames {
+			columns = append(columns, scope.Quote(query.e, fk))
+		}
+		parentKeys = rel.ForeignFieldNames
 	}
 
 	if rel.PolymorphicType != "" {
 		query = query.Where(
 			fmt.Sprintf("%v%v = ?",
-				a.db.e.Dialect.QueryFieldName(
-					scope.QuotedTableName(a.db.e, fieldValue)),
+				a.db.e.Dialect.QueryFieldName(table),
 				scope.Quote(a.db.e, rel.PolymorphicDBName)),
 			rel.PolymorphicValue,
 		)
 	}
-	err := query.Count(&count)
+	return query, columns, parentKeys, nil
+}
+
+// parents returns the addresses of the parents of the associated records.
+func (a *Association) parents() []interface{} {
+	v := reflect.Indirect(a.db.e.Scope.ValueOf())
+	if v.Kind() != reflect.Slice {
+		return []interface{}{a.db.e.Scope.Value}
+	}
+	parents := make([]interface{}, v.Len())
+	for i := range parents {
+		parents[i] = parentAddr(v.Index(i))
+	}
+	return parents
+}
+
+// polymorphicCounts returns the number of records associated with each parent
+// by a polymorphic belongs_to relationship. The associated records of a parent
+// can be of any type, so there is a query for each parent.
+func (a *Association) polymorphicCounts() ([]int, error) {
+	var (
+		rel    = a.field.Relationship
+		counts []int
+	)
+	for _, parent := range a.parents() {
+		f, err := scope.FieldByName(a.db.e, parent, rel.PolymorphicType)
+		if err != nil {
+			return nil, err
+		}
+		typ := util.ToString(f.Field.Interface())
+		if typ == "" {
+			counts = append(counts, 0)
+			continue
+		}
+		modelType, err := scope.PolymorphicModel(a.db.e, rel, typ)
+		if err != nil {
+			return nil, err
+		}
+		query := a.db.Model(reflect.New(modelType).Interface())
+		search.Scoping(query.e, a.db.e)
+		for _, q := range a.query {
+			query = q(query)
+		}
+		for idx, fk := range rel.ForeignFieldNames {
+			ff, err := scope.FieldByName(a.db.e, parent, fk)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Where(fmt.Sprintf("%v = ?",
+				scope.Quote(query.e, rel.AssociationForeignDBNames[idx])), ff.Field.Interface())
+		}
+		count := 0
+		err = query.Count(&count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// destination returns a value of the type of the associated records.
+func (a *Association) destination() interface{} {
+	if a.field.Field.IsValid() {
+		return a.field.Field.Interface()
+	}
+	return reflect.New(a.field.Struct.Type).Interface()
+}
+
+// Delete removes the association between the source and values, the records
+// themselves are not deleted. For many_to_many relations the rows in the join
+// table are deleted, for has_many and has_one the foreign keys of values are
+// set to NULL and for belongs_to the foreign key of the source is set to NULL.
+func (a *Association) Delete(values ...interface{}) error {
+	if err := a.single("Delete"); err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return a.remove(false, values)
+}
+
+// Replace replaces the associations of the source with values. The values are
+// saved and the association with any other record is removed as in Delete.
+func (a *Association) Replace(values ...interface{}) error {
+	if err := a.single("Replace"); err != nil {
+		return err
+	}
+	if len(values) > 0 {
+		err := a.Save(values...)
+		if err != nil {
+			return err
+		}
+		if a.field.Relationship.Kind == "belongs_to" {
+			return nil
+		}
+	}
+	return a.remove(true, values)
+}
+
+// Clear removes the association between the source and all associated
+// records, see Delete.
+func (a *Association) Clear() error {
+	return a.Replace()
+}
+
+// remove removes the association between the source and the records in
+// values, or all the associated records except the ones in values when except
+// is true. Only the associated records matching the conditions of a are
+// removed.
+func (a *Association) remove(except bool, values []interface{}) error {
+	if !except && len(a.query) == 0 {
+		err := a.unlink(values)
+		if err != nil {
+			return err
+		}
+		return a.forget(values)
+	}
+	if a.field.Relationship.IsPolymorphicBelongsTo() {
+		if len(a.query) > 0 {
+			return errors.New("association conditions are not supported on a polymorphic belongs_to")
+		}
+		err := a.unlink(nil)
+		if err != nil {
+			return err
+		}
+		return a.forget(nil)
+	}
+	current, err := a.current()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return count, nil
+	var records []interface{}
+	for _, record := range current {
+		if a.matches(reflect.ValueOf(record), values) != except {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	err = a.unlink(records)
+	if err != nil {
+		return err
+	}
+	return a.forget(records)
+}
+
+// current returns the records associated with the source which match the
+// conditions of a.
+func (a *Association) current() ([]interface{}, error) {
+	typ := a.field.Struct.Type
+	for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	records := reflect.New(reflect.SliceOf(typ))
+	err := a.Find(records.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var current []interface{}
+	for i := 0; i < records.Elem().Len(); i++ {
+		current = append(current, records.Elem().Index(i).Addr().Interface())
+	}
+	return current, nil
+}
+
+// unlink removes the association between the source and the records in
+// values, or all the associated records when values is empty. The associated
+// records, or the rows of the join model, are updated and deleted with the
+// Update and Delete hooks, so their soft delete, tenant and default scopes
+// apply. Only the rows of a join table without a model are deleted directly.
+func (a *Association) unlink(values []interface{}) error {
+	var (
+		rel    = a.field.Relationship
+		source = a.db.e.Scope.Value
+		e      = a.db.e
+
+		conditions []string
+		args       []interface{}
+		matches    []string
+	)
+	switch rel.Kind {
+	case "many_to_many":
+		h := rel.JoinTableHandler
+		c, cargs := joinConditions(e, scope.GetSearchMap(e, h, source))
+		conditions = append(conditions, c)
+		args = append(args, cargs...)
+		if h.Destination.PolymorphicDBName != "" {
+			conditions = append(conditions, fmt.Sprintf("%v = ?",
+				scope.Quote(e, h.Destination.PolymorphicDBName)))
+			args = append(args, h.Destination.PolymorphicValue)
+		}
+		for _, value := range values {
+			c, cargs := joinConditions(e, scope.GetSearchMap(e, h, source, value))
+			matches = append(matches, c)
+			args = append(args, cargs...)
+		}
+		if len(matches) > 0 {
+			conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+		}
+		where := strings.Join(conditions, " AND ")
+		if h.Model == nil {
+			return a.deleteJoinRows(h, where, args)
+		}
+		row := reflect.New(h.Model).Interface()
+		return a.scoped(row).Where(where, args...).Delete(row)
+	case "has_many", "has_one":
+		typ := a.field.Struct.Type
+		for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		destination := reflect.New(typ).Interface()
+		attrs := make(map[string]interface{})
+		for idx, fk := range rel.ForeignDBNames {
+			field, err := scope.FieldByName(e, source, rel.AssociationForeignDBNames[idx])
+			if err != nil {
+				return err
+			}
+			attrs[fk] = &model.Expr{Q: "NULL"}
+			conditions = append(conditions, fmt.Sprintf("%v = ?", scope.Quote(e, fk)))
+			args = append(args, field.Field.Interface())
+		}
+		if rel.PolymorphicType != "" {
+			conditions = append(conditions, fmt.Sprintf("%v = ?", scope.Quote(e, rel.PolymorphicDBName)))
+			args = append(args, rel.PolymorphicValue)
+		}
+		for _, value := range values {
+			pfs, err := scope.PrimaryFields(e, value)
+			if err != nil {
+				return err
+			}
+			var match []string
+			for _, pf := range pfs {
+				match = append(match, fmt.Sprintf("%v = ?", scope.Quote(e, pf.DBName)))
+				args = append(args, pf.Field.Interface())
+			}
+			matches = append(matches, "("+strings.Join(match, " AND ")+")")
+		}
+		if len(matches) > 0 {
+			conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+		}
+		return a.scoped(destination).Where(strings.Join(conditions, " AND "), args...).
+			Set(model.SaveAssociations, false).Updates(attrs, true)
+	case "belongs_to":
+		if len(values) > 0 {
+			ok, err := a.references(values)
+			if err != nil || !ok {
+				return err
+			}
+		}
+		attrs := make(map[string]interface{})
+		for _, fk := range rel.ForeignDBNames {
+			attrs[fk] = &model.Expr{Q: "NULL"}
+		}
+		if rel.IsPolymorphicBelongsTo() {
+			attrs[rel.PolymorphicDBName] = &model.Expr{Q: "NULL"}
+		}
+		return a.scoped(source).Set(model.SaveAssociations, false).Updates(attrs, true)
+	default:
+		return fmt.Errorf("unsupported relation %s", rel.Kind)
+	}
+}
+
+// scoped returns a query on value with the soft delete and tenant scoping of
+// the source.
+func (a *Association) scoped(value interface{}) *DB {
+	query := a.db.Model(value)
+	search.Scoping(query.e, a.db.e)
+	return query
+}
+
+// references returns true if the foreign keys of the source, for a belongs_to
+// relation, refer to one of values.
+func (a *Association) references(values []interface{}) (bool, error) {
+	var (
+		rel    = a.field.Relationship
+		e      = a.db.e
+		source = e.Scope.Value
+	)
+	for _, value := range values {
+		ok := true
+		for idx, fk := range rel.ForeignFieldNames {
+			f, err := scope.FieldByName(e, source, fk)
+			if err != nil {
+				return false, err
+			}
+			af, err := scope.FieldByName(e, value, rel.AssociationForeignFieldNames[idx])
+			if err != nil {
+				return false, err
+			}
+			if f.IsBlank || !util.EqualAsString(f.Field.Interface(), af.Field.Interface()) {
+				ok = false
+			}
+		}
+		if ok && rel.IsPolymorphicBelongsTo() {
+			f, err := scope.FieldByName(e, source, rel.PolymorphicType)
+			if err != nil {
+				return false, err
+			}
+			pv, err := scope.PolymorphicValue(e, rel, value)
+			if err != nil {
+				return false, err
+			}
+			ok = util.EqualAsString(f.Field.Interface(), pv)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteJoinRows deletes the rows of the join table of h matching where. The
+// join table has no model, so there are no hooks or scopes to apply.
+func (a *Association) deleteJoinRows(h *model.JoinTableHandler, where string, args []interface{}) error {
+	e := a.db.NewEngine()
+	defer engine.Put(e)
+	c, err := builder.Where(e, nil, map[string]interface{}{"query": where, "args": args})
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("DELETE FROM %v WHERE %v", scope.Quote(e, h.TableName), c)
+	if isQL(a.db) {
+		query = util.WrapTX(query)
+	}
+	_, err = model.ExecTx(e.SQLDB, query, e.Scope.SQLVars...)
+	return err
+}
+
+// joinConditions returns the condition matching the rows of a join table with
+// the values of the columns in searchMap, as built by scope.GetSearchMap, and
+// its arguments.
+func joinConditions(e *engine.Engine, searchMap map[string]interface{}) (string, []interface{}) {
+	columns := make([]string, 0, len(searchMap))
+	for column := range searchMap {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("%v = ?", scope.Quote(e, column))
+		args[i] = searchMap[column]
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", args
+}
+
+// forget updates the association field of the source after unlink, the
+// records in values, or all the records when values is empty, are removed from
+// it.
+func (a *Association) forget(values []interface{}) error {
+	field := a.field.Field
+	if field.Kind() != reflect.Slice {
+		if len(values) > 0 && !a.matches(field, values) {
+			return nil
+		}
+		field.Set(reflect.Zero(field.Type()))
+		if rel := a.field.Relationship; rel.Kind == "belongs_to" {
+			fks := rel.ForeignFieldNames
+			if rel.IsPolymorphicBelongsTo() {
+				fks = append(append([]string{}, fks...), rel.PolymorphicType)
+			}
+			for _, fk := range fks {
+				f, err := scope.FieldByName(a.db.e, a.db.e.Scope.Value, fk)
+				if err != nil {
+					return err
+				}
+				err = f.Set(nil)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	kept := reflect.MakeSlice(field.Type(), 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		elem := field.Index(i)
+		if len(values) > 0 && !a.matches(elem, values) {
+			kept = reflect.Append(kept, elem)
+		}
+	}
+	field.Set(kept)
+	return nil
+}
+
+// matches returns true if v has the same primary key as one of values.
+func (a *Association) matches(v reflect.Value, values []interface{}) bool {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	v = reflect.Indirect(v)
+	if !v.CanAddr() {
+		return false
+	}
+	pf, err := scope.PrimaryField(a.db.e, v.Addr().Interface())
+	if err != nil {
+		return false
+	}
+	for _, value := range values {
+		if reflect.Indirect(reflect.ValueOf(value)).Type() != v.Type() {
+			continue
+		}
+		p, err := scope.PrimaryField(a.db.e, value)
+		if err == nil && util.EqualAsString(pf.Field.Interface(), p.Field.Interface()) {
+			return true
+		}
+	}
+	return false
 }
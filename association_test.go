@@ -3,8 +3,11 @@ package ngorm
 import (
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/fixture"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/scope"
@@ -850,3 +853,1110 @@ func testAssociationManyToMany(t *testing.T, db *DB) {
 		t.Errorf("expected %d got %d", len(languages), len(newLanguages1))
 	}
 }
+
+func TestAssociationManyToManyDelete(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationManyToManyDelete,
+			&fixture.Language{}, &fixture.User{}, "user_languages",
+		)
+	}
+}
+
+func testAssociationManyToManyDelete(t *testing.T, db *DB) {
+	_, err := db.Automigrate(
+		&fixture.User{}, &fixture.Language{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := fixture.User{Name: "Many2Many", Languages: []fixture.Language{
+		{Name: "ZH"}, {Name: "EN"}, {Name: "DE"}, {Name: "SW"},
+	}}
+	err = db.Begin().Save(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(languages []fixture.Language) []string {
+		var n []string
+		for _, l := range languages {
+			n = append(n, l.Name)
+		}
+		sort.Strings(n)
+		return n
+	}
+	find := func() []string {
+		a, err := db.Model(&user).Association("Languages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var languages []fixture.Language
+		err = a.Find(&languages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names(languages)
+	}
+
+	a, err := db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []fixture.Language
+	err = a.Where("languages.name != ?", "ZH").Order("name").Limit(2).Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := names(found), []string{"DE", "EN"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+
+	a, err = db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete(&user.Languages[0], &user.Languages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := names(user.Languages), []string{"DE", "SW"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	if got, expect := find(), []string{"DE", "SW"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	var count int64
+	err = db.Model(&fixture.Language{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expected %d got %d", 4, count)
+	}
+
+	var en fixture.Language
+	err = db.Begin().First(&en, "name = ?", "EN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Replace(&en, &fixture.Language{Name: "FR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := find(), []string{"EN", "FR"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	err = db.Model(&fixture.Language{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected %d got %d", 5, count)
+	}
+
+	// the conditions only apply to the association returned by Where.
+	a, err = db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = nil
+	err = a.Where("languages.name = ?", "EN").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := names(found), []string{"EN"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	found = nil
+	err = a.Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := names(found), []string{"EN", "FR"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	err = a.Where("languages.name = ?", "EN").Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := find(), []string{"FR"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+
+	a, err = db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Languages) != 0 {
+		t.Errorf("expected %d got %d", 0, len(user.Languages))
+	}
+	if got := find(); len(got) != 0 {
+		t.Errorf("expected no languages got %v", got)
+	}
+}
+
+func TestAssociationHasManyDelete(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationHasManyDelete, &fixture.Post{}, &fixture.Comment{})
+	}
+}
+
+func testAssociationHasManyDelete(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&fixture.Post{}, &fixture.Comment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := fixture.Post{
+		Title:    "post has many",
+		Body:     "body has many",
+		Comments: []*fixture.Comment{{Content: "Comment 1"}, {Content: "Comment 2"}},
+	}
+	err = db.Begin().Save(&post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.Model(&post).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete(post.Comments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post.Comments) != 1 {
+		t.Errorf("expected %d got %d", 1, len(post.Comments))
+	}
+	a, err = db.Model(&post).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+	var comment fixture.Comment
+	err = db.Begin().First(&comment, "content = ?", "Comment 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment.PostID != 0 {
+		t.Errorf("expected %d got %d", 0, comment.PostID)
+	}
+
+	err = a.Append(&fixture.Comment{Content: "Comment 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Where("content = ?", "Comment 3").Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = db.Model(&post).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected %d got %d", 0, count)
+	}
+}
+
+func TestAssociationSlice(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationSlice,
+			&fixture.Language{}, &fixture.User{}, "user_languages",
+			&fixture.Post{}, &fixture.Comment{},
+		)
+	}
+}
+
+func testAssociationSlice(t *testing.T, db *DB) {
+	_, err := db.Automigrate(
+		&fixture.User{}, &fixture.Language{}, &fixture.Post{}, &fixture.Comment{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []fixture.User{
+		{Name: "slice 1", Languages: []fixture.Language{{Name: "ZH"}, {Name: "EN"}}},
+		{Name: "slice 2", Languages: []fixture.Language{{Name: "DE"}}},
+		{Name: "slice 3"},
+	}
+	for i := range users {
+		err = db.Begin().Save(&users[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := func() []int {
+		a, err := db.Model(&users).Association("Languages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := a.Counts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if got, expect := counts(), []int{2, 1, 0}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	a, err := db.Model(&users).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected %d got %d", 3, count)
+	}
+
+	var en fixture.Language
+	err = db.Begin().First(&en, "name = ?", "EN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = db.Model(&users).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Append(
+		&en,
+		[]fixture.Language{{Name: "FR"}, {Name: "IT"}},
+		&fixture.Language{Name: "SW"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := counts(), []int{2, 3, 1}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	if len(users[1].Languages) != 3 {
+		t.Errorf("expected %d got %d", 3, len(users[1].Languages))
+	}
+	if users[2].Languages[0].ID == 0 {
+		t.Error("expected appended language to be saved")
+	}
+	err = a.Append(&en)
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	posts := []fixture.Post{{Title: "post 1"}, {Title: "post 2"}}
+	for i := range posts {
+		err = db.Begin().Save(&posts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err = db.Model(&posts).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Append(
+		[]*fixture.Comment{{Content: "one"}, {Content: "two"}},
+		&fixture.Comment{Content: "three"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = db.Model(&posts).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := a.Counts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int{2, 1}; !reflect.DeepEqual(c, expect) {
+		t.Errorf("expected %v got %v", expect, c)
+	}
+	if posts[1].Comments[0].PostID != posts[1].ID {
+		t.Errorf("expected %d got %d", posts[1].ID, posts[1].Comments[0].PostID)
+	}
+}
+
+type Member struct {
+	ID          int64
+	Name        string
+	Teams       []Team `gorm:"many2many:MemberTeam"`
+	MemberTeams []MemberTeam
+}
+
+type Team struct {
+	ID   int64
+	Name string
+}
+
+type MemberTeam struct {
+	MemberID  int64 `gorm:"primary_key"`
+	TeamID    int64 `gorm:"primary_key"`
+	GrantedBy string
+	CreatedAt time.Time
+}
+
+func TestAssociationJoinModel(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationJoinModel, &Member{}, &Team{}, &MemberTeam{})
+	}
+}
+
+func TestAssociationJoinModel_register(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationJoinModelRegister, &Member{}, &Team{}, &MemberTeam{})
+	}
+}
+
+func testAssociationJoinModelRegister(t *testing.T, db *DB) {
+	err := db.Preregister(&Member{})
+	if err == nil || !strings.Contains(err.Error(), "MemberTeam") {
+		t.Fatalf("expected an error using a join model which isn't registered got %v", err)
+	}
+	// the models built before the join model is registered are built again.
+	err = db.RegisterJoinModel(&MemberTeam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Preregister(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Automigrate(&Member{}, &Team{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasColumn("member_teams", "granted_by") {
+		t.Error("expected the join model table to be created")
+	}
+}
+
+func testAssociationJoinModel(t *testing.T, db *DB) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	db.now = func() time.Time { return now }
+	err := db.RegisterJoinModel(&MemberTeam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Automigrate(&Member{}, &Team{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasColumn("member_teams", "granted_by") {
+		t.Fatal("expected the join model table to be created")
+	}
+	member := Member{Name: "gernest", Teams: []Team{{Name: "core"}}}
+	err = db.Begin().Save(&member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.Model(&member).Association("Teams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := Team{Name: "docs"}
+	err = a.WithJoin(&MemberTeam{GrantedBy: "admin"}).Append(&docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = db.Model(&member).Association("Teams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Append(&docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found Member
+	err = db.Begin().Preload("Teams").Preload("MemberTeams").First(&found, member.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Teams) != 2 {
+		t.Errorf("expected %d got %d", 2, len(found.Teams))
+	}
+	if len(found.MemberTeams) != 2 {
+		t.Fatalf("expected %d got %d", 2, len(found.MemberTeams))
+	}
+	for _, mt := range found.MemberTeams {
+		if !mt.CreatedAt.Equal(now) {
+			t.Errorf("expected created_at %v got %v", now, mt.CreatedAt)
+		}
+		expect := ""
+		if mt.TeamID == docs.ID {
+			expect = "admin"
+		}
+		if mt.GrantedBy != expect {
+			t.Errorf("expected %q got %q", expect, mt.GrantedBy)
+		}
+	}
+
+	a, err = db.Model(&member).Association("Teams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete(&docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	err = db.Model(&MemberTeam{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+}
+
+type Story struct {
+	ID      int64
+	Title   string
+	Labels  []Label  `gorm:"many2many:labelings;polymorphic:Labelable"`
+	Remarks []Remark `gorm:"polymorphic:Remarkable"`
+}
+
+type Clip struct {
+	ID     int64
+	Title  string
+	Labels []Label `gorm:"many2many:labelings;polymorphic:Labelable"`
+}
+
+type Label struct {
+	ID      int64
+	Name    string
+	Stories []Story `gorm:"many2many:labelings;association_polymorphic:Labelable"`
+}
+
+type Remark struct {
+	ID             int64
+	Body           string
+	RemarkableID   int64
+	RemarkableType string
+	Remarkable     interface{} `gorm:"polymorphic:Remarkable"`
+}
+
+func TestAssociationPolymorphicManyToMany(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationPolymorphicManyToMany, &Story{}, &Clip{}, &Label{}, "labelings")
+	}
+}
+
+func testAssociationPolymorphicManyToMany(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Story{}, &Clip{}, &Label{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasColumn("labelings", "labelable_type") {
+		t.Fatal("expected the join table to have a type column")
+	}
+	story := Story{Title: "story", Labels: []Label{{Name: "go"}}}
+	err = db.Begin().Save(&story)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip := Clip{Title: "clip"}
+	err = db.Begin().Save(&clip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.Model(&clip).Association("Labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Append(&Label{Name: "sql"}, &Label{Name: "orm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var labels []Label
+	a, err = db.Model(&story).Association("Labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Find(&labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 1 || labels[0].Name != "go" {
+		t.Errorf("expected [go] got %v", labels)
+	}
+	count, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+
+	var clips []Clip
+	err = db.Begin().Preload("Labels", func(db *DB) *DB {
+		return db.Order("name")
+	}).Find(&clips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clips) != 1 {
+		t.Fatalf("expected %d got %d", 1, len(clips))
+	}
+	var names []string
+	for _, l := range clips[0].Labels {
+		names = append(names, l.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"orm", "sql"}) {
+		t.Errorf("expected [orm sql] got %v", names)
+	}
+
+	var label Label
+	err = db.Begin().Preload("Stories").Where("name = ?", "go").First(&label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(label.Stories) != 1 || label.Stories[0].Title != "story" {
+		t.Errorf("expected [story] got %v", label.Stories)
+	}
+
+	a, err = db.Model(&clip).Association("Labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected %d got %d", 0, count)
+	}
+	a, err = db.Model(&story).Association("Labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+}
+
+func TestAssociationPolymorphicBelongsTo(t *testing.T) {
+	model.RegisterPolymorphicModel(&Story{}, &Clip{})
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationPolymorphicBelongsTo, &Story{}, &Clip{}, &Remark{})
+	}
+}
+
+func testAssociationPolymorphicBelongsTo(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Story{}, &Clip{}, &Remark{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	story := Story{Title: "story"}
+	first := Remark{Body: "first", Remarkable: &story}
+	err = db.Begin().Save(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if story.ID == 0 {
+		t.Fatal("expected the story to be saved")
+	}
+	if first.RemarkableType != "stories" || first.RemarkableID != story.ID {
+		t.Errorf("expected stories %d got %s %d", story.ID, first.RemarkableType, first.RemarkableID)
+	}
+
+	second := Remark{Body: "second"}
+	err = db.Begin().Save(&second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.Model(&second).Association("Remarkable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip := Clip{Title: "clip"}
+	err = a.Append(&clip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RemarkableType != "clips" {
+		t.Errorf("expected clips got %s", second.RemarkableType)
+	}
+
+	var remarks []Remark
+	err = db.Begin().Preload("Remarkable").Order("id").Find(&remarks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remarks) != 2 {
+		t.Fatalf("expected %d got %d", 2, len(remarks))
+	}
+	if s, ok := remarks[0].Remarkable.(*Story); !ok || s.Title != "story" {
+		t.Errorf("expected story got %#v", remarks[0].Remarkable)
+	}
+	if c, ok := remarks[1].Remarkable.(*Clip); !ok || c.Title != "clip" {
+		t.Errorf("expected clip got %#v", remarks[1].Remarkable)
+	}
+
+	var found Story
+	a, err = db.Model(&first).Association("Remarkable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != story.ID {
+		t.Errorf("expected %d got %d", story.ID, found.ID)
+	}
+	err = a.Find(&Clip{})
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+	}
+	count, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+
+	var withRemarks Story
+	err = db.Begin().Preload("Remarks").First(&withRemarks, story.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withRemarks.Remarks) != 1 || withRemarks.Remarks[0].Body != "first" {
+		t.Errorf("expected [first] got %v", withRemarks.Remarks)
+	}
+
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cleared Remark
+	err = db.Begin().First(&cleared, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.RemarkableType != "" || cleared.RemarkableID != 0 {
+		t.Errorf("expected the association to be cleared got %s %d", cleared.RemarkableType, cleared.RemarkableID)
+	}
+}
+
+type Shop struct {
+	ID      int64
+	Name    string
+	OwnerID int64
+	Owner   Owner
+	Shelves []Shelf
+	Genres  []Genre `gorm:"many2many:shop_genres"`
+}
+
+type Owner struct {
+	ID   int64
+	Name string
+}
+
+type Shelf struct {
+	ID     int64
+	Label  string
+	ShopID int64
+}
+
+type Genre struct {
+	ID   int64
+	Name string
+}
+
+func TestAssociationSaveMode(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationSaveMode, &Shop{}, &Owner{}, &Shelf{}, &Genre{}, "shop_genres")
+	}
+}
+
+func testAssociationSaveMode(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &Owner{}, &Shelf{}, &Genre{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop := Shop{
+		Name:    "corner",
+		Owner:   Owner{Name: "alice"},
+		Shelves: []Shelf{{Label: "a"}},
+		Genres:  []Genre{{Name: "poetry"}},
+	}
+	err = db.Begin().Select("Shelves").Create(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.ID == 0 || shop.Shelves[0].ShopID != shop.ID {
+		t.Errorf("expected the shop and its shelves to be saved")
+	}
+	var count int64
+	for _, v := range []interface{}{&Owner{}, &Genre{}} {
+		err = db.Model(v).Count(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("expected %d got %d", 0, count)
+		}
+	}
+	var found Shop
+	err = db.Begin().First(&found, shop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "corner" {
+		t.Errorf("expected corner got %s", found.Name)
+	}
+
+	// existing records are only referenced, their columns are not updated.
+	owner := Owner{Name: "bob"}
+	err = db.Begin().Save(&owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genre := Genre{Name: "drama"}
+	err = db.Begin().Save(&genre)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shelf := Shelf{Label: "b"}
+	err = db.Begin().Save(&shelf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop.Owner = Owner{ID: owner.ID, Name: "changed"}
+	shop.Genres = []Genre{{ID: genre.ID, Name: "changed"}}
+	shop.Shelves = []Shelf{{ID: shelf.ID, Label: "changed"}}
+	err = db.Begin().Omit("Owner.*", "Genres.*", "Shelves.*").Save(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Preload("Owner").Preload("Shelves").Preload("Genres").First(&found, shop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Owner.Name != "bob" {
+		t.Errorf("expected bob got %s", found.Owner.Name)
+	}
+	if len(found.Genres) != 1 || found.Genres[0].Name != "drama" {
+		t.Errorf("expected [drama] got %v", found.Genres)
+	}
+	var labels []string
+	for _, s := range found.Shelves {
+		labels = append(labels, s.Label)
+	}
+	sort.Strings(labels)
+	if !reflect.DeepEqual(labels, []string{"a", "b"}) {
+		t.Errorf("expected [a b] got %v", labels)
+	}
+
+	err = db.Begin().Omit("Shelves.*").Save(&Shop{Name: "new", Shelves: []Shelf{{Label: "c"}}})
+	if err == nil {
+		t.Error("expected an error referencing a shelf which is not saved")
+	}
+
+	err = db.Begin().Select("Shelves", "Genres").Delete(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := []struct {
+		model interface{}
+		count int64
+	}{
+		{&Shelf{}, 0},
+		{&Owner{}, 1},
+		{&Genre{}, 1},
+	}
+	for _, c := range counts {
+		err = db.Model(c.model).Count(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != c.count {
+			t.Errorf("expected %d got %d", c.count, count)
+		}
+	}
+	err = db.SQLCommon().QueryRow("SELECT count(*) FROM shop_genres").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected %d got %d", 0, count)
+	}
+}
+
+func TestAssociationCascadeDelete_rollback(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationCascadeDeleteRollback, &Shop{}, &Owner{}, &Shelf{}, &Genre{}, "shop_genres")
+	}
+}
+
+func testAssociationCascadeDeleteRollback(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &Owner{}, &Shelf{}, &Genre{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop := Shop{
+		Name:    "corner",
+		Shelves: []Shelf{{Label: "a"}, {Label: "b"}},
+		Genres:  []Genre{{Name: "poetry"}},
+	}
+	err = db.Begin().Select("Shelves", "Genres").Create(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the shop isn't deleted, the condition is on a column which doesn't
+	// exist.
+	err = db.Begin().Select("Shelves", "Genres").Where("missing = ?", 1).Delete(&shop)
+	if err == nil {
+		t.Fatal("expected the delete of the shop to fail")
+	}
+	var count int64
+	for _, v := range []struct {
+		query string
+		count int64
+	}{
+		{"SELECT count(*) FROM shops", 1},
+		{"SELECT count(*) FROM shelves", 2},
+		{"SELECT count(*) FROM shop_genres", 1},
+	} {
+		err = db.SQLCommon().QueryRow(v.query).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != v.count {
+			t.Errorf("%s: expected %d got %d", v.query, v.count, count)
+		}
+	}
+}
+
+func TestAssociationCount_compositeKey(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationCountCompositeKey, &Blog{}, &Tag{}, "blog_tags")
+	}
+}
+
+func testAssociationCountCompositeKey(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Blog{}, &Tag{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the blogs share their id, they are told apart by their locale.
+	blogs := []Blog{
+		{ID: 1, Locale: "EN", Subject: "en", Tags: []Tag{
+			{ID: 1, Locale: "EN", Value: "go"}, {ID: 2, Locale: "EN", Value: "sql"},
+		}},
+		{ID: 1, Locale: "ZH", Subject: "zh", Tags: []Tag{
+			{ID: 1, Locale: "ZH", Value: "go"},
+		}},
+		{ID: 2, Locale: "EN", Subject: "none"},
+	}
+	for i := range blogs {
+		err = db.Begin().Create(&blogs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, err := db.Model(&blogs).Association("Tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := a.Counts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int{2, 1, 0}; !reflect.DeepEqual(counts, expect) {
+		t.Errorf("expected %v got %v", expect, counts)
+	}
+	a, err = db.Model(&blogs[1]).Association("Tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err = a.Counts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int{1}; !reflect.DeepEqual(counts, expect) {
+		t.Errorf("expected %v got %v", expect, counts)
+	}
+}
+
+func TestAssociationDelete_scoped(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationDeleteScoped, &Trash{}, &TrashBin{})
+	}
+}
+
+func testAssociationDeleteScoped(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Trash{}, &TrashBin{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := TrashBin{Name: "bin", Trashes: []Trash{{Name: "a"}, {Name: "b"}}}
+	err = db.Begin().Save(&bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed := bin.Trashes[0]
+	err = db.Begin().Delete(&trashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.Model(&bin).Association("Trashes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the soft deleted record is out of the scope of the association, it
+	// keeps its foreign key.
+	err = a.Delete(&bin.Trashes[0], &bin.Trashes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []Trash
+	err = db.Begin().Unscoped().Order("id").Find(&all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected %d got %d", 2, len(all))
+	}
+	if all[0].TrashBinID != bin.ID {
+		t.Errorf("expected %d got %d", bin.ID, all[0].TrashBinID)
+	}
+	if all[1].TrashBinID != 0 {
+		t.Errorf("expected %d got %d", 0, all[1].TrashBinID)
+	}
+}
+
+type Player struct {
+	ID    int64
+	Name  string
+	Clubs []Club `gorm:"many2many:Membership"`
+}
+
+type Club struct {
+	ID   int64
+	Name string
+}
+
+type Membership struct {
+	ID        int64
+	PlayerID  int64
+	ClubID    int64
+	DeletedAt *time.Time
+}
+
+func TestAssociationJoinModel_softDelete(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationJoinModelSoftDelete, &Player{}, &Club{}, &Membership{})
+	}
+}
+
+func testAssociationJoinModelSoftDelete(t *testing.T, db *DB) {
+	err := db.RegisterJoinModel(&Membership{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Automigrate(&Player{}, &Club{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := Player{Name: "gernest", Clubs: []Club{{Name: "chess"}, {Name: "go"}}}
+	err = db.Begin().Save(&player)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := db.Model(&player).Association("Clubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chess := player.Clubs[0]
+	err = a.Delete(&chess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(q *DB) int {
+		a, err := q.Association("Clubs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := a.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(db.Model(&player)); n != 1 {
+		t.Errorf("expected %d got %d", 1, n)
+	}
+	if n := count(db.Model(&player).Unscoped()); n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+	var found Player
+	err = db.Begin().Preload("Clubs").First(&found, player.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Clubs) != 1 || found.Clubs[0].Name != "go" {
+		t.Errorf("expected the go club got %v", found.Clubs)
+	}
+
+	// the soft deleted row doesn't link them anymore, a new one is created.
+	a, err = db.Model(&player).Association("Clubs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Append(&chess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(db.Model(&player)); n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+	var memberships int64
+	err = db.Model(&Membership{}).Unscoped().Count(&memberships)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memberships != 3 {
+		t.Errorf("expected %d got %d", 3, memberships)
+	}
+}
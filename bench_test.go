@@ -185,3 +185,43 @@ func benchFindSQL(b *testing.B, db *DB) {
 		}
 	}
 }
+
+func BenchmarkFindGenerated(b *testing.B) {
+	for _, d := range allTestDB() {
+		db, err := d.Open()
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = db.Automigrate(&Planet{}, &Moon{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < 300; i++ {
+			if err := db.Create(&Planet{Name: "Dolan"}); err != nil {
+				b.Fatalf("error creating: %s", err)
+			}
+		}
+		b.Run(db.Dialect().GetName(), func(ts *testing.B) {
+			benchFindGenerated(ts, db)
+		})
+		err = d.Clear(&Planet{}, &Moon{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchFindGenerated matches benchFind, Planet is scanned with the scanner
+// generated by ngorm-gen.
+func benchFindGenerated(b *testing.B, db *DB) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		planets := []*Planet{}
+		b.StartTimer()
+		if err := db.Begin().Select("id, name").Find(&planets); err != nil {
+			b.Fatalf("error finding: %s", err)
+		}
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ngorm/ngorm/dialects"
 	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/regexes"
 	"github.com/ngorm/ngorm/scope"
@@ -95,7 +97,7 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 			return "", err
 		}
 		str = fmt.Sprintf("(%v%v IN (?))",
-			e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+			scope.FieldQualifier(e, modelValue),
 			scope.Quote(e, pk))
 		clause["args"] = []interface{}{value}
 	case map[string]interface{}:
@@ -103,11 +105,11 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 		for key, value := range value {
 			if value != nil {
 				sqls = append(sqls, fmt.Sprintf("(%v%v = %v)",
-					e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+					scope.FieldQualifier(e, modelValue),
 					scope.Quote(e, key), scope.AddToVars(e, value)))
 			} else {
 				sqls = append(sqls, fmt.Sprintf("(%v%v IS NULL)",
-					e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+					scope.FieldQualifier(e, modelValue),
 					scope.Quote(e, key)))
 			}
 		}
@@ -126,7 +128,7 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 			for _, field := range fds {
 				if !field.IsIgnored && !field.IsBlank {
 					sqls = append(sqls, fmt.Sprintf("(%v%v = %v)",
-						e.Dialect.QueryFieldName(scope.QuotedTableName(e, value)),
+						scope.FieldQualifier(e, value),
 						scope.Quote(e, field.DBName),
 						scope.AddToVars(e, field.Field.Interface())))
 				}
@@ -176,23 +178,57 @@ func PrimaryCondition(e *engine.Engine, modelValue, value interface{}) (string,
 		return "", err
 	}
 	return fmt.Sprintf("(%v%v = %v)",
-		e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+		scope.FieldQualifier(e, modelValue),
 		scope.Quote(e, pk), value), nil
 }
 
 //WhereSQL builds WHERE SQL clause of modelValue using the given engine e as
 //context.
 func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error) {
-	var (
-		quotedTableName                                = scope.QuotedTableName(e, modelValue)
-		primaryConditions, andConditions, orConditions []string
-	)
+	return whereSQL(e, modelValue, true)
+}
 
-	if !e.Search.Unscoped && scope.HasColumn(e, modelValue, "deleted_at") {
-		primaryConditions = append(primaryConditions,
-			fmt.Sprintf("%v deleted_at IS NULL",
-				e.Dialect.QueryFieldName(quotedTableName)),
-		)
+// whereSQL builds the WHERE clause, the tenant and default scopes of the model
+// are only applied when scoped is true.
+func whereSQL(e *engine.Engine, modelValue interface{}, scoped bool) (sql string, err error) {
+	var primaryConditions, andConditions, orConditions []string
+
+	sd, err := scope.SoftDeleteField(e, modelValue)
+	if err != nil {
+		return "", err
+	}
+	if sd != nil && !e.Search.Unscoped {
+		column := scope.FieldQualifier(e, modelValue) + scope.Quote(e, sd.DBName)
+		if e.Search.OnlyTrashed {
+			primaryConditions = append(primaryConditions, sd.SoftDelete.DeletedCondition(column))
+		} else {
+			primaryConditions = append(primaryConditions, sd.SoftDelete.NotDeletedCondition(column))
+		}
+	}
+
+	if scoped {
+		tf, tenant, err := scope.Tenant(e, modelValue)
+		if err != nil {
+			return "", err
+		}
+		if tf != nil {
+			primaryConditions = append(primaryConditions,
+				fmt.Sprintf("%v%v = %v",
+					scope.FieldQualifier(e, modelValue),
+					scope.Quote(e, tf.DBName), scope.AddToVars(e, tenant)),
+			)
+		}
+		ds, ok, err := scope.DefaultScope(e, modelValue)
+		if err != nil {
+			return "", err
+		}
+		if ok && !e.Search.Unscoped && ds.Q != "" {
+			sql, err := Where(e, modelValue, map[string]interface{}{"query": ds.Q, "args": ds.Args})
+			if err != nil {
+				return "", err
+			}
+			primaryConditions = append(primaryConditions, sql)
+		}
 	}
 
 	f, err := scope.PrimaryField(e, modelValue)
@@ -207,7 +243,7 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 		for _, field := range pfs {
 			primaryConditions = append(primaryConditions,
 				fmt.Sprintf("%v%v = %v",
-					e.Dialect.QueryFieldName(quotedTableName),
+					scope.FieldQualifier(e, modelValue),
 					scope.Quote(e, field.DBName), scope.AddToVars(e, field.Field.Interface())),
 			)
 		}
@@ -496,6 +532,13 @@ func PrepareQuery(e *engine.Engine, modelValue interface{}) error {
 //PrepareQuerySQL returns SQL that has been built on the engine e for the
 //modelValue.
 func PrepareQuerySQL(e *engine.Engine, modelValue interface{}) (string, error) {
+	shards, err := scope.Route(e, false)
+	if err != nil {
+		return "", err
+	}
+	if len(shards) > 0 {
+		return "", errmsg.ErrMissingShardKey
+	}
 	if e.Search.Raw {
 		c, err := CombinedCondition(e, modelValue)
 		if err != nil {
@@ -514,14 +557,70 @@ func PrepareQuerySQL(e *engine.Engine, modelValue interface{}) (string, error) {
 			from[i+1] = e.Search.TableNames[i]
 		}
 	}
+	lock, err := LockingSQL(e)
+	if err != nil {
+		return "", err
+	}
 	return strings.Replace(
-		fmt.Sprintf("SELECT %v FROM %v %v",
+		fmt.Sprintf("SELECT %v FROM %v %v%v",
 			SelectSQL(e, modelValue),
 			strings.Join(from, ","),
-			c),
+			c, lock),
 		"$$", "?", -1), nil
 }
 
+//Locking returns the last locking clause added to the search.
+func Locking(e *engine.Engine) (model.Locking, bool) {
+	for i := len(e.Search.Clauses) - 1; i >= 0; i-- {
+		switch c := e.Search.Clauses[i].(type) {
+		case model.Locking:
+			return c, true
+		case *model.Locking:
+			return *c, true
+		}
+	}
+	return model.Locking{}, false
+}
+
+//LockingSQL returns the row locking clause, with a leading space. An empty
+//string is returned when no locking was requested.
+func LockingSQL(e *engine.Engine) (string, error) {
+	l, ok := Locking(e)
+	if !ok {
+		return "", nil
+	}
+	if dialects.IsQL(e.Dialect) {
+		return "", fmt.Errorf("ngorm: %s does not support row locking", e.Dialect.GetName())
+	}
+	l.Strength = strings.ToUpper(strings.TrimSpace(l.Strength))
+	l.Options = strings.ToUpper(strings.TrimSpace(l.Options))
+	switch l.Strength {
+	case "UPDATE", "SHARE", "NO KEY UPDATE", "KEY SHARE":
+	default:
+		return "", fmt.Errorf("ngorm: unknown lock strength %q", l.Strength)
+	}
+	switch l.Options {
+	case "", "NOWAIT", "SKIP LOCKED":
+	default:
+		return "", fmt.Errorf("ngorm: unknown lock option %q", l.Options)
+	}
+	if d, ok := e.Dialect.(dialects.Locker); ok {
+		s, err := d.LockingSQL(l)
+		if err != nil {
+			return "", err
+		}
+		return util.AddExtraSpaceIfExist(s), nil
+	}
+	s := " FOR " + l.Strength
+	if l.Table != "" {
+		s += " OF " + scope.Quote(e, l.Table)
+	}
+	if l.Options != "" {
+		s += " " + l.Options
+	}
+	return s, nil
+}
+
 //CombinedCondition combines all conditions to build a single SQL query.
 func CombinedCondition(e *engine.Engine, modelValue interface{}) (string, error) {
 	joinSQL, err := JoinSQL(e, modelValue)
@@ -564,7 +663,9 @@ func AddIndex(e *engine.Engine, unique bool, indexName string, column ...string)
 	if unique {
 		sqlCreate = "CREATE UNIQUE INDEX"
 	}
-	w, err := WhereSQL(e, e.Scope.Value)
+	// indexes cover the rows of all the tenants and outside the default
+	// scope.
+	w, err := whereSQL(e, e.Scope.Value, false)
 	if err != nil {
 		return err
 	}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/ngorm/ngorm/fixture"
+	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/search"
 	"github.com/ngorm/ql"
 )
@@ -273,3 +274,67 @@ func TestNot(t *testing.T) {
 	}
 
 }
+
+type lockingDialect struct {
+	*ql.QL
+}
+
+func (lockingDialect) GetName() string { return "postgres" }
+
+func (lockingDialect) Quote(key string) string { return fmt.Sprintf(`"%s"`, key) }
+
+func TestLockingSQL(t *testing.T) {
+	sample := []struct {
+		lock model.Locking
+		sql  string
+	}{
+		{model.Locking{Strength: "UPDATE"}, " FOR UPDATE"},
+		{model.Locking{Strength: "update", Options: "skip locked"}, " FOR UPDATE SKIP LOCKED"},
+		{model.Locking{Strength: "SHARE", Table: "users", Options: "NOWAIT"}, ` FOR SHARE OF "users" NOWAIT`},
+		{model.Locking{Strength: "NO KEY UPDATE"}, " FOR NO KEY UPDATE"},
+	}
+	for _, v := range sample {
+		e := fixture.TestEngine()
+		e.Dialect = lockingDialect{ql.Memory()}
+		search.Clauses(e, v.lock)
+		s, err := LockingSQL(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != v.sql {
+			t.Errorf("expected %s got %s", v.sql, s)
+		}
+	}
+
+	e := fixture.TestEngine()
+	e.Dialect = lockingDialect{ql.Memory()}
+	search.Clauses(e, model.Locking{Strength: "EVERYTHING"})
+	if _, err := LockingSQL(e); err == nil {
+		t.Error("expected an error")
+	}
+	e.Search.Clauses = nil
+	search.Clauses(e, model.Locking{Strength: "UPDATE", Options: "WAIT"})
+	if _, err := LockingSQL(e); err == nil {
+		t.Error("expected an error")
+	}
+
+	e = fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	search.Clauses(e, model.Locking{Strength: "UPDATE"})
+	if _, err := LockingSQL(e); err == nil {
+		t.Error("expected an error")
+	}
+
+	e = fixture.TestEngine()
+	e.Dialect = lockingDialect{ql.Memory()}
+	search.Where(e, "name=?", "gernest")
+	search.Clauses(e, model.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	var user fixture.User
+	s, err := PrepareQuerySQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(s, "FOR UPDATE SKIP LOCKED") {
+		t.Errorf("expected locking clause got %s", s)
+	}
+}
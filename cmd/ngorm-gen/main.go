@@ -0,0 +1,406 @@
+//Command ngorm-gen generates column lists, scanners and field extractors for
+//ngorm models, so that query results are read without reflection.
+//
+//	ngorm-gen -type Person,Pet [-o person_ngorm.go] [dir]
+//
+// For every type it generates the methods
+//
+//	NGORMColumns() []string
+//	NGORMScan(columns []string) []interface{}
+//	NGORMValue(name string) (interface{}, bool)
+//
+// on the pointer to the model. The last two implement model.ColumnScanner and
+// model.FieldValuer, which ngorm picks up when they are present. It is meant
+// to be used with go generate
+//
+//	//go:generate ngorm-gen -type Person,Pet
+//
+// Fields of types from other packages are only mapped to columns for the types
+// known to be scanned by database/sql, like time.Time and the sql.Null types,
+// and the columns of an embedded model.Model are included. The other fields
+// whose type can't be resolved in the package are left out. A query selecting
+// one of their columns is scanned with reflection instead.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/util"
+)
+
+var basicTypes = map[string]bool{
+	"bool": true, "string": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// columnTypes are the types of other packages, by import path and name, which
+// are mapped to a column.
+var columnTypes = map[string]bool{
+	"time.Time":                                true,
+	"database/sql.NullBool":                    true,
+	"database/sql.NullByte":                    true,
+	"database/sql.NullFloat64":                 true,
+	"database/sql.NullInt16":                   true,
+	"database/sql.NullInt32":                   true,
+	"database/sql.NullInt64":                   true,
+	"database/sql.NullString":                  true,
+	"database/sql.NullTime":                    true,
+	"database/sql.RawBytes":                    true,
+	"encoding/json.RawMessage":                 true,
+	"github.com/ngorm/ngorm/model.DeletedFlag": true,
+	"github.com/ngorm/ngorm/model.DeletedUnix": true,
+	"github.com/ngorm/ngorm/model.Version":     true,
+}
+
+// modelColumns are the columns of model.Model, which is flattened in the
+// models embedding it.
+var modelColumns = []column{
+	{name: "id", field: "ID"},
+	{name: "created_at", field: "CreatedAt"},
+	{name: "updated_at", field: "UpdatedAt"},
+	{name: "deleted_at", field: "DeletedAt", ptr: true},
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ngorm-gen: ")
+	types := flag.String("type", "", "comma separated list of the models to generate for")
+	output := flag.String("o", "", "output file name, default <first type>_ngorm.go")
+	flag.Parse()
+	if *types == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	names := strings.Split(*types, ",")
+	out := *output
+	if out == "" {
+		out = strings.ToLower(names[0]) + "_ngorm.go"
+	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(dir, out)
+	}
+	src, err := generate(dir, filepath.Base(out), names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(out, src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// pkg is the parsed package the models are declared in.
+type pkg struct {
+	name     string
+	types    map[string]ast.Expr
+	scanners map[string]bool
+
+	// imports are the import paths of the packages by the name they are
+	// referred to with in the files of the package.
+	imports map[string]string
+}
+
+// parse parses the go files of dir, skipping the file named skip which is the
+// output of a previous run.
+func parse(dir, skip string, names []string) (*pkg, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return fi.Name() != skip
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for k := range pkgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := &pkg{name: k, types: map[string]ast.Expr{}, scanners: map[string]bool{}, imports: map[string]string{}}
+		for _, f := range pkgs[k].Files {
+			for _, imp := range f.Imports {
+				path, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					continue
+				}
+				name := path[strings.LastIndex(path, "/")+1:]
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				p.imports[name] = path
+			}
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						if ts, ok := spec.(*ast.TypeSpec); ok {
+							p.types[ts.Name.Name] = ts.Type
+						}
+					}
+				case *ast.FuncDecl:
+					if d.Recv != nil && d.Name.Name == "Scan" {
+						p.scanners[typeName(d.Recv.List[0].Type)] = true
+					}
+				}
+			}
+		}
+		if _, ok := p.types[names[0]]; ok {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("type %s not found in %s", names[0], dir)
+}
+
+// typeName returns the name of the type expr refers to, or an empty string
+// when it is not a named type.
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// column is a column mapped to a normal field of a model.
+type column struct {
+	name  string
+	field string
+	ptr   bool
+}
+
+// structOf returns the struct type of the named type of the package.
+func (p *pkg) structOf(name string) (*ast.StructType, bool) {
+	st, ok := p.types[name].(*ast.StructType)
+	return st, ok
+}
+
+// isColumn reports whether a field of type expr is a normal field, mapped to
+// a column.
+func (p *pkg) isColumn(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if basicTypes[t.Name] {
+			return true
+		}
+		typ, ok := p.types[t.Name]
+		if !ok {
+			return false
+		}
+		if _, ok := typ.(*ast.StructType); ok {
+			return p.scanners[t.Name]
+		}
+		return p.scanners[t.Name] || p.isColumn(typ)
+	case *ast.SelectorExpr:
+		return columnTypes[p.qualified(t)]
+	case *ast.IndexExpr:
+		// sql.Null[T]
+		sel, ok := t.X.(*ast.SelectorExpr)
+		return ok && p.qualified(sel) == "database/sql.Null"
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return false
+		}
+		e, ok := t.Elt.(*ast.Ident)
+		return ok && (e.Name == "byte" || e.Name == "uint8")
+	}
+	return false
+}
+
+// qualified returns the import path and name of the type of another package
+// sel refers to, like time.Time.
+func (p *pkg) qualified(sel *ast.SelectorExpr) string {
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	path, ok := p.imports[x.Name]
+	if !ok {
+		return ""
+	}
+	return path + "." + sel.Sel.Name
+}
+
+// columns returns the columns of the normal fields of st. path is the
+// selector of the struct from the receiver and prefix the prefix of the
+// column names of an embedded struct.
+func (p *pkg) columns(st *ast.StructType, path, prefix string) []column {
+	var cols []column
+	for _, f := range st.Fields.List {
+		tags := map[string]string{}
+		if f.Tag != nil {
+			tag, err := strconv.Unquote(f.Tag.Value)
+			if err == nil {
+				tags = model.ParseTagSetting(reflect.StructTag(tag))
+			}
+		}
+		if _, ok := tags["-"]; ok {
+			continue
+		}
+		names := f.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{ast.NewIdent(typeName(f.Type))}
+		}
+		typ, ptr := f.Type, false
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ, ptr = star.X, true
+		}
+		for _, name := range names {
+			if !name.IsExported() {
+				continue
+			}
+			if p.isColumn(typ) {
+				dbName := util.ToDBName(name.Name)
+				if v, ok := tags["COLUMN"]; ok {
+					dbName = v
+				}
+				cols = append(cols, column{
+					name:  prefix + dbName,
+					field: path + name.Name,
+					ptr:   ptr,
+				})
+				continue
+			}
+			if _, ok := tags["EMBEDDED"]; (ok || len(f.Names) == 0) && !ptr {
+				switch embedded := typ.(type) {
+				case *ast.Ident:
+					if est, ok := p.structOf(embedded.Name); ok {
+						cols = append(cols, p.columns(est,
+							path+name.Name+".", prefix+tags["EMBEDDED_PREFIX"])...)
+					}
+				case *ast.SelectorExpr:
+					if p.qualified(embedded) == "github.com/ngorm/ngorm/model.Model" {
+						for _, c := range modelColumns {
+							c.name = prefix + tags["EMBEDDED_PREFIX"] + c.name
+							c.field = path + name.Name + "." + c.field
+							cols = append(cols, c)
+						}
+					}
+				}
+			}
+		}
+	}
+	return cols
+}
+
+// fields returns the names of the exported fields of st.
+func fields(st *ast.StructType) []string {
+	var names []string
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			if name := typeName(f.Type); ast.IsExported(name) {
+				names = append(names, name)
+			}
+			continue
+		}
+		for _, name := range f.Names {
+			if name.IsExported() {
+				names = append(names, name.Name)
+			}
+		}
+	}
+	return names
+}
+
+func generate(dir, output string, names []string) ([]byte, error) {
+	p, err := parse(dir, output, names)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	for _, name := range names {
+		st, ok := p.structOf(name)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a struct type", name)
+		}
+		writeModel(&body, name, st, p.columns(st, "", ""))
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by ngorm-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n", p.name)
+	if bytes.Contains(body.Bytes(), []byte("model.ScanField")) {
+		fmt.Fprintf(&buf, "\nimport \"github.com/ngorm/ngorm/model\"\n")
+	}
+	buf.Write(body.Bytes())
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, errors.New("formatting generated code: " + err.Error())
+	}
+	return src, nil
+}
+
+func writeModel(buf *bytes.Buffer, name string, st *ast.StructType, cols []column) {
+	// the first field mapped to a column is the one scanned, like it is
+	// when scanning with reflection.
+	seen := map[string]bool{}
+	var unique []column
+	for _, c := range cols {
+		if !seen[c.name] {
+			seen[c.name] = true
+			unique = append(unique, c)
+		}
+	}
+
+	fmt.Fprintf(buf, "\n// NGORMColumns returns the columns of the normal fields of %s.\n", name)
+	fmt.Fprintf(buf, "func (m *%s) NGORMColumns() []string {\n", name)
+	fmt.Fprintf(buf, "return []string{")
+	for i, c := range unique {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(buf, "%q", c.name)
+	}
+	fmt.Fprintf(buf, "}\n}\n")
+
+	fmt.Fprintf(buf, "\n// NGORMScan implements model.ColumnScanner.\n")
+	fmt.Fprintf(buf, "func (m *%s) NGORMScan(columns []string) []interface{} {\n", name)
+	fmt.Fprintf(buf, "dest := make([]interface{}, len(columns))\n")
+	if len(unique) > 0 {
+		fmt.Fprintf(buf, "for i, column := range columns {\nswitch column {\n")
+		for _, c := range unique {
+			fmt.Fprintf(buf, "case %q:\n", c.name)
+			if c.ptr {
+				fmt.Fprintf(buf, "dest[i] = &m.%s\n", c.field)
+			} else {
+				fmt.Fprintf(buf, "dest[i] = model.ScanField(&m.%s)\n", c.field)
+			}
+		}
+		fmt.Fprintf(buf, "}\n}\n")
+	}
+	fmt.Fprintf(buf, "return dest\n}\n")
+
+	fmt.Fprintf(buf, "\n// NGORMValue implements model.FieldValuer.\n")
+	fmt.Fprintf(buf, "func (m *%s) NGORMValue(name string) (interface{}, bool) {\n", name)
+	if f := fields(st); len(f) > 0 {
+		fmt.Fprintf(buf, "switch name {\n")
+		for _, field := range f {
+			fmt.Fprintf(buf, "case %q:\nreturn m.%s, true\n", field, field)
+		}
+		fmt.Fprintf(buf, "}\n")
+	}
+	fmt.Fprintf(buf, "return nil, false\n}\n")
+}
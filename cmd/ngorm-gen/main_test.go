@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate("testdata", "account_ngorm.go", []string{"Account"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(src)
+	for _, v := range []string{
+		"package models",
+		`return []string{"id", "created_at", "email", "status", "nick", "username", "avatar", "tags", "home_city"}`,
+		`dest[i] = model.ScanField(&m.Base.ID)`,
+		`dest[i] = &m.Email`,
+		`dest[i] = model.ScanField(&m.Home.City)`,
+		`case "Friends":`,
+	} {
+		if !strings.Contains(s, v) {
+			t.Errorf("expected %s in\n%s", v, s)
+		}
+	}
+	for _, v := range []string{`"secret"`, `"billing"`, `"friends"`, `"internal"`} {
+		if strings.Contains(s, v) {
+			t.Errorf("expected no %s in\n%s", v, s)
+		}
+	}
+
+	src, err = generate("testdata", "profile_ngorm.go", []string{"Profile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = string(src)
+	for _, v := range []string{
+		`return []string{"id", "created_at", "updated_at", "deleted_at", "name", "age"}`,
+		`dest[i] = model.ScanField(&m.Model.ID)`,
+		`dest[i] = &m.Model.DeletedAt`,
+		`dest[i] = model.ScanField(&m.Age)`,
+	} {
+		if !strings.Contains(s, v) {
+			t.Errorf("expected %s in\n%s", v, s)
+		}
+	}
+	for _, v := range []string{`"model"`, `"website"`, `"owner"`} {
+		if strings.Contains(s, v) {
+			t.Errorf("expected no %s in\n%s", v, s)
+		}
+	}
+
+	_, err = generate("testdata", "account_ngorm.go", []string{"Status"})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
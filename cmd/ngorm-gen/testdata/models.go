@@ -0,0 +1,47 @@
+package models
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+type Status string
+
+type Base struct {
+	ID        int64
+	CreatedAt time.Time
+}
+
+type Address struct {
+	City string
+}
+
+type Tags struct{}
+
+func (t *Tags) Scan(src interface{}) error { return nil }
+
+type Account struct {
+	Base
+	Email    *string
+	Status   Status
+	Nick     sql.NullString
+	Secret   string `gorm:"-"`
+	Login    string `gorm:"column:username"`
+	Avatar   []byte
+	Tags     Tags
+	Home     Address `gorm:"embedded;embedded_prefix:home_"`
+	Billing  Address
+	Friends  []Account
+	internal int
+}
+
+type Profile struct {
+	model.Model
+	Name    string
+	Age     sql.Null[int64]
+	Website url.URL
+	Owner   *Account
+}
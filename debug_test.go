@@ -0,0 +1,69 @@
+//go:build ngormdebug
+
+package ngorm
+
+import (
+	"testing"
+
+	"github.com/ngorm/ngorm/engine"
+)
+
+func TestDB_engineLeaks(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBEngineLeaks,
+			&Buyer{}, &Wallet{}, &Purchase{}, &LineItem{}, &Employee{}, &Employer{}, &Badge{},
+		)
+	}
+}
+
+func testDBEngineLeaks(t *testing.T, db *DB) {
+	before := engine.Outstanding()
+	_, err := db.Automigrate(&Buyer{}, &Wallet{}, &Purchase{}, &LineItem{},
+		&Employee{}, &Employer{}, &Badge{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buyer := Buyer{
+		Name:   "buyer",
+		Wallet: Wallet{Balance: 10},
+		Purchases: []Purchase{
+			{Total: 1, LineItems: []LineItem{{Name: "a"}, {Name: "b"}}},
+			{Total: 2, LineItems: []LineItem{{Name: "c"}}},
+		},
+	}
+	err = db.Begin().Save(&buyer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Save(&Employee{Name: "alice", Employer: Employer{Name: "acme"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found Buyer
+	err = db.Begin().Preload("Purchases.LineItems").First(&found, buyer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := 0
+	for _, p := range found.Purchases {
+		items += len(p.LineItems)
+	}
+	if len(found.Purchases) != 2 || items != 3 {
+		t.Errorf("expected the purchases and their line items got %v", found.Purchases)
+	}
+	err = db.Last(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FirstSQL(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.LastSQL(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := engine.Outstanding() - before; n != 0 {
+		t.Errorf("expected all the engines to be put back got %d outstanding", n)
+	}
+}
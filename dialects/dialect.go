@@ -70,6 +70,30 @@ type Dialect interface {
 	QueryFieldName(tableName string) string
 }
 
+// Locker is implemented by dialects which render row locking clauses
+// differently from the standard FOR UPDATE syntax.
+type Locker interface {
+	// LockingSQL returns the locking clause to be appended to a SELECT
+	// statement.
+	LockingSQL(l model.Locking) (string, error)
+}
+
+// Windower is implemented by dialects to state whether they support window
+// functions like ROW_NUMBER() OVER (...).
+type Windower interface {
+	SupportsWindowFunctions() bool
+}
+
+// SupportsWindowFunctions returns true if window functions can be used with
+// the dialect d. Dialects are assumed to support them unless they implement
+// Windower, ql doesn't.
+func SupportsWindowFunctions(d Dialect) bool {
+	if w, ok := d.(Windower); ok {
+		return w.SupportsWindowFunctions()
+	}
+	return !IsQL(d)
+}
+
 var baseOpener *DefaultOpener
 
 func init() {
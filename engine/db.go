@@ -28,7 +28,23 @@ type Engine struct {
 	StructMap *model.SafeStructsMap
 	SQLDB     model.SQLCommon
 
+	// Resolver routes read queries to replicas of the database.
+	Resolver *model.Resolver
+
+	// Sharding routes the queries on sharded tables to their shards.
+	Sharding *model.Sharding
+
+	// Tenancy scopes the queries to the tenant of Ctx.
+	Tenancy *model.Tenancy
+
+	// JoinModels are the models used as join tables of many_to_many
+	// relationships.
+	JoinModels *model.JoinModels
+
 	Now func() time.Time
+
+	// pooled is true while the engine is in the pool.
+	pooled bool
 }
 
 // Clone returns a new copy of engine
@@ -39,6 +55,11 @@ func (e *Engine) Clone() *Engine {
 	en.Dialect = e.Dialect
 	en.StructMap = e.StructMap
 	en.SQLDB = e.SQLDB
+	en.Resolver = e.Resolver
+	en.Sharding = e.Sharding
+	en.Tenancy = e.Tenancy
+	en.JoinModels = e.JoinModels
+	en.Now = e.Now
 	return en
 }
 
@@ -48,9 +69,13 @@ func (e *Engine) reset() {
 	e.Ctx = nil
 	e.Dialect = nil
 	e.Search = &model.Search{}
-	e.Scope = model.NewScope()
+	e.Scope.Reset()
 	e.StructMap = nil
 	e.SQLDB = nil
+	e.Resolver = nil
+	e.Sharding = nil
+	e.Tenancy = nil
+	e.JoinModels = nil
 	e.Now = nil
 }
 
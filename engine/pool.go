@@ -1,44 +1,37 @@
 package engine
 
-import "github.com/ngorm/ngorm/model"
+import (
+	"sync"
 
-var l *list
+	"github.com/ngorm/ngorm/model"
+)
 
-func init() {
-	l = &list{c: make(chan *Engine, 1000*3)}
-}
-
-type list struct {
-	c chan *Engine
-}
-
-func (l *list) Get() (e *Engine) {
-	select {
-	case e = <-l.c:
-	default:
-		e = &Engine{
+var pool = sync.Pool{
+	New: func() interface{} {
+		return &Engine{
 			Scope:  model.NewScope(),
 			Search: &model.Search{},
 		}
-	}
-	return
-}
-
-func (l *list) Put(e *Engine) {
-	if e != nil {
-		e.reset()
-		select {
-		case l.c <- e:
-		default:
-		}
-	}
-
+	},
 }
 
+//Get returns an engine from the pool. The engine must be given back with Put
+//once it is no longer used.
 func Get() *Engine {
-	return l.Get()
+	e := pool.Get().(*Engine)
+	e.pooled = false
+	acquire(e)
+	return e
 }
 
+//Put resets e and gives it back to the pool. e must not be used after it is
+//put, nor put more than once; when built with the ngormdebug tag both are
+//detected. Putting a nil engine does nothing.
 func Put(e *Engine) {
-	l.Put(e)
+	if e == nil || !release(e) {
+		return
+	}
+	e.reset()
+	e.pooled = true
+	pool.Put(e)
 }
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+func TestPut(t *testing.T) {
+	e := Get()
+	e.RowsAffected = 10
+	e.Ctx = context.Background()
+	e.Search.TableName = "foos"
+	e.Scope.Set("key", "value")
+	e.Scope.ContextValue(&struct{}{})
+	e.Scope.SQL = "SELECT * FROM foos"
+	e.Scope.SQLVars = []interface{}{1}
+	scope := e.Scope
+	e.reset()
+	if e.RowsAffected != 0 || e.Ctx != nil {
+		t.Errorf("expected the engine to be reset got %#v", e)
+	}
+	if e.Search.TableName != "" {
+		t.Errorf("expected the search to be reset got %#v", e.Search)
+	}
+	if e.Scope != scope {
+		t.Error("expected the scope to be reused")
+	}
+	if v := e.Scope.GetAll(); len(v) != 0 {
+		t.Errorf("expected no scope values got %v", v)
+	}
+	if e.Scope.Value != nil || e.Scope.SQL != "" || e.Scope.SQLVars != nil {
+		t.Errorf("expected the scope to be reset got %#v", e.Scope)
+	}
+	Put(e)
+	Put(nil)
+}
+
+func TestPut_twice(t *testing.T) {
+	if Debug {
+		t.Skip("putting an engine twice panics with ngormdebug")
+	}
+	e := Get()
+	Put(e)
+	Put(e)
+	a, b := Get(), Get()
+	if a == b {
+		t.Error("expected an engine put twice to be handed out once")
+	}
+	for _, n := range []*Engine{a, b} {
+		if n.Scope == nil || n.Search == nil {
+			t.Fatalf("expected an initialized engine got %#v", n)
+		}
+		n.Scope.Set(model.OrderByPK, "ASC")
+	}
+}
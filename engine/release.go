@@ -0,0 +1,28 @@
+//go:build !ngormdebug
+
+package engine
+
+//Debug is true when ngorm is built with the ngormdebug tag.
+const Debug = false
+
+// acquire does nothing, engines are only tracked with the ngormdebug tag.
+func acquire(e *Engine) {}
+
+// release reports whether e can be given back to the pool. An engine which is
+// already in the pool is ignored, so that it isn't handed out twice.
+func release(e *Engine) bool {
+	return !e.pooled
+}
+
+//Outstanding returns the number of engines taken from the pool which were not
+//put back yet. It is only counted when built with the ngormdebug tag, tests use
+//it to find the engines which are never put.
+func Outstanding() int64 {
+	return 0
+}
+
+//PutStack returns the stack trace of the call which put e back to the pool.
+//It is only recorded when built with the ngormdebug tag.
+func PutStack(e *Engine) string {
+	return ""
+}
@@ -0,0 +1,56 @@
+//go:build ngormdebug
+
+package engine
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+//Debug is true when ngorm is built with the ngormdebug tag.
+const Debug = true
+
+// released holds the stack traces of the calls which put engines back to the
+// pool.
+var released sync.Map
+
+// outstanding is the number of engines which were taken and not put back.
+var outstanding int64
+
+// acquire counts e as outstanding until it is put.
+func acquire(e *Engine) {
+	atomic.AddInt64(&outstanding, 1)
+}
+
+// release records the caller putting e back and panics when e was already put.
+//
+// The engine is never reused. Its Scope and Search are cleared instead, so that
+// using it after it is put panics rather than reading, or leaking into, the
+// state of another query. The engines are kept for the lifetime of the
+// program, the debug build is not meant for production.
+func release(e *Engine) bool {
+	if stack, ok := released.LoadOrStore(e, string(debug.Stack())); ok {
+		panic(fmt.Sprintf("ngorm: engine put twice, first put at:\n%s", stack))
+	}
+	atomic.AddInt64(&outstanding, -1)
+	*e = Engine{}
+	return false
+}
+
+//Outstanding returns the number of engines taken from the pool which were not
+//put back yet. It is only counted when built with the ngormdebug tag, tests use
+//it to find the engines which are never put.
+func Outstanding() int64 {
+	return atomic.LoadInt64(&outstanding)
+}
+
+//PutStack returns the stack trace of the call which put e back to the pool.
+//It is only recorded when built with the ngormdebug tag.
+func PutStack(e *Engine) string {
+	if stack, ok := released.Load(e); ok {
+		return stack.(string)
+	}
+	return ""
+}
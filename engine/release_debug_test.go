@@ -0,0 +1,34 @@
+//go:build ngormdebug
+
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelease(t *testing.T) {
+	e := Get()
+	Put(e)
+	if e.Scope != nil || e.Search != nil {
+		t.Error("expected the engine to be unusable after it is put")
+	}
+	if s := PutStack(e); !strings.Contains(s, "TestRelease") {
+		t.Errorf("expected the stack of the put got %q", s)
+	}
+	for i := 0; i < 10; i++ {
+		if Get() == e {
+			t.Fatal("expected an engine which was put not to be reused")
+		}
+	}
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected putting an engine twice to panic")
+		}
+		if s, ok := r.(string); !ok || !strings.Contains(s, "engine put twice") {
+			t.Errorf("unexpected panic %v", r)
+		}
+	}()
+	Put(e)
+}
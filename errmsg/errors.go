@@ -23,6 +23,33 @@ var (
 	//ErrInvalidFieldValue invalid field value
 	ErrInvalidFieldValue = errors.New("ngorm: field value not valid")
 
+	// ErrLockWithoutTransaction when row locking is used outside of a transaction
+	ErrLockWithoutTransaction = errors.New("ngorm: row locking requires a transaction")
+
+	// ErrStaleObject when updating a versioned record which was modified since it was loaded
+	ErrStaleObject = errors.New("ngorm: stale object")
+
 	// ErrMissingModel when the struct model is not set for the database operation
 	ErrMissingModel = errors.New("missing model")
+
+	// ErrMissingShardKey when the shard of a query on a sharded table can't be found
+	ErrMissingShardKey = errors.New("ngorm: missing shard key")
+
+	// ErrShardFanOut when a query run on all the shards can't be merged
+	ErrShardFanOut = errors.New("ngorm: can't merge the shards")
+
+	// ErrShardTransaction when a transaction is used with a table sharded across databases
+	ErrShardTransaction = errors.New("ngorm: transactions can't span shard databases")
+
+	// ErrMissingTenant when a query on a model scoped by tenant has no tenant in its context
+	ErrMissingTenant = errors.New("ngorm: missing tenant")
+
+	// ErrWrongTenant when creating a record of another tenant than the one of the context
+	ErrWrongTenant = errors.New("ngorm: record of another tenant")
+
+	// ErrInvalidPage when paginating with a page or a page size lower than 1
+	ErrInvalidPage = errors.New("ngorm: invalid page")
+
+	// ErrInvalidCursor when a pagination cursor can't be decoded
+	ErrInvalidCursor = errors.New("ngorm: invalid cursor")
 )
@@ -20,6 +20,7 @@ const (
 	AddIndexSQL    = "add_index_sql"
 	DeleteSQL      = "delete_sql"
 	AddUniqueIndex = "add_unique_index"
+	PerParentSQL   = "per_parent_sql"
 )
 
 var samples map[string]map[string]string
@@ -167,6 +168,10 @@ DELETE FROM "foos"  WHERE "foos"."id" = $1
 	o[DeleteSQL] = s
 	s = `CREATE UNIQUE INDEX idx_foo_stuff ON "foos"("stuff")`
 	o[AddUniqueIndex] = s
+	s = `
+SELECT * FROM (SELECT "line_items".*, ROW_NUMBER() OVER (PARTITION BY "line_items"."purchase_id" ORDER BY name desc) AS ngorm_row_number FROM "line_items"  WHERE ("purchase_id" IN ($1,$2))) AS "line_items" WHERE ngorm_row_number <= 2 ORDER BY "purchase_id", ngorm_row_number
+`
+	o[PerParentSQL] = s
 	return o
 }
 
@@ -0,0 +1,203 @@
+package ngorm
+
+import (
+	"context"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+// Query is a query on the model T. It is built with the same chain methods
+// as DB, but the results are typed, so a wrong destination is caught by the
+// compiler instead of failing when the query is executed. Like a chain on DB,
+// a Query is spent by the method executing it.
+//
+//	users, err := ngorm.G[User](db).Where("age > ?", 18).Order("name").Find()
+type Query[T any] struct {
+	db *DB
+}
+
+// G returns a query on the model T. The conditions already chained on db are
+// kept.
+func G[T any](db *DB) *Query[T] {
+	if db.e == nil {
+		db = db.Begin()
+	}
+	if db.e.Scope.Value == nil {
+		db.e.Scope.ContextValue(new(T))
+	}
+	return &Query[T]{db: db}
+}
+
+// DB returns the underlying DB of the query.
+func (q *Query[T]) DB() *DB {
+	return q.db
+}
+
+// Where adds a condition to the query, see DB.Where.
+func (q *Query[T]) Where(query interface{}, args ...interface{}) *Query[T] {
+	q.db = q.db.Where(query, args...)
+	return q
+}
+
+// Or adds an OR condition to the query, see DB.Or.
+func (q *Query[T]) Or(query interface{}, args ...interface{}) *Query[T] {
+	q.db = q.db.Or(query, args...)
+	return q
+}
+
+// Not adds a NOT condition to the query, see DB.Not.
+func (q *Query[T]) Not(query interface{}, args ...interface{}) *Query[T] {
+	q.db = q.db.Not(query, args...)
+	return q
+}
+
+// Select specifies the fields to retrieve, see DB.Select.
+func (q *Query[T]) Select(query interface{}, args ...interface{}) *Query[T] {
+	q.db = q.db.Select(query, args...)
+	return q
+}
+
+// Omit specifies the fields to leave out when saving, see DB.Omit.
+func (q *Query[T]) Omit(columns ...string) *Query[T] {
+	q.db = q.db.Omit(columns...)
+	return q
+}
+
+// Order sets the order of the records, see DB.Order.
+func (q *Query[T]) Order(value interface{}, reorder ...bool) *Query[T] {
+	q.db = q.db.Order(value, reorder...)
+	return q
+}
+
+// Limit sets the number of records to retrieve.
+func (q *Query[T]) Limit(limit interface{}) *Query[T] {
+	q.db = q.db.Limit(limit)
+	return q
+}
+
+// Offset sets the number of records to skip.
+func (q *Query[T]) Offset(offset interface{}) *Query[T] {
+	q.db = q.db.Offset(offset)
+	return q
+}
+
+// Group adds a GROUP BY clause.
+func (q *Query[T]) Group(query string) *Query[T] {
+	q.db = q.db.Group(query)
+	return q
+}
+
+// Having adds a HAVING clause.
+func (q *Query[T]) Having(query string, values ...interface{}) *Query[T] {
+	q.db = q.db.Having(query, values...)
+	return q
+}
+
+// Joins adds a JOIN clause, see DB.Joins.
+func (q *Query[T]) Joins(query string, args ...interface{}) *Query[T] {
+	q.db = q.db.Joins(query, args...)
+	return q
+}
+
+// Preload preloads the association column, see DB.Preload.
+func (q *Query[T]) Preload(column string, conditions ...interface{}) *Query[T] {
+	q.db = q.db.Preload(column, conditions...)
+	return q
+}
+
+// Unscoped includes the soft deleted records.
+func (q *Query[T]) Unscoped() *Query[T] {
+	q.db = q.db.Unscoped()
+	return q
+}
+
+// Scopes applies the scopes to the query, see DB.Scopes.
+func (q *Query[T]) Scopes(scopes ...func(*DB) *DB) *Query[T] {
+	q.db = q.db.Scopes(scopes...)
+	return q
+}
+
+// UnscopedTenant includes the records of all the tenants.
+func (q *Query[T]) UnscopedTenant() *Query[T] {
+	q.db = q.db.UnscopedTenant()
+	return q
+}
+
+// WithContext sets the context of the query, see DB.WithContext.
+func (q *Query[T]) WithContext(ctx context.Context) *Query[T] {
+	q.db = q.db.WithContext(ctx)
+	return q
+}
+
+// Find returns the records matching the query.
+func (q *Query[T]) Find(where ...interface{}) ([]T, error) {
+	var out []T
+	err := q.db.Find(&out, where...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FindSQL generates SQL query for Find.
+func (q *Query[T]) FindSQL(where ...interface{}) (*model.Expr, error) {
+	var out []T
+	return q.db.FindSQL(&out, where...)
+}
+
+// First returns the first record ordered by primary key.
+func (q *Query[T]) First(where ...interface{}) (T, error) {
+	var out T
+	err := q.db.First(&out, where...)
+	return out, err
+}
+
+// Last returns the last record ordered by primary key.
+func (q *Query[T]) Last(where ...interface{}) (T, error) {
+	var out T
+	err := q.db.Last(&out, where...)
+	return out, err
+}
+
+// Count returns the number of records matching the query.
+func (q *Query[T]) Count() (int64, error) {
+	var n int64
+	err := q.db.Count(&n)
+	return n, err
+}
+
+// Create inserts value, see DB.Create.
+func (q *Query[T]) Create(value *T) error {
+	return q.db.Create(value)
+}
+
+// Save updates value, or inserts it when its primary key is blank.
+func (q *Query[T]) Save(value *T) error {
+	return q.db.Save(value)
+}
+
+// Delete deletes the records matching the query.
+func (q *Query[T]) Delete(where ...interface{}) error {
+	return q.db.Delete(new(T), where...)
+}
+
+// Paginate returns the records of page, see DB.Paginate.
+func (q *Query[T]) Paginate(page, perPage int) ([]T, Page, error) {
+	var out []T
+	p, err := q.db.Paginate(page, perPage).Find(&out)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	return out, p, nil
+}
+
+// PaginateCursor returns the records following cursor, see
+// DB.PaginateCursor.
+func (q *Query[T]) PaginateCursor(cursor string, perPage int, keys ...string) ([]T, CursorPage, error) {
+	var out []T
+	p, err := q.db.PaginateCursor(cursor, perPage, keys...).Find(&out)
+	if err != nil {
+		return nil, CursorPage{}, err
+	}
+	return out, p, nil
+}
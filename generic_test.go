@@ -0,0 +1,90 @@
+package ngorm
+
+import (
+	"strings"
+	"testing"
+)
+
+type Gopher struct {
+	ID   int64
+	Name string
+	Age  int
+}
+
+func TestG(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testG, &Gopher{})
+	}
+}
+
+func testG(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Gopher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []Gopher{{Name: "rob", Age: 60}, {Name: "ken", Age: 70}, {Name: "ian", Age: 30}} {
+		g := g
+		err = G[Gopher](db).Create(&g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.ID == 0 {
+			t.Fatal("expected the primary key to be set")
+		}
+	}
+
+	gophers, err := G[Gopher](db).Where("age > ?", 50).Order("name").Find()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gophers) != 2 || gophers[0].Name != "ken" || gophers[1].Name != "rob" {
+		t.Errorf("expected [ken rob] got %v", gophers)
+	}
+
+	first, err := G[Gopher](db).First()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "rob" {
+		t.Errorf("expected %s got %s", "rob", first.Name)
+	}
+	last, err := G[Gopher](db).Where("age < ?", 65).Last()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Name != "ian" {
+		t.Errorf("expected %s got %s", "ian", last.Name)
+	}
+	_, err = G[Gopher](db).Where("name = ?", "russ").First()
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	n, err := G[Gopher](db).Where("age > ?", 50).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+
+	sql, err := G[Gopher](db).Where("age > ?", 50).FindSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.Q, "gophers") {
+		t.Errorf("expected the gophers table in %s", sql.Q)
+	}
+
+	err = G[Gopher](db).Delete("name = ?", "ian")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = G[Gopher](db).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,7 +28,14 @@ import (
 // If all is well HookAfterQuery is executed, if this hook is not registered
 // then no error is returned.
 func Query(e *engine.Engine) error {
-	err := QuerySQL(e)
+	shards, err := scope.Route(e, false)
+	if err != nil {
+		return err
+	}
+	if len(shards) > 0 {
+		return queryShards(e, shards)
+	}
+	err = QuerySQL(e)
 	if err != nil {
 		return err
 	}
@@ -38,15 +46,118 @@ func Query(e *engine.Engine) error {
 	return AfterQuery(e)
 }
 
+// queryShards runs the query of e on each of shards and merges the records
+// found. The records are sorted by the order of the query and the offset and
+// limit are applied to the merged records, each shard being queried for the
+// first offset+limit records. A struct destination is set to the first
+// record. The associations are preloaded once, for the merged records.
+//
+// Grouped queries can't be merged and fail with errmsg.ErrShardFanOut, so do
+// orders which aren't by columns.
+func queryShards(e *engine.Engine, shards []model.Shard) error {
+	if e.Search.Group != "" || len(e.Search.HavingConditions) > 0 {
+		return fmt.Errorf("%w: group by", errmsg.ErrShardFanOut)
+	}
+	preloadJoins(e)
+	dest := e.Scope.Value
+	d, hasDest := e.Scope.Get(model.QueryDestination)
+	if hasDest {
+		dest = d
+	}
+	results := reflect.ValueOf(dest)
+	if results.Kind() != reflect.Ptr {
+		return errmsg.ErrUnaddressable
+	}
+	isSlice := results.Elem().Kind() == reflect.Slice
+	typ := results.Elem().Type()
+	if !isSlice {
+		typ = reflect.SliceOf(typ)
+	}
+	offset, limit, err := scope.ShardLimit(e)
+	if err != nil {
+		return err
+	}
+	s := e.Search.Clone()
+	s.Offset = nil
+	s.Preload = nil
+	if limit >= 0 {
+		s.Limit = max(offset, 0) + limit
+	}
+	values := e.Scope.GetAll()
+	merged := reflect.New(typ).Elem()
+	for _, shard := range shards {
+		found, err := queryShard(e, shard, s, values, typ, hasDest)
+		if err != nil {
+			return err
+		}
+		merged = reflect.AppendSlice(merged, reflect.ValueOf(found).Elem())
+	}
+	err = scope.SortShardRecords(e, merged)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		merged = merged.Slice(min(offset, merged.Len()), merged.Len())
+	}
+	if limit >= 0 && merged.Len() > limit {
+		merged = merged.Slice(0, limit)
+	}
+	e.RowsAffected = int64(merged.Len())
+	if !isSlice {
+		if merged.Len() == 0 {
+			return errmsg.ErrRecordNotFound
+		}
+		results.Elem().Set(merged.Index(0))
+	} else {
+		results.Elem().Set(merged)
+	}
+	return AfterQuery(e)
+}
+
+// queryShard runs the query of e with the search s on shard, scanning the
+// records into a new slice of type typ which is returned. The associations
+// are not preloaded.
+func queryShard(e *engine.Engine, shard model.Shard, s *model.Search, values map[string]interface{},
+	typ reflect.Type, hasDest bool) (interface{}, error) {
+	ne := e.Clone()
+	defer engine.Put(ne)
+	ne.Search = s.Clone()
+	for k, v := range values {
+		ne.Scope.Set(k, v)
+	}
+	d := reflect.New(typ).Interface()
+	if hasDest {
+		ne.Scope.ContextValue(e.Scope.Value)
+		ne.Scope.Set(model.QueryDestination, d)
+	} else {
+		ne.Scope.ContextValue(d)
+	}
+	err := scope.UseShard(ne, shard)
+	if err != nil {
+		return nil, err
+	}
+	err = QuerySQL(ne)
+	if err != nil {
+		return nil, err
+	}
+	return d, QueryExec(ne)
+}
+
 //QueryExec  executes SQL queries and scans the result to the pointer object
 //that is in e.Scope.Value.
 //
 // The value stored in e.Scope.Value can only either be a struct or a slice
 // other types are not supported.
 //
+// When model.QueryDestination is set, the results are scanned into it instead.
+// The destination can be any struct whose fields match the selected columns by
+// name or by the column tag, a slice of such structs, a map[string]interface{}
+// or a []map[string]interface{}. This allows projections into types which are
+// not models.
+//
 // NOTE: queries are not executed in transaction context.
 func QueryExec(e *engine.Engine) error {
-	var isSlice, isPtr bool
+	var isSlice, isPtr, isMap bool
 	var resultType reflect.Type
 	results := reflect.ValueOf(e.Scope.Value)
 	if results.Kind() == reflect.Ptr {
@@ -55,7 +166,8 @@ func QueryExec(e *engine.Engine) error {
 	if value, ok := e.Scope.Get(model.QueryDestination); ok {
 		results = reflect.Indirect(reflect.ValueOf(value))
 	}
-	if kind := results.Kind(); kind == reflect.Slice {
+	switch kind := results.Kind(); kind {
+	case reflect.Slice:
 		isSlice = true
 		resultType = results.Type().Elem()
 		results.Set(reflect.MakeSlice(results.Type(), 0, 0))
@@ -64,15 +176,40 @@ func QueryExec(e *engine.Engine) error {
 			isPtr = true
 			resultType = resultType.Elem()
 		}
-	} else if kind != reflect.Struct {
-		return errors.New("unsupported destination, should be slice or struct")
+		switch resultType.Kind() {
+		case reflect.Struct:
+		case reflect.Map:
+			if !isMapDestination(resultType) {
+				return errors.New("unsupported destination, map should be map[string]interface{}")
+			}
+			isMap = true
+		default:
+			return errors.New("unsupported destination, should be slice of struct or map")
+		}
+	case reflect.Map:
+		if !isMapDestination(results.Type()) {
+			return errors.New("unsupported destination, map should be map[string]interface{}")
+		}
+		if results.IsNil() {
+			if !results.CanSet() {
+				return errmsg.ErrUnaddressable
+			}
+			results.Set(reflect.MakeMap(results.Type()))
+		}
+		isMap = true
+	case reflect.Struct:
+	default:
+		return errors.New("unsupported destination, should be slice, struct or map")
 	}
 	e.RowsAffected = 0
+	if _, ok := builder.Locking(e); ok && !model.IsTransaction(e.SQLDB) {
+		return errmsg.ErrLockWithoutTransaction
+	}
 	if str, ok := e.Scope.Get(model.QueryOption); ok {
 		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
 	}
 
-	rows, err := e.SQLDB.Query(e.Scope.SQL, e.Scope.SQLVars...)
+	rows, err := scope.Reader(e).Query(e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
@@ -80,18 +217,69 @@ func QueryExec(e *engine.Engine) error {
 		_ = rows.Close()
 	}()
 
+	var modelFields []*model.Field
+	if isMap {
+		// the model fields are only used to pick scan types, a model which
+		// isn't a struct just means the driver values are used as they are.
+		modelFields, _ = scope.Fields(e, e.Scope.Value)
+	}
 	columns, _ := rows.Columns()
+	generated := false
+	if !isMap && len(e.Search.JoinAssociations) == 0 {
+		typ := results.Type()
+		if isSlice {
+			typ = resultType
+		}
+		_, generated = scope.GeneratedScanner(e, reflect.New(typ).Interface(), columns)
+	}
 	for rows.Next() {
 		e.RowsAffected++
+		if isMap {
+			m, err := scope.ScanMap(rows, columns, modelFields)
+			if err != nil {
+				return err
+			}
+			if !isSlice {
+				for k, v := range m {
+					results.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(&v).Elem())
+				}
+				continue
+			}
+			elem := reflect.ValueOf(m).Convert(resultType)
+			if isPtr {
+				ptr := reflect.New(resultType)
+				ptr.Elem().Set(elem)
+				elem = ptr
+			}
+			results.Set(reflect.Append(results, elem))
+			continue
+		}
 		elem := results
 		if isSlice {
 			elem = reflect.New(resultType).Elem()
 		}
-		fields, err := scope.Fields(e, elem.Addr().Interface())
-		if err != nil {
-			return err
+		if generated {
+			s := elem.Addr().Interface().(model.ColumnScanner)
+			err := scope.ScanColumns(rows, columns, s.NGORMScan(columns))
+			if err != nil {
+				return err
+			}
+		} else {
+			fields, err := scope.Fields(e, elem.Addr().Interface())
+			if err != nil {
+				return err
+			}
+			if len(e.Search.JoinAssociations) > 0 {
+				joined, set, err := joinedFields(e, elem)
+				if err != nil {
+					return err
+				}
+				scope.Scan(rows, columns, append(fields, joined...))
+				set()
+			} else {
+				scope.Scan(rows, columns, fields)
+			}
 		}
-		scope.Scan(rows, columns, fields)
 		if isSlice {
 			if isPtr {
 				results.Set(reflect.Append(results, elem.Addr()))
@@ -106,9 +294,18 @@ func QueryExec(e *engine.Engine) error {
 	return nil
 }
 
+func isMapDestination(typ reflect.Type) bool {
+	return typ.Key().Kind() == reflect.String &&
+		typ.Elem().Kind() == reflect.Interface
+}
+
 //QuerySQL generates SQL for queries. This uses `builder.PrepareQuery` to build
 //the desired SQL query.
 func QuerySQL(e *engine.Engine) error {
+	err := route(e, false)
+	if err != nil {
+		return err
+	}
 	if orderBy, ok := e.Scope.Get(model.OrderByPK); ok {
 		pf, err := scope.PrimaryField(e, e.Scope.ValueOf())
 		if err != nil {
@@ -120,9 +317,155 @@ func QuerySQL(e *engine.Engine) error {
 		}
 
 	}
+	if len(e.Search.JoinAssociations) > 0 {
+		err := JoinAssociations(e)
+		if err != nil {
+			return err
+		}
+	}
 	return builder.PrepareQuery(e, e.Scope.ValueOf())
 }
 
+// preloadJoins turns the joined associations after the first one into
+// preloads with ql, which supports a single outer join per query.
+func preloadJoins(e *engine.Engine) {
+	if dialects.IsQL(e.Dialect) && len(e.Search.JoinAssociations) > 1 {
+		for _, name := range e.Search.JoinAssociations[1:] {
+			search.Preload(e, name)
+		}
+		e.Search.JoinAssociations = e.Search.JoinAssociations[:1]
+	}
+}
+
+//JoinAssociations adds a LEFT JOIN for each of the has_one and belongs_to
+//associations in e.Search.JoinAssociations. The joined table is aliased to the
+//name of the association and its columns are selected as Association__column,
+//unless columns were selected explicitly.
+//
+// ql supports a single outer join per query, the associations after the first
+// one are preloaded instead.
+func JoinAssociations(e *engine.Engine) error {
+	preloadJoins(e)
+	value := e.Scope.Value
+	m, err := scope.GetModelStruct(e, value)
+	if err != nil {
+		return err
+	}
+	selects := []string{scope.QualifiedColumns(e, value)}
+	for _, name := range e.Search.JoinAssociations {
+		var field *model.StructField
+		for _, f := range m.StructFields {
+			if f.Name == name {
+				field = f
+				break
+			}
+		}
+		if field == nil || field.Relationship == nil {
+			return fmt.Errorf("ngorm: %s is not an association of %s", name, m.ModelType.Name())
+		}
+		rel := field.Relationship
+		if rel.IsPolymorphicBelongsTo() {
+			return fmt.Errorf("ngorm: can not join %s, polymorphic associations can not be joined", name)
+		}
+		if rel.Kind != "has_one" && rel.Kind != "belongs_to" {
+			return fmt.Errorf("ngorm: can not join %s, only has_one and belongs_to associations can be joined", name)
+		}
+		typ := field.Struct.Type
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		destination := reflect.New(typ).Interface()
+		ne := e.Clone()
+		table := scope.QuotedTableName(ne, destination)
+		engine.Put(ne)
+
+		var (
+			alias      = scope.Quote(e, name)
+			source     = scope.QuotedTableName(e, value)
+			conditions []string
+			args       []interface{}
+		)
+		for idx, fk := range rel.ForeignDBNames {
+			if rel.Kind == "belongs_to" {
+				conditions = append(conditions, fmt.Sprintf("%v.%v = %v.%v",
+					alias, scope.Quote(e, rel.AssociationForeignDBNames[idx]),
+					source, scope.Quote(e, fk)))
+			} else {
+				conditions = append(conditions, fmt.Sprintf("%v.%v = %v.%v",
+					alias, scope.Quote(e, fk),
+					source, scope.Quote(e, rel.AssociationForeignDBNames[idx])))
+			}
+		}
+		if rel.PolymorphicType != "" {
+			conditions = append(conditions, fmt.Sprintf("%v.%v = ?",
+				alias, scope.Quote(e, rel.PolymorphicDBName)))
+			args = append(args, rel.PolymorphicValue)
+		}
+		sd, err := scope.SoftDeleteField(e, destination)
+		if err != nil {
+			return err
+		}
+		if sd != nil && !e.Search.Unscoped {
+			conditions = append(conditions, sd.SoftDelete.NotDeletedCondition(
+				alias+"."+scope.Quote(e, sd.DBName)))
+		}
+		search.Join(e, fmt.Sprintf("LEFT OUTER JOIN %v AS %v ON %v",
+			table, alias, strings.Join(conditions, " AND ")), args...)
+
+		dm, err := scope.GetModelStruct(e, destination)
+		if err != nil {
+			return err
+		}
+		for _, f := range dm.StructFields {
+			if f.IsNormal && !f.IsIgnored {
+				selects = append(selects, fmt.Sprintf("%v.%v AS %v",
+					alias, scope.Quote(e, f.DBName),
+					scope.Quote(e, scope.JoinedColumn(name, f.DBName))))
+			}
+		}
+	}
+	if e.Search.Selects == nil {
+		search.Select(e, strings.Join(selects, ", "))
+	}
+	return nil
+}
+
+// joinedFields returns the fields for scanning the associations of elem which
+// are loaded with a join. The returned function sets the pointer associations
+// which were found, it must be called after scanning.
+func joinedFields(e *engine.Engine, elem reflect.Value) ([]*model.Field, func(), error) {
+	var (
+		fields []*model.Field
+		found  []func()
+	)
+	for _, name := range e.Search.JoinAssociations {
+		f := elem.FieldByName(name)
+		if !f.IsValid() {
+			continue
+		}
+		target := f
+		if f.Kind() == reflect.Ptr {
+			target = reflect.New(f.Type().Elem()).Elem()
+			ptr, dest := f, target
+			found = append(found, func() {
+				if pf, err := scope.PrimaryField(e, dest.Addr().Interface()); err == nil && !pf.IsBlank {
+					ptr.Set(dest.Addr())
+				}
+			})
+		}
+		fds, err := scope.JoinedFields(e, target.Addr().Interface(), name)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, fds...)
+	}
+	return fields, func() {
+		for _, fn := range found {
+			fn()
+		}
+	}, nil
+}
+
 //AfterQuery executes any call back after the  Query hook has been executed. Any
 //callback registered with key model.HookQueryAfterFind will be executed.
 func AfterQuery(e *engine.Engine) error {
@@ -135,9 +478,26 @@ func AfterQuery(e *engine.Engine) error {
 	return nil
 }
 
+// route routes the query of e on a sharded table to its shard, it fails when
+// the shard key isn't known.
+func route(e *engine.Engine, useValue bool) error {
+	shards, err := scope.Route(e, useValue)
+	if err != nil {
+		return err
+	}
+	if len(shards) > 0 {
+		return errmsg.ErrMissingShardKey
+	}
+	return nil
+}
+
 //Create the hook executed to create a new record.
 func Create(e *engine.Engine) error {
-	err := CreateSQL(e)
+	err := route(e, true)
+	if err != nil {
+		return err
+	}
+	err = CreateSQL(e)
 	if err != nil {
 		return err
 	}
@@ -155,6 +515,10 @@ func create(e *engine.Engine) error {
 		// The blank columns with default values
 		cv []string
 	)
+	err := scope.SetTenant(e)
+	if err != nil {
+		return err
+	}
 	fds, err := scope.Fields(e, e.Scope.ValueOf())
 	if err != nil {
 		return err
@@ -193,7 +557,7 @@ func create(e *engine.Engine) error {
 		extraOption string
 	)
 
-	primaryField, err := scope.PrimaryField(e, e.Scope.ValueOf())
+	primaryField, err := createPrimaryField(e)
 	if err != nil {
 		return err
 	}
@@ -230,6 +594,19 @@ func create(e *engine.Engine) error {
 	return nil
 }
 
+// createPrimaryField returns the primary field of the model being created, it
+// is nil for models without a primary key.
+func createPrimaryField(e *engine.Engine) (*model.Field, error) {
+	m, err := scope.GetModelStruct(e, e.Scope.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.PrimaryFields) == 0 {
+		return nil, nil
+	}
+	return scope.PrimaryField(e, e.Scope.Value)
+}
+
 //CreateExec executes the INSERT query and assigns primary key if it is not set
 //assuming the primary key is the ID field.
 func CreateExec(e *engine.Engine) error {
@@ -247,19 +624,7 @@ func CreateExec(e *engine.Engine) error {
 	if lastInsertIDReturningSuffix == "" || primaryField == nil {
 		var result sql.Result
 		if dialects.IsQL(e.Dialect) {
-			tx, err := e.SQLDB.Begin()
-			if err != nil {
-				return err
-			}
-			result, err = tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-			if err != nil {
-				rerr := tx.Rollback()
-				if rerr != nil {
-					return rerr
-				}
-				return err
-			}
-			err = tx.Commit()
+			result, err = model.ExecTx(e.SQLDB, e.Scope.SQL, e.Scope.SQLVars...)
 			if err != nil {
 				return err
 			}
@@ -414,6 +779,32 @@ func UpdateTimestamp(e *engine.Engine) error {
 	return nil
 }
 
+//CreateTimestamp sets the CreatedAt field of a new record of a join model, if
+//it is blank.
+func CreateTimestamp(e *engine.Engine) error {
+	field, err := scope.FieldByName(e, e.Scope.Value, "CreatedAt")
+	if err != nil || !field.IsBlank {
+		return nil
+	}
+	if t := field.Struct.Type; t != reflect.TypeOf(time.Time{}) && t != reflect.TypeOf(&time.Time{}) {
+		return nil
+	}
+	return scope.SetColumn(e, field, e.Now())
+}
+
+//InitVersion sets the version of a new record to 1, if the model has a version
+//field which is blank.
+func InitVersion(e *engine.Engine) error {
+	field, err := scope.VersionField(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	if field != nil && field.IsBlank {
+		return field.Set(1)
+	}
+	return nil
+}
+
 //AssignUpdatingAttrs assigns value for the attributes that are supposed to be
 //updated.
 func AssignUpdatingAttrs(e *engine.Engine) error {
@@ -436,6 +827,13 @@ func SaveBeforeAssociation(e *engine.Engine) error {
 	}
 	for _, field := range fds {
 		if ok, relationship := scope.SaveFieldAsAssociation(e, field); ok && relationship.Kind == "belongs_to" {
+			if relationship.IsPolymorphicBelongsTo() {
+				err = savePolymorphicBelongsTo(e, field)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			fieldValue := field.Field.Addr().Interface()
 
 			// For the fieldValue, we need to make sure the value is saved into
@@ -445,9 +843,13 @@ func SaveBeforeAssociation(e *engine.Engine) error {
 			// build sql for creating the new record and model.HookCreateExec
 			// which will execute the generates SQL.
 			ne := e.Clone()
-			defer engine.Put(ne)
 			ne.Scope.ContextValue(fieldValue)
-			err = Create(ne)
+			if scope.AssociationSaveMode(e, field) == model.SaveReference {
+				err = referenced(ne)
+			} else {
+				err = SaveAssociation(ne)
+			}
+			engine.Put(ne)
 			if err != nil {
 				return err
 			}
@@ -471,6 +873,300 @@ func SaveBeforeAssociation(e *engine.Engine) error {
 	return nil
 }
 
+// savePolymorphicBelongsTo saves the record in the interface field of the
+// model in e, and sets the foreign key and type columns of the model to refer
+// to it. Records which are not pointers are replaced by a pointer to a copy,
+// so the primary key can be set.
+func savePolymorphicBelongsTo(e *engine.Engine, field *model.Field) error {
+	rel := field.Relationship
+	target := field.Field.Elem()
+	if target.Kind() != reflect.Ptr {
+		p := reflect.New(target.Type())
+		p.Elem().Set(target)
+		target = p
+		field.Field.Set(target)
+	}
+	ne := e.Clone()
+	defer engine.Put(ne)
+	ne.Scope.ContextValue(target.Interface())
+	var err error
+	if scope.AssociationSaveMode(e, field) == model.SaveReference {
+		err = referenced(ne)
+	} else {
+		err = SaveAssociation(ne)
+	}
+	if err != nil {
+		return err
+	}
+	for idx, fieldName := range rel.ForeignFieldNames {
+		af, err := scope.FieldByName(e, target.Interface(), rel.AssociationForeignDBNames[idx])
+		if err != nil {
+			return err
+		}
+		err = scope.SetColumn(e, fieldName, af.Field.Interface())
+		if err != nil {
+			return err
+		}
+	}
+	value, err := scope.PolymorphicValue(e, rel, target.Interface())
+	if err != nil {
+		return err
+	}
+	return scope.SetColumn(e, rel.PolymorphicType, value)
+}
+
+//SaveAssociation saves the associated record in ne. Records with a blank
+//primary key, or which are not in the database yet, are created and the rest
+//are updated.
+func SaveAssociation(ne *engine.Engine) error {
+	if pf, err := scope.PrimaryField(ne, ne.Scope.Value); err == nil && !pf.IsBlank {
+		ue := ne.Clone()
+		defer engine.Put(ue)
+		ue.Scope.ContextValue(ne.Scope.Value)
+		err = Update(ue)
+		if err != nil {
+			return err
+		}
+		if ue.RowsAffected > 0 {
+			return nil
+		}
+	}
+	return Create(ne)
+}
+
+// referenced returns an error if the associated record in ne, which is
+// referenced by the model being saved, is not in the database.
+func referenced(ne *engine.Engine) error {
+	pf, err := scope.PrimaryField(ne, ne.Scope.Value)
+	if err != nil {
+		return err
+	}
+	if pf.IsBlank {
+		return fmt.Errorf("ngorm: can not reference %s without primary key", ne.Scope.TypeName())
+	}
+	return nil
+}
+
+// reference links the associated record in ne with the model being saved by
+// updating its foreign keys only, the other columns are left untouched.
+func reference(ne *engine.Engine, rel *model.Relationship) error {
+	err := referenced(ne)
+	if err != nil {
+		return err
+	}
+	attrs := make(map[string]interface{})
+	for _, fieldName := range rel.ForeignFieldNames {
+		f, err := scope.FieldByName(ne, ne.Scope.Value, fieldName)
+		if err != nil {
+			return err
+		}
+		attrs[f.DBName] = f.Field.Interface()
+	}
+	if rel.PolymorphicType != "" {
+		attrs[rel.PolymorphicDBName] = rel.PolymorphicValue
+	}
+	ue := ne.Clone()
+	defer engine.Put(ue)
+	ue.Scope.ContextValue(ne.Scope.Value)
+	ue.Scope.Set(model.UpdateColumn, true)
+	ue.Scope.Set(model.SaveAssociations, false)
+	ue.Scope.Set(model.UpdateInterface, attrs)
+	return Update(ue)
+}
+
+//SaveFieldAssociation saves the has_many, has_one or many_to_many association
+//in field of the model in e. fds are the fields of the model. Associations
+//which are only referenced, see scope.AssociationSaveMode, are linked with the
+//model without saving the associated records.
+func SaveFieldAssociation(e *engine.Engine, field *model.Field, fds []*model.Field) error {
+	var err error
+	rel := field.Relationship
+	value := field.Field
+	mode := scope.AssociationSaveMode(e, field)
+	switch value.Kind() {
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			vi := value.Index(i)
+			var elem interface{}
+			if vi.Kind() == reflect.Ptr {
+				elem = vi.Interface()
+			} else {
+				elem = vi.Addr().Interface()
+			}
+			err = saveAssociationElem(e, rel, mode, fds, elem)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		fieldValue := field.Field.Addr().Interface()
+		ne := e.Clone()
+		defer engine.Put(ne)
+		ne.Scope.ContextValue(fieldValue)
+		if rel.PolymorphicType != "" {
+			err = scope.SetColumn(ne, rel.PolymorphicType, rel.PolymorphicValue)
+			if err != nil {
+				return err
+			}
+		}
+		if len(rel.ForeignFieldNames) != 0 {
+			// set value's foreign key
+			for idx, fieldName := range rel.ForeignFieldNames {
+				associationForeignName := rel.AssociationForeignFieldNames[idx]
+				for _, fd := range fds {
+					if fd.Name == associationForeignName {
+						err = scope.SetColumn(ne, fieldName, fd.Field.Interface())
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+		if mode == model.SaveReference {
+			err = reference(ne, rel)
+		} else {
+			err = SaveAssociation(ne)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAssociationElem saves elem, an element of the has_many or many_to_many
+// association rel of the model in e, and links it with the model.
+func saveAssociationElem(e *engine.Engine, rel *model.Relationship, mode model.AssociationSave,
+	fds []*model.Field, elem interface{}) error {
+	ne := e.Clone()
+	defer engine.Put(ne)
+	ne.Scope.ContextValue(elem)
+	var err error
+	if rel.JoinTableHandler == nil && len(rel.ForeignFieldNames) != 0 {
+		for idx, fieldName := range rel.ForeignFieldNames {
+			associationForeignName := rel.AssociationForeignFieldNames[idx]
+			for _, fd := range fds {
+				if fd.Name == associationForeignName {
+					err = scope.SetColumn(ne, fieldName, fd.Field.Interface())
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	if rel.PolymorphicType != "" {
+		err = scope.SetColumn(ne, rel.PolymorphicType, rel.PolymorphicValue)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case mode != model.SaveReference:
+		err = SaveAssociation(ne)
+	case rel.JoinTableHandler != nil:
+		err = referenced(ne)
+	default:
+		err = reference(ne, rel)
+	}
+	if err != nil {
+		return err
+	}
+	if h := rel.JoinTableHandler; h != nil && h.Model != nil {
+		err = AddJoinModel(e, h, e.Scope.Value, ne.Scope.Value)
+		if err != nil {
+			return err
+		}
+	} else if h != nil {
+		ne.Scope.SQL = ""
+		ne.Scope.SQLVars = nil
+		expr, err := scope.AddJoinRelation(h.TableName, h, ne, e.Scope.Value, ne.Scope.Value)
+		if err != nil {
+			return err
+		}
+		if dialects.IsQL(e.Dialect) {
+			expr.Q = util.WrapTX(expr.Q)
+			_, err = model.ExecTx(ne.SQLDB, expr.Q, expr.Args...)
+			if err != nil {
+				return err
+			}
+		} else {
+			_, err = ne.SQLDB.Exec(expr.Q, expr.Args...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//AddJoinModel links source and destination by creating a record of the join
+//model of h, unless they are already linked. The record is created with the
+//Create hook, and its CreatedAt is set. The rest of the columns are copied from
+//the value stored in the scope of e with key model.JoinValue, if any.
+//
+// The existing records are looked for, with the scoping of e, in the same
+// transaction as the record is created.
+func AddJoinModel(e *engine.Engine, h *model.JoinTableHandler, source, destination interface{}) error {
+	searchMap := scope.GetSearchMap(e, h, source, destination)
+	columns := make([]string, 0, len(searchMap))
+	for column := range searchMap {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	row := reflect.New(h.Model)
+	if v, ok := e.Scope.Get(model.JoinValue); ok {
+		jv := reflect.Indirect(reflect.ValueOf(v))
+		if jv.Type() != h.Model {
+			return fmt.Errorf("expected join value of type %v got %v", h.Model, jv.Type())
+		}
+		row.Elem().Set(jv)
+	}
+	return model.RunTx(e.SQLDB, func(tx model.SQLCommon) error {
+		ce := e.Clone()
+		defer engine.Put(ce)
+		ce.SQLDB = tx
+		search.Scoping(ce, e)
+		ce.Scope.ContextValue(reflect.New(h.Model).Interface())
+		for _, column := range columns {
+			search.Where(ce, fmt.Sprintf("%v = ?", scope.Quote(ce, column)), searchMap[column])
+		}
+		search.Select(ce, "count(*)")
+		ce.Search.IgnoreOrderQuery = true
+		err := builder.PrepareQuery(ce, ce.Scope.Value)
+		if err != nil {
+			return err
+		}
+		var count int64
+		err = tx.QueryRow(ce.Scope.SQL, ce.Scope.SQLVars...).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		ne := e.Clone()
+		defer engine.Put(ne)
+		ne.SQLDB = tx
+		search.Scoping(ne, e)
+		ne.Scope.ContextValue(row.Interface())
+		ne.Scope.Set(model.SaveAssociations, false)
+		for _, column := range columns {
+			err = scope.SetColumn(ne, column, searchMap[column])
+			if err != nil {
+				return err
+			}
+		}
+		err = CreateTimestamp(ne)
+		if err != nil {
+			return err
+		}
+		return Create(ne)
+	})
+}
+
 //AfterAssociation saves associations on the model
 func AfterAssociation(e *engine.Engine) error {
 	if !scope.ShouldSaveAssociation(e) {
@@ -486,102 +1182,9 @@ func AfterAssociation(e *engine.Engine) error {
 			case "has_many",
 				"has_one",
 				"many_to_many":
-				value := field.Field
-				switch value.Kind() {
-				case reflect.Slice:
-					for i := 0; i < value.Len(); i++ {
-						ne := e.Clone()
-						defer engine.Put(ne)
-						vi := value.Index(i)
-						var elem interface{}
-						if vi.Kind() == reflect.Ptr {
-							elem = vi.Interface()
-						} else {
-							elem = vi.Addr().Interface()
-						}
-						ne.Scope.ContextValue(elem)
-						if rel.JoinTableHandler == nil && len(rel.ForeignFieldNames) != 0 {
-							for idx, fieldName := range rel.ForeignFieldNames {
-								associationForeignName := rel.AssociationForeignFieldNames[idx]
-								for _, fd := range fds {
-									if fd.Name == associationForeignName {
-										err = scope.SetColumn(ne, fieldName, fd.Field.Interface())
-										if err != nil {
-											return err
-										}
-									}
-								}
-							}
-						}
-						if rel.PolymorphicType != "" {
-							err = scope.SetColumn(ne, rel.PolymorphicType, rel.PolymorphicValue)
-							if err != nil {
-								return err
-							}
-						}
-						err = Create(ne)
-						if err != nil {
-							return err
-						}
-						if h := rel.JoinTableHandler; h != nil {
-							ne.Scope.SQL = ""
-							ne.Scope.SQLVars = nil
-							expr, err := scope.AddJoinRelation(h.TableName, h, ne, e.Scope.Value, ne.Scope.Value)
-							if err != nil {
-								return err
-							}
-							if dialects.IsQL(e.Dialect) {
-								expr.Q = util.WrapTX(expr.Q)
-								tx, err := ne.SQLDB.Begin()
-								if err != nil {
-									return err
-								}
-								_, err = tx.Exec(expr.Q, expr.Args...)
-								if err != nil {
-									tx.Rollback()
-									return err
-								}
-								if err = tx.Commit(); err != nil {
-									return err
-								}
-							} else {
-								_, err = ne.SQLDB.Exec(expr.Q, expr.Args...)
-								if err != nil {
-									return err
-								}
-							}
-						}
-
-					}
-				default:
-					fieldValue := field.Field.Addr().Interface()
-					ne := e.Clone()
-					defer engine.Put(ne)
-					ne.Scope.ContextValue(fieldValue)
-					if rel.PolymorphicType != "" {
-						err = scope.SetColumn(ne, rel.PolymorphicType, rel.PolymorphicValue)
-						if err != nil {
-							return err
-						}
-					}
-					if len(rel.ForeignFieldNames) != 0 {
-						// set value's foreign key
-						for idx, fieldName := range rel.ForeignFieldNames {
-							associationForeignName := rel.AssociationForeignFieldNames[idx]
-							for _, fd := range fds {
-								if fd.Name == associationForeignName {
-									err = scope.SetColumn(ne, fieldName, fd.Field.Interface())
-									if err != nil {
-										return err
-									}
-								}
-							}
-						}
-					}
-					err = Create(ne)
-					if err != nil {
-						return err
-					}
+				err = SaveFieldAssociation(e, field, fds)
+				if err != nil {
+					return err
 				}
 			}
 		}
@@ -591,13 +1194,21 @@ func AfterAssociation(e *engine.Engine) error {
 
 //CreateSQL generates SQL for creating new record
 func CreateSQL(e *engine.Engine) error {
+	err := route(e, true)
+	if err != nil {
+		return err
+	}
 	if scope.ShouldSaveAssociation(e) {
-		err := SaveBeforeAssociation(e)
+		err = SaveBeforeAssociation(e)
 		if err != nil {
 			return err
 		}
 	}
-	err := UpdateTimestamp(e)
+	err = UpdateTimestamp(e)
+	if err != nil {
+		return err
+	}
+	err = InitVersion(e)
 	if err != nil {
 		return err
 	}
@@ -626,23 +1237,53 @@ func CreateSQL(e *engine.Engine) error {
 //UpdateSQL builds query for updating records.
 func UpdateSQL(e *engine.Engine) error {
 	var sqls []string
-	err := AssignUpdatingAttrs(e)
+	err := route(e, true)
 	if err != nil {
 		return err
 	}
+	err = AssignUpdatingAttrs(e)
+	if err != nil {
+		return err
+	}
+	var version *model.Field
+	if _, ok := e.Scope.Get(model.UpdateColumn); !ok {
+		version, err = scope.VersionField(e, e.Scope.Value)
+		if err != nil {
+			return err
+		}
+	}
 	if updateAttrs, ok := e.Scope.Get(model.UpdateAttrs); ok {
-		for column, value := range updateAttrs.(map[string]interface{}) {
+		attrs := updateAttrs.(map[string]interface{})
+		if version != nil {
+			if _, ok := attrs[version.DBName]; ok {
+				// the version is explicitly set by the caller.
+				version = nil
+			}
+		}
+		for column, value := range attrs {
+			err = scope.CheckTenant(e, column, value)
+			if err != nil {
+				return err
+			}
 			sqls = append(sqls, fmt.Sprintf("%v = %v",
 				scope.Quote(e, column),
 				scope.AddToVars(e, value)))
 		}
 	} else {
+		// the record keeps the tenant of the query.
+		err = scope.SetTenant(e)
+		if err != nil {
+			return err
+		}
 		fds, err := scope.Fields(e, e.Scope.Value)
 		if err != nil {
 			return err
 		}
 		for _, field := range fds {
 			if scope.ChangeableField(e, field) {
+				if field.IsVersion && version != nil {
+					continue
+				}
 				if !field.IsPrimaryKey && field.IsNormal {
 					sqls = append(sqls, fmt.Sprintf("%v = %v",
 						scope.Quote(e, field.DBName),
@@ -671,6 +1312,19 @@ func UpdateSQL(e *engine.Engine) error {
 		extraOption = fmt.Sprint(str)
 	}
 
+	if len(sqls) > 0 && version != nil {
+		column := scope.Quote(e, version.DBName)
+		sqls = append(sqls, fmt.Sprintf("%v = %v + 1", column, column))
+		// records are checked even at version 0, only the updates of a model
+		// without primary key, which update many records, are not.
+		if pf, err := scope.PrimaryField(e, e.Scope.Value); err != nil || !pf.IsBlank {
+			search.Where(e, fmt.Sprintf("%v%v = ?",
+				e.Dialect.QueryFieldName(scope.QuotedTableName(e, e.Scope.Value)),
+				column), version.Field.Interface())
+			e.Scope.Set(model.UpdateVersion, version)
+		}
+	}
+
 	if len(sqls) > 0 {
 		c, err := builder.CombinedCondition(e, e.Scope.Value)
 		if err != nil {
@@ -697,24 +1351,16 @@ func UpdateExec(e *engine.Engine) error {
 	if e.Scope.SQL == "" {
 		return errors.New("missing update sql ")
 	}
-	tx, err := e.SQLDB.Begin()
+	result, err := model.ExecTx(e.SQLDB, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
-	result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-	if err != nil {
-		rerr := tx.Rollback()
-		if rerr != nil {
-			return rerr
-		}
-		return err
-	}
 	r, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 	e.RowsAffected = r
-	return tx.Commit()
+	return nil
 }
 
 //Update generates and executes sql query for updating records.This relies on
@@ -726,8 +1372,13 @@ func UpdateExec(e *engine.Engine) error {
 //which executes the UPDATE sql.
 func Update(e *engine.Engine) error {
 
+	err := route(e, true)
+	if err != nil {
+		return err
+	}
+
 	// run before update hooks
-	err := BeforeUpdate(e)
+	err = BeforeUpdate(e)
 	if err != nil {
 		return err
 	}
@@ -744,26 +1395,61 @@ func Update(e *engine.Engine) error {
 		return err
 	}
 
+	err = UpdateVersion(e)
+	if err != nil {
+		return err
+	}
+
 	// execute update sql
 	return AfterUpdate(e)
 }
 
+//UpdateVersion checks the outcome of an update of a versioned record. When no
+//rows were affected the record was modified by someone else and
+//errmsg.ErrStaleObject is returned, otherwise the version of the model is
+//incremented to match the one in the database.
+func UpdateVersion(e *engine.Engine) error {
+	v, ok := e.Scope.Get(model.UpdateVersion)
+	if !ok {
+		return nil
+	}
+	if e.RowsAffected == 0 {
+		return errmsg.ErrStaleObject
+	}
+	field := v.(*model.Field)
+	switch value := reflect.Indirect(field.Field); value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Set(value.Uint() + 1)
+	default:
+		return field.Set(value.Int() + 1)
+	}
+}
+
 // DeleteSQL generatesSQL for deleting records.
 func DeleteSQL(e *engine.Engine) error {
+	err := route(e, true)
+	if err != nil {
+		return err
+	}
 	var extraOption string
 	if str, ok := e.Scope.Get(model.DeleteOption); ok {
 		extraOption = fmt.Sprint(str)
 	}
 
-	if e.Dialect.HasColumn(scope.TableName(e, e.Scope.Value), "DeletedAt") {
+	sd, err := scope.SoftDeleteField(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	if sd != nil && !e.Search.Unscoped {
 		c, err := builder.CombinedCondition(e, e.Scope.Value)
 		if err != nil {
 			return err
 		}
 		e.Scope.SQL = fmt.Sprintf(
-			"UPDATE %v SET deleted_at=%v%v%v",
+			"UPDATE %v SET %v = %v%v%v",
 			scope.QuotedTableName(e, e.Scope.Value),
-			scope.AddToVars(e, e.Now()),
+			scope.Quote(e, sd.DBName),
+			scope.AddToVars(e, sd.SoftDelete.DeletedValue(e.Now())),
 			util.AddExtraSpaceIfExist(c),
 			util.AddExtraSpaceIfExist(extraOption),
 		)
@@ -798,25 +1484,46 @@ func BeforeDelete(e *engine.Engine) error {
 
 // Delete deletes records. This makes sure to call BeforeDelete hook before
 // deleting anything and also calls AfterDelete before exiting.
+//
+// When associations are selected they are deleted along with the records in a
+// transaction, unless e is already in one, so that they are kept when the
+// records can't be deleted.
 func Delete(e *engine.Engine) error {
-	err := BeforeDelete(e)
+	err := route(e, true)
 	if err != nil {
 		return err
 	}
-
-	err = DeleteSQL(e)
+	err = BeforeDelete(e)
 	if err != nil {
 		return err
 	}
+	if len(scope.SelectAttrs(e)) == 0 {
+		return deleteExec(e)
+	}
 
-	if dialects.IsQL(e.Dialect) {
-		tx, err := e.SQLDB.Begin()
+	// the associations are only deleted along with the records.
+	db := e.SQLDB
+	defer func() { e.SQLDB = db }()
+	return model.RunTx(db, func(tx model.SQLCommon) error {
+		e.SQLDB = tx
+		err := DeleteAssociations(e)
 		if err != nil {
 			return err
 		}
-		result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
+		return deleteExec(e)
+	})
+}
+
+// deleteExec deletes the records of e.
+func deleteExec(e *engine.Engine) error {
+	err := DeleteSQL(e)
+	if err != nil {
+		return err
+	}
+
+	if dialects.IsQL(e.Dialect) {
+		result, err := model.ExecTx(e.SQLDB, e.Scope.SQL, e.Scope.SQLVars...)
 		if err != nil {
-			_ = tx.Rollback()
 			return err
 		}
 		a, err := result.RowsAffected()
@@ -824,10 +1531,6 @@ func Delete(e *engine.Engine) error {
 			return err
 		}
 		e.RowsAffected = a
-		err = tx.Commit()
-		if err != nil {
-			return err
-		}
 	} else {
 		result, err := e.SQLDB.Exec(e.Scope.SQL, e.Scope.SQLVars...)
 		if err != nil {
@@ -842,6 +1545,165 @@ func Delete(e *engine.Engine) error {
 	return nil
 }
 
+// DeleteAssociations deletes the records owned by the records being deleted,
+// which are the ones in the has_one and has_many associations named with
+// Select. For many_to_many associations the rows of the join table are
+// deleted. Only the associations of the records in the scope value, which
+// must have their primary keys set, are deleted.
+//
+//	db.Select("Emails", "Languages").Delete(&user)
+func DeleteAssociations(e *engine.Engine) error {
+	selectAttrs := scope.SelectAttrs(e)
+	if len(selectAttrs) == 0 {
+		return nil
+	}
+	m, err := scope.GetModelStruct(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	for _, field := range m.StructFields {
+		rel := field.Relationship
+		if rel == nil || !selected(field, selectAttrs) {
+			continue
+		}
+		names := rel.AssociationForeignFieldNames
+		if rel.Kind == "many_to_many" {
+			names = nil
+			for _, fk := range rel.JoinTableHandler.Source.ForeignKeys {
+				if f := scope.GetForeignField(fk.AssociationDBName, m.StructFields); f != nil {
+					names = append(names, f.Name)
+				}
+			}
+		}
+		keys := util.ColumnAsArray(names, e.Scope.Value)
+		if len(keys) == 0 {
+			continue
+		}
+		switch rel.Kind {
+		case "has_one", "has_many":
+			typ := field.Struct.Type
+			for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			ce := e.Clone()
+			search.Unscoped(ce, e.Search.Unscoped)
+			ce.Scope.ContextValue(reflect.New(typ).Interface())
+			search.Where(ce, fmt.Sprintf("%v IN (%v)",
+				scope.ToQueryCondition(ce, rel.ForeignDBNames),
+				util.ToQueryMarks(keys)), util.ToQueryValues(keys)...)
+			if rel.PolymorphicType != "" {
+				search.Where(ce, fmt.Sprintf("%v = ?",
+					scope.Quote(ce, rel.PolymorphicDBName)), rel.PolymorphicValue)
+			}
+			err = Delete(ce)
+			engine.Put(ce)
+			if err != nil {
+				return err
+			}
+		case "many_to_many":
+			h := rel.JoinTableHandler
+			ce := e.Clone()
+			var columns []string
+			for _, fk := range h.Source.ForeignKeys {
+				columns = append(columns, fk.DBName)
+			}
+			var marks []string
+			for _, key := range keys {
+				var vars []string
+				for _, v := range key {
+					vars = append(vars, scope.AddToVars(ce, v))
+				}
+				if len(vars) == 1 {
+					marks = append(marks, vars[0])
+				} else {
+					marks = append(marks, "("+strings.Join(vars, ",")+")")
+				}
+			}
+			query := fmt.Sprintf("DELETE FROM %v WHERE %v IN (%v)",
+				scope.Quote(ce, h.TableName), scope.ToQueryCondition(ce, columns),
+				strings.Join(marks, ","))
+			if h.Source.PolymorphicDBName != "" {
+				query += fmt.Sprintf(" AND %v = %v", scope.Quote(ce, h.Source.PolymorphicDBName),
+					scope.AddToVars(ce, h.Source.PolymorphicValue))
+			}
+			if dialects.IsQL(e.Dialect) {
+				query = util.WrapTX(query)
+			}
+			_, err = model.ExecTx(ce.SQLDB, query, ce.Scope.SQLVars...)
+			engine.Put(ce)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selected returns true if the association field is named in selectAttrs.
+func selected(field *model.StructField, selectAttrs []string) bool {
+	for _, attr := range selectAttrs {
+		if attr == field.Name || attr == model.Associations {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoreSQL generates SQL for restoring soft deleted records.
+func RestoreSQL(e *engine.Engine) error {
+	sd, err := scope.SoftDeleteField(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	if sd == nil {
+		return errors.New("ngorm: can't restore records without soft delete column")
+	}
+	search.Unscoped(e, false)
+	search.OnlyTrashed(e, true)
+	value := scope.AddToVars(e, sd.SoftDelete.NotDeletedValue())
+	c, err := builder.CombinedCondition(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	e.Scope.SQL = fmt.Sprintf(
+		"UPDATE %v SET %v = %v%v",
+		scope.QuotedTableName(e, e.Scope.Value),
+		scope.Quote(e, sd.DBName),
+		value,
+		util.AddExtraSpaceIfExist(c),
+	)
+	if dialects.IsQL(e.Dialect) {
+		e.Scope.SQL = util.WrapTX(e.Scope.SQL)
+	}
+	return nil
+}
+
+// Restore restores soft deleted records. Like Delete, this refuses to run
+// without conditions.
+func Restore(e *engine.Engine) error {
+	if !scope.HasConditions(e, e.Scope.Value) {
+		return errors.New("Missing WHERE clause while restoring")
+	}
+	err := RestoreSQL(e)
+	if err != nil {
+		return err
+	}
+	err = UpdateExec(e)
+	if err != nil {
+		return err
+	}
+	if reflect.Indirect(e.Scope.ValueOf()).Kind() == reflect.Struct {
+		sd, err := scope.SoftDeleteField(e, e.Scope.Value)
+		if err != nil {
+			return err
+		}
+		if field, err := scope.FieldByName(e, e.Scope.Value, sd.DBName); err == nil {
+			return field.Set(sd.SoftDelete.NotDeletedValue())
+		}
+	}
+	return nil
+}
+
 // Preload executes preload conditions.
 func Preload(e *engine.Engine) error {
 	if e.Search.Preload == nil {
@@ -853,95 +1715,188 @@ func Preload(e *engine.Engine) error {
 	if err != nil {
 		return err
 	}
+	preloads, conditions, err := expandPreloads(e)
+	if err != nil {
+		return err
+	}
 
-	for _, preload := range e.Search.Preload {
-		var (
-			preloadFields = strings.Split(preload.Schema, ".")
-			cs            = e
-			currentFields = fields
-		)
+	for _, preload := range preloads {
+		err = preloadSchema(e, fields, preload.Schema, conditions, preloadedMap)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		for idx, preloadField := range preloadFields {
-			var conds []interface{}
+// preloadSchema preloads the associations of schema, which are separated by
+// dots, level by level. fields are the fields of the model of e.
+func preloadSchema(e *engine.Engine, fields []*model.Field, schema string,
+	conditions map[string][]interface{}, preloadedMap map[string]bool) error {
+	var (
+		preloadFields = strings.Split(schema, ".")
+		cs            = e
+		currentFields = fields
+		err           error
+	)
+	defer func() {
+		if cs != e {
+			engine.Put(cs)
+		}
+	}()
 
-			if cs == nil {
-				continue
-			}
+	for idx, preloadField := range preloadFields {
+		if cs == nil {
+			continue
+		}
+
+		// if not preloaded
+		if preloadKey := strings.Join(preloadFields[:idx+1], "."); !preloadedMap[preloadKey] {
 
-			// if not preloaded
-			if preloadKey := strings.Join(preloadFields[:idx+1], "."); !preloadedMap[preloadKey] {
+			// each level uses the conditions given for its schema
+			conds := conditions[preloadKey]
 
-				// assign search conditions to last preload
-				if idx == len(preloadFields)-1 {
-					conds = preload.Conditions
+			for _, field := range currentFields {
+				if field.Name != preloadField || field.Relationship == nil {
+					continue
 				}
 
-				for _, field := range currentFields {
-					if field.Name != preloadField || field.Relationship == nil {
-						continue
+				switch field.Relationship.Kind {
+				case "has_one":
+					err = PreloadHasOne(cs, field, conds)
+					if err != nil {
+						return err
 					}
-
-					switch field.Relationship.Kind {
-					case "has_one":
-						err = PreloadHasOne(cs, field, conds)
-						if err != nil {
-							return err
-						}
-					case "has_many":
-						err = PreloadHasMany(cs, field, conds)
-						if err != nil {
-							return err
-						}
-					case "belongs_to":
-						err = PreloadBelongsTo(cs, field, conds)
-						if err != nil {
-							return err
-						}
-					case "many_to_many":
-						err = PreloadManyToMany(cs, field, conds)
-						if err != nil {
-							return err
-						}
-					default:
-						return fmt.Errorf("hooks: can't preload %sunsupported relation",
-							field.Relationship.Kind)
+				case "has_many":
+					err = PreloadHasMany(cs, field, conds)
+					if err != nil {
+						return err
 					}
-					preloadedMap[preloadKey] = true
-					break
-				}
-
-				if !preloadedMap[preloadKey] {
-					m, err := scope.GetModelStruct(e, e.Scope.Value)
+				case "belongs_to":
+					err = PreloadBelongsTo(cs, field, conds)
+					if err != nil {
+						return err
+					}
+				case "many_to_many":
+					err = PreloadManyToMany(cs, field, conds)
 					if err != nil {
 						return err
 					}
-					return fmt.Errorf("can't preload field %s for %s",
-						preloadField, m.ModelType)
+				default:
+					return fmt.Errorf("hooks: can't preload %sunsupported relation",
+						field.Relationship.Kind)
 				}
+				preloadedMap[preloadKey] = true
+				break
 			}
 
-			// preload next level
-			if idx < len(preloadFields)-1 {
-				cs, err = ColumnAsScope(cs, preloadField)
-				if err != nil {
-					return err
-				}
-				currentFields, err = scope.Fields(cs, cs.Scope.Value)
+			if !preloadedMap[preloadKey] {
+				m, err := scope.GetModelStruct(e, e.Scope.Value)
 				if err != nil {
 					return err
 				}
+				return fmt.Errorf("can't preload field %s for %s",
+					preloadField, m.ModelType)
+			}
+		}
+
+		// preload next level
+		if idx < len(preloadFields)-1 {
+			next, err := ColumnAsScope(cs, preloadField)
+			if cs != e {
+				engine.Put(cs)
+			}
+			cs = next
+			if err != nil {
+				return err
+			}
+			if cs == nil {
+				break
+			}
+			currentFields, err = scope.Fields(cs, cs.Scope.Value)
+			if err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+// expandPreloads returns the preloads of e with the schemas ending with
+// model.Associations replaced by the associations of the model at that level.
+// It also returns the conditions for each schema, conditions given explicitly
+// for a schema take precedence over the ones of a wildcard.
+func expandPreloads(e *engine.Engine) ([]model.SearchPreload, map[string][]interface{}, error) {
+	var (
+		preloads   []model.SearchPreload
+		conditions = make(map[string][]interface{})
+		explicit   = make(map[string]bool)
+	)
+	for _, preload := range e.Search.Preload {
+		if preload.Schema != model.Associations &&
+			!strings.HasSuffix(preload.Schema, "."+model.Associations) {
+			preloads = append(preloads, preload)
+			conditions[preload.Schema] = preload.Conditions
+			explicit[preload.Schema] = true
+		}
+	}
+	for _, preload := range e.Search.Preload {
+		prefix := strings.TrimSuffix(preload.Schema, model.Associations)
+		if prefix == preload.Schema {
+			continue
+		}
+		m, err := scope.GetModelStruct(e, e.Scope.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, name := range strings.Split(strings.TrimSuffix(prefix, "."), ".") {
+			if name == "" {
+				break
+			}
+			var next *model.StructField
+			for _, f := range m.StructFields {
+				if f.Name == name && f.Relationship != nil {
+					next = f
+					break
+				}
+			}
+			if next == nil {
+				return nil, nil, fmt.Errorf("can't preload field %s for %s", name, m.ModelType)
+			}
+			typ := next.Struct.Type
+			for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			m, err = scope.GetModelStruct(e, reflect.New(typ).Interface())
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, f := range m.StructFields {
+			if f.Relationship == nil || f.IsIgnored {
+				continue
+			}
+			schema := prefix + f.Name
+			if explicit[schema] {
+				continue
+			}
+			preloads = append(preloads, model.SearchPreload{Schema: schema, Conditions: preload.Conditions})
+			conditions[schema] = preload.Conditions
+		}
+	}
+	return preloads, conditions, nil
+}
+
 // PreloadBelongsTo preloads belongs_to relationship
 func PreloadBelongsTo(e *engine.Engine, field *model.Field, conditions []interface{}) error {
 	relation := field.Relationship
+	if relation.IsPolymorphicBelongsTo() {
+		return PreloadPolymorphicBelongsTo(e, field, conditions)
+	}
 
 	// preload conditions
 	pdb, pCond := PreloadDBWithConditions(e, conditions)
+	defer engine.Put(pdb)
 
 	// get relations's primary keys
 	primaryKeys := util.ColumnAsArray(relation.ForeignFieldNames, e.Scope.Value)
@@ -998,6 +1953,71 @@ func PreloadBelongsTo(e *engine.Engine, field *model.Field, conditions []interfa
 	return nil
 }
 
+// PreloadPolymorphicBelongsTo preloads a polymorphic belongs_to
+// relationship. The records are grouped by the value of their type column and
+// the associated records of each type are loaded with a single query. The
+// interface field is set to a pointer to the associated record.
+func PreloadPolymorphicBelongsTo(e *engine.Engine, field *model.Field, conditions []interface{}) error {
+	var (
+		relation = field.Relationship
+		objects  []reflect.Value
+		groups   = make(map[string][]reflect.Value)
+		types    []string
+	)
+	iScopeVal := reflect.Indirect(reflect.ValueOf(e.Scope.Value))
+	if iScopeVal.Kind() == reflect.Slice {
+		for i := 0; i < iScopeVal.Len(); i++ {
+			objects = append(objects, reflect.Indirect(iScopeVal.Index(i)))
+		}
+	} else {
+		objects = append(objects, iScopeVal)
+	}
+	for _, object := range objects {
+		typ := util.ToString(object.FieldByName(relation.PolymorphicType).Interface())
+		if typ == "" {
+			continue
+		}
+		if _, ok := groups[typ]; !ok {
+			types = append(types, typ)
+		}
+		groups[typ] = append(groups[typ], object)
+	}
+
+	for _, typ := range types {
+		modelType, err := scope.PolymorphicModel(e, relation, typ)
+		if err != nil {
+			return err
+		}
+		var primaryKeys [][]interface{}
+		for _, object := range groups[typ] {
+			primaryKeys = append(primaryKeys, util.GetValueFromFields(object, relation.ForeignFieldNames))
+		}
+		pdb, pCond := PreloadDBWithConditions(e, conditions)
+		results := reflect.New(reflect.SliceOf(reflect.PtrTo(modelType)))
+		search.Where(pdb, fmt.Sprintf("%v IN (%v)",
+			scope.ToQueryCondition(e, relation.AssociationForeignDBNames),
+			util.ToQueryMarks(primaryKeys)), util.ToQueryValues(primaryKeys)...)
+		search.Inline(pdb, pCond...)
+		pdb.Scope.ContextValue(results.Interface())
+		err = Query(pdb)
+		engine.Put(pdb)
+		if err != nil {
+			return err
+		}
+		rVal := results.Elem()
+		for i := 0; i < rVal.Len(); i++ {
+			result := rVal.Index(i)
+			value := util.GetValueFromFields(result.Elem(), relation.AssociationForeignFieldNames)
+			for _, object := range groups[typ] {
+				if util.EqualAsString(util.GetValueFromFields(object, relation.ForeignFieldNames), value) {
+					object.FieldByName(field.Name).Set(result)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // PreloadManyToMany preloads many_to_many relation
 func PreloadManyToMany(e *engine.Engine, field *model.Field, conditions []interface{}) error {
 	var (
@@ -1022,19 +2042,30 @@ func PreloadManyToMany(e *engine.Engine, field *model.Field, conditions []interf
 
 	// preload conditions
 	preloadDB, preloadConditions := PreloadDBWithConditions(e, conditions)
+	defer engine.Put(preloadDB)
 
 	// generate query with join table
-	newScope := e.Clone()
-	defer engine.Put(newScope)
-	newScope.Scope.ContextValue(reflect.New(fieldType).Interface())
-	search.Table(newScope, scope.TableName(newScope, newScope.Scope.Value))
-	search.Select(newScope, "*")
-
-	preloadDB, err := JoinWith(preloadDB, joinTableHandler, joinTableHandler, e.Scope.Value)
+	var err error
+	if dialects.IsQL(e.Dialect) {
+		err = scope.JoinWithQL(joinTableHandler, preloadDB, e.Scope.Value)
+	} else {
+		err = scope.JoinWith(joinTableHandler, preloadDB, e.Scope.Value)
+	}
 	if err != nil {
 		return err
 	}
 
+	// joining sets the source as the scope value, the destination table is
+	// queried along with the foreign keys of the source in the join table.
+	preloadDB.Scope.ContextValue(reflect.New(fieldType).Interface())
+	selects := []string{scope.QualifiedColumns(preloadDB, preloadDB.Scope.Value)}
+	for _, key := range sourceKeys {
+		selects = append(selects, fmt.Sprintf("%v.%v AS %v",
+			scope.Quote(preloadDB, joinTableHandler.TableName),
+			scope.Quote(preloadDB, key), scope.Quote(preloadDB, key)))
+	}
+	search.Select(preloadDB, strings.Join(selects, ", "))
+
 	// preload inline conditions
 	if len(preloadConditions) > 0 {
 		search.Where(preloadDB, preloadConditions[0], preloadConditions[1:]...)
@@ -1045,7 +2076,7 @@ func PreloadManyToMany(e *engine.Engine, field *model.Field, conditions []interf
 		return err
 	}
 
-	rows, err := preloadDB.SQLDB.Query(preloadDB.Scope.SQL, preloadDB.Scope.SQLVars...)
+	rows, err := scope.Reader(preloadDB).Query(preloadDB.Scope.SQL, preloadDB.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
@@ -1235,12 +2266,22 @@ func ColumnAsScope(e *engine.Engine, column string) (*engine.Engine, error) {
 				}
 			}
 			ne := e.Clone()
+			search.Scoping(ne, e)
 			ne.Scope.ContextValue(results.Interface())
 			return ne, nil
 		}
 	case reflect.Struct:
-		if field := iv.FieldByName(column); field.CanAddr() {
+		field := iv.FieldByName(column)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				// there is nothing to preload at the next level.
+				return nil, nil
+			}
+			field = field.Elem()
+		}
+		if field.CanAddr() {
 			ne := e.Clone()
+			search.Scoping(ne, e)
 			ne.Scope.ContextValue(field.Addr().Interface())
 			return ne, nil
 		}
@@ -1260,6 +2301,7 @@ func PreloadHasOne(e *engine.Engine, field *model.Field, conditions []interface{
 
 	// preload conditions
 	pdb, pCond := PreloadDBWithConditions(e, conditions)
+	defer engine.Put(pdb)
 
 	// find relations
 	query := fmt.Sprintf("%v IN (%v)",
@@ -1330,6 +2372,7 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 
 	// preload conditions
 	pdb, pCond := PreloadDBWithConditions(e, conditions)
+	defer engine.Put(pdb)
 
 	// find relations
 	query := fmt.Sprintf("%v IN (%v)",
@@ -1347,7 +2390,19 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 	search.Inline(pdb, pCond...)
 	pdb.Scope.ContextValue(results)
 
-	err := Query(pdb)
+	var err error
+	limit := pdb.Search.LimitPerParent
+	switch {
+	case limit > 0 && dialects.SupportsWindowFunctions(pdb.Dialect):
+		err = queryPerParent(pdb, rel, limit)
+	case limit > 0:
+		// without window functions all the records are fetched, the ones
+		// above the limit are discarded below.
+		pdb.Search.Limit = nil
+		err = Query(pdb)
+	default:
+		err = Query(pdb)
+	}
 	if err != nil {
 		return err
 	}
@@ -1357,6 +2412,9 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 	if rVal.Kind() == reflect.Ptr {
 		rVal = rVal.Elem()
 	}
+	if limit > 0 {
+		rVal.Set(limitPerParent(rVal, rel.ForeignFieldNames, limit))
+	}
 	iScopeVal := reflect.ValueOf(e.Scope.Value)
 	if iScopeVal.Kind() == reflect.Ptr {
 		iScopeVal = iScopeVal.Elem()
@@ -1392,14 +2450,98 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 	return nil
 }
 
-// PreloadDBWithConditions returns engine with preload conditions set
+// rowNumberColumn is the column holding the row number of each record within
+// its parent when limiting preloads per parent.
+const rowNumberColumn = "ngorm_row_number"
+
+// queryPerParent queries the records of the has_many relationship rel in e,
+// keeping at most limit records for each parent, see PreloadPerParentSQL.
+func queryPerParent(e *engine.Engine, rel *model.Relationship, limit int) error {
+	err := PreloadPerParentSQL(e, rel, limit)
+	if err != nil {
+		return err
+	}
+	err = QueryExec(e)
+	if err != nil {
+		return err
+	}
+	return AfterQuery(e)
+}
+
+//PreloadPerParentSQL generates the SQL querying the records of the has_many
+//relationship rel in e, keeping at most limit records for each parent. The
+//records are numbered within each parent with ROW_NUMBER() in the order of the
+//search.
+func PreloadPerParentSQL(e *engine.Engine, rel *model.Relationship, limit int) error {
+	table := scope.QuotedTableName(e, e.Scope.Value)
+	var partition []string
+	for _, fk := range rel.ForeignDBNames {
+		partition = append(partition, table+"."+scope.Quote(e, fk))
+	}
+	order := strings.TrimPrefix(builder.OrderSQL(e, e.Scope.Value), " ORDER BY ")
+	if order == "" {
+		pk, err := scope.PrimaryKey(e, e.Scope.Value)
+		if err != nil {
+			return err
+		}
+		order = table + "." + scope.Quote(e, pk)
+	}
+	search.Order(e, nil, true)
+	search.Limit(e, nil)
+	search.Select(e, fmt.Sprintf("%v.*, ROW_NUMBER() OVER (PARTITION BY %v ORDER BY %v) AS %v",
+		table, strings.Join(partition, ", "), order, rowNumberColumn))
+	err := builder.PrepareQuery(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	var outer []string
+	for _, fk := range rel.ForeignDBNames {
+		outer = append(outer, scope.Quote(e, fk))
+	}
+	e.Scope.SQL = fmt.Sprintf("SELECT * FROM (%v) AS %v WHERE %v <= %d ORDER BY %v, %v",
+		e.Scope.SQL, table, rowNumberColumn, limit, strings.Join(outer, ", "), rowNumberColumn)
+	return nil
+}
+
+// limitPerParent returns the records in the slice v keeping at most limit
+// records with the same values for the foreignKeys fields.
+func limitPerParent(v reflect.Value, foreignKeys []string, limit int) reflect.Value {
+	counts := make(map[string]int)
+	kept := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		key := util.ToString(util.GetValueFromFields(v.Index(i), foreignKeys))
+		if counts[key] < limit {
+			kept = reflect.Append(kept, v.Index(i))
+		}
+		counts[key]++
+	}
+	return kept
+}
+
+//PreloadFunc is a preload condition which modifies the search of the preload
+//query, for instance to order or limit the preloaded records.
+type PreloadFunc func(*engine.Engine)
+
+// PreloadDBWithConditions returns engine with preload conditions set. The
+// PreloadFunc conditions are applied to the returned engine, and the rest are
+// returned as inline conditions. The engine must be put back with engine.Put.
 func PreloadDBWithConditions(e *engine.Engine, conditions []interface{}) (*engine.Engine, []interface{}) {
 	var (
 		preloadDB         = e.Clone()
 		preloadConditions []interface{}
 	)
+	search.Scoping(preloadDB, e)
+	if model.IsUsePrimary(e.Search.Clauses) {
+		// the preloads of a query reading from the primary database read
+		// from it too.
+		search.Clauses(preloadDB, model.UsePrimary)
+	}
 
 	for _, condition := range conditions {
+		if fn, ok := condition.(PreloadFunc); ok {
+			fn(preloadDB)
+			continue
+		}
 		preloadConditions = append(preloadConditions, condition)
 	}
 	return preloadDB, preloadConditions
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"database/sql"
+)
+
+//ColumnScanner is implemented by models with a scanner generated by
+//ngorm-gen. Query results are scanned through it instead of reflecting over
+//the fields of the model for every row.
+//
+// The scanner is only used when it maps exactly the columns that the model
+// maps to normal fields, otherwise the query falls back to reflection.
+type ColumnScanner interface {
+	// NGORMScan returns the destination of each of columns, in order, to be
+	// passed to (*sql.Rows).Scan. The destination of a column which isn't
+	// mapped to a field is nil.
+	NGORMScan(columns []string) []interface{}
+}
+
+//FieldValuer is implemented by models with field extractors generated by
+//ngorm-gen. The values of the fields are read through it instead of looking
+//the fields up by name, for instance when matching preloaded records with
+//their owners.
+type FieldValuer interface {
+	// NGORMValue returns the value of the field name. It returns false when
+	// the model has no such field.
+	NGORMValue(name string) (interface{}, bool)
+}
+
+//ScanField returns a destination scanning a column into field. A NULL column
+//leaves the field untouched, like it does for fields scanned with reflection.
+//
+// It is used by the scanners generated by ngorm-gen for fields which are not
+// pointers.
+func ScanField[T any](field *T) sql.Scanner {
+	return scanField[T]{field: field}
+}
+
+type scanField[T any] struct {
+	field *T
+}
+
+func (s scanField[T]) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	var v sql.Null[T]
+	if err := v.Scan(src); err != nil {
+		return err
+	}
+	*s.field = v.V
+	return nil
+}
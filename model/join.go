@@ -0,0 +1,53 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//JoinModels holds the models used as join tables of many_to_many
+//relationships, by the name relationships refer to them with in the many2many
+//tag.
+type JoinModels struct {
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+}
+
+//NewJoinModels returns an empty set of join models.
+func NewJoinModels() *JoinModels {
+	return &JoinModels{types: make(map[string]reflect.Type)}
+}
+
+//Register adds the models of values, which are named by their type name. It
+//returns an error when a different model is already registered with the same
+//name.
+func (j *JoinModels) Register(values ...interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, v := range values {
+		typ := reflect.TypeOf(v)
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return fmt.Errorf("join model %s is not a struct", typ)
+		}
+		if old, ok := j.types[typ.Name()]; ok && old != typ {
+			return fmt.Errorf("join model %s is already registered as %s", typ.Name(), old.PkgPath())
+		}
+		j.types[typ.Name()] = typ
+	}
+	return nil
+}
+
+//Get returns the type of the join model registered with name.
+func (j *JoinModels) Get(name string) (reflect.Type, bool) {
+	if j == nil {
+		return nil, false
+	}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	typ, ok := j.types[name]
+	return typ, ok
+}
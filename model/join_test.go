@@ -0,0 +1,36 @@
+package model
+
+import "testing"
+
+type userLanguage struct {
+	UserID     int64
+	LanguageID int64
+}
+
+func TestJoinModels(t *testing.T) {
+	j := NewJoinModels()
+	if _, ok := j.Get("userLanguage"); ok {
+		t.Error("expected no join model")
+	}
+	err := j.Register(&userLanguage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, ok := j.Get("userLanguage")
+	if !ok || typ.Name() != "userLanguage" {
+		t.Errorf("expected userLanguage got %v", typ)
+	}
+	err = j.Register(userLanguage{})
+	if err != nil {
+		t.Errorf("expected registering the same model again to succeed got %v", err)
+	}
+
+	// a type of the same name from another package.
+	type userLanguage struct {
+		UserID int64
+	}
+	err = j.Register(&userLanguage{})
+	if err == nil {
+		t.Error("expected an error registering another model with the same name")
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"reflect"
+	"sync"
+)
+
+var polymorphicModels = struct {
+	sync.RWMutex
+	types []reflect.Type
+}{}
+
+//RegisterPolymorphicModel registers models that can be the target of a
+//polymorphic belongs_to relationship. The relationship is declared with an
+//interface field tagged polymorphic, the type of the associated record is
+//stored in the <polymorphic>Type field and its primary key in the
+//<polymorphic>ID field.
+//
+//	type Comment struct {
+//		ID              int64
+//		Body            string
+//		CommentableID   int64
+//		CommentableType string
+//		Commentable     interface{} `gorm:"polymorphic:Commentable"`
+//	}
+//
+// The type is matched with the table name of the registered models, or the
+// polymorphic_value of their polymorphic has_one and has_many relationships.
+func RegisterPolymorphicModel(values ...interface{}) {
+	polymorphicModels.Lock()
+	defer polymorphicModels.Unlock()
+	for _, v := range values {
+		typ := reflect.TypeOf(v)
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		registered := false
+		for _, t := range polymorphicModels.types {
+			if t == typ {
+				registered = true
+				break
+			}
+		}
+		if !registered {
+			polymorphicModels.types = append(polymorphicModels.types, typ)
+		}
+	}
+}
+
+//PolymorphicModels returns the types of the models registered with
+//RegisterPolymorphicModel.
+func PolymorphicModels() []reflect.Type {
+	polymorphicModels.RLock()
+	defer polymorphicModels.RUnlock()
+	return append([]reflect.Type{}, polymorphicModels.types...)
+}
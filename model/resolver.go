@@ -0,0 +1,137 @@
+package model
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+//UsePrimary is a clause which runs a query on the primary database even when
+//its table has replicas. It is used to read rows right after they are written,
+//before the replicas have caught up.
+//
+//	db.Clauses(model.UsePrimary).First(&user, id)
+var UsePrimary = usePrimary{}
+
+type usePrimary struct{}
+
+//Policy chooses the replica a query is run on.
+type Policy interface {
+	Pick(replicas []SQLCommon) SQLCommon
+}
+
+//PolicyFunc is a function implementing Policy.
+type PolicyFunc func(replicas []SQLCommon) SQLCommon
+
+//Pick calls f.
+func (f PolicyFunc) Pick(replicas []SQLCommon) SQLCommon {
+	return f(replicas)
+}
+
+//RoundRobin returns a policy which uses the replicas in turn.
+func RoundRobin() Policy {
+	var n uint64
+	return PolicyFunc(func(replicas []SQLCommon) SQLCommon {
+		i := atomic.AddUint64(&n, 1) - 1
+		return replicas[i%uint64(len(replicas))]
+	})
+}
+
+//Random returns a policy which picks a replica at random.
+func Random() Policy {
+	return PolicyFunc(func(replicas []SQLCommon) SQLCommon {
+		return replicas[rand.Intn(len(replicas))]
+	})
+}
+
+//Replicas are the databases which read queries are routed to.
+type Replicas struct {
+	DBs []SQLCommon
+
+	// Policy chooses the replica of a query. It defaults to RoundRobin.
+	Policy Policy
+}
+
+//Resolver routes the read queries of tables to their replicas. Writes,
+//transactions and queries locking rows are always run on the primary
+//database.
+type Resolver struct {
+	mu     sync.RWMutex
+	def    *Replicas
+	tables map[string]*Replicas
+}
+
+//NewResolver returns a resolver without replicas, all the queries are run on
+//the primary database.
+func NewResolver() *Resolver {
+	return &Resolver{tables: make(map[string]*Replicas)}
+}
+
+//Register routes the read queries of tables to replicas. Without tables the
+//replicas are used for the tables which have no replicas of their own.
+//Registering replicas without databases removes them.
+func (r *Resolver) Register(replicas Replicas, tables ...string) {
+	rs := &replicas
+	if len(replicas.DBs) == 0 {
+		rs = nil
+	} else if replicas.Policy == nil {
+		rs.Policy = RoundRobin()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(tables) == 0 {
+		r.def = rs
+		return
+	}
+	for _, table := range tables {
+		if rs == nil {
+			delete(r.tables, table)
+			continue
+		}
+		r.tables[table] = rs
+	}
+}
+
+//Replica returns the replica to run a read query on table. It returns false
+//when the table has no replicas.
+func (r *Resolver) Replica(table string) (SQLCommon, bool) {
+	r.mu.RLock()
+	rs, ok := r.tables[table]
+	if !ok {
+		rs = r.def
+	}
+	r.mu.RUnlock()
+	if rs == nil {
+		return nil, false
+	}
+	return rs.Policy.Pick(rs.DBs), true
+}
+
+//DBs returns the databases of all the registered replicas.
+func (r *Resolver) DBs() []SQLCommon {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var dbs []SQLCommon
+	seen := make(map[*Replicas]bool)
+	add := func(rs *Replicas) {
+		if rs != nil && !seen[rs] {
+			seen[rs] = true
+			dbs = append(dbs, rs.DBs...)
+		}
+	}
+	add(r.def)
+	for _, rs := range r.tables {
+		add(rs)
+	}
+	return dbs
+}
+
+//IsUsePrimary returns true if clauses has the UsePrimary clause.
+func IsUsePrimary(clauses []interface{}) bool {
+	for _, c := range clauses {
+		if _, ok := c.(usePrimary); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	r1, r2, r3 := &sql.DB{}, &sql.DB{}, &sql.DB{}
+	r := NewResolver()
+	if _, ok := r.Replica("users"); ok {
+		t.Error("expected no replicas")
+	}
+	r.Register(Replicas{DBs: []SQLCommon{r1, r2}})
+	r.Register(Replicas{DBs: []SQLCommon{r3}}, "orders")
+	for _, v := range []struct {
+		table string
+		db    SQLCommon
+	}{
+		{"users", r1}, {"users", r2}, {"orders", r3}, {"users", r1},
+	} {
+		db, ok := r.Replica(v.table)
+		if !ok || db != v.db {
+			t.Errorf("%s: expected %p got %p", v.table, v.db, db)
+		}
+	}
+	r.Register(Replicas{}, "orders")
+	if db, _ := r.Replica("orders"); db != r2 {
+		t.Errorf("expected the default replicas to be used got %p", db)
+	}
+	r.Register(Replicas{})
+	if _, ok := r.Replica("users"); ok {
+		t.Error("expected the replicas to be removed")
+	}
+
+	r.Register(Replicas{DBs: []SQLCommon{r1, r2}, Policy: Random()})
+	seen := make(map[SQLCommon]bool)
+	for i := 0; i < 100; i++ {
+		db, _ := r.Replica("users")
+		seen[db] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected both replicas to be picked got %d", len(seen))
+	}
+}
+
+func TestIsUsePrimary(t *testing.T) {
+	if IsUsePrimary([]interface{}{Locking{Strength: "UPDATE"}}) {
+		t.Error("expected false")
+	}
+	if !IsUsePrimary([]interface{}{Locking{Strength: "UPDATE"}, UsePrimary}) {
+		t.Error("expected true")
+	}
+}
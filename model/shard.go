@@ -0,0 +1,164 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+)
+
+//ShardConfig splits a table into shards. The shard of a record is chosen by
+//the value of its shard key, a shard is either a table with a suffix, like
+//orders_07, a database, or both.
+type ShardConfig struct {
+	// ShardKey is the column whose value picks the shard.
+	ShardKey string
+
+	// Shards is the number of shards.
+	Shards int
+
+	// ShardFunc returns the shard of a shard key value, between 0 and
+	// Shards-1. It defaults to the value modulo Shards for integers and to a
+	// hash of the value for strings.
+	ShardFunc func(key interface{}) (int, error)
+
+	// Suffix returns the suffix of the table of a shard. It defaults to _00,
+	// _01 and so on, unless DBs is set in which case the tables are not
+	// suffixed.
+	Suffix func(shard int) string
+
+	// DBs when set is the database of each shard.
+	DBs []SQLCommon
+
+	// Fallback when set is the table, unsharded and in the main database, of
+	// the records without a shard key. The writes without a shard key go to
+	// it instead of failing, and the queries without one read it along with
+	// the shards.
+	Fallback string
+}
+
+//Shard is the table, and database, a query on a sharded table is run on.
+type Shard struct {
+	// Index is the number of the shard, -1 for the fallback table.
+	Index int
+	Table string
+
+	// DB is the database of the shard, nil when the shards are tables of
+	// the same database.
+	DB SQLCommon
+}
+
+//Shard returns the shard of table for the shard key value key.
+func (c *ShardConfig) Shard(table string, key interface{}) (Shard, error) {
+	i, err := c.ShardFunc(key)
+	if err != nil {
+		return Shard{}, err
+	}
+	if i < 0 || i >= c.Shards {
+		return Shard{}, fmt.Errorf("ngorm: shard %d of %s out of range", i, table)
+	}
+	return c.shard(table, i), nil
+}
+
+//All returns all the shards of table, followed by the fallback table if there
+//is one.
+func (c *ShardConfig) All(table string) []Shard {
+	shards := make([]Shard, c.Shards)
+	for i := range shards {
+		shards[i] = c.shard(table, i)
+	}
+	if f, ok := c.FallbackShard(); ok {
+		shards = append(shards, f)
+	}
+	return shards
+}
+
+//FallbackShard returns the shard of the fallback table, false when there is
+//none.
+func (c *ShardConfig) FallbackShard() (Shard, bool) {
+	if c.Fallback == "" {
+		return Shard{}, false
+	}
+	return Shard{Index: -1, Table: c.Fallback}, true
+}
+
+func (c *ShardConfig) shard(table string, i int) Shard {
+	s := Shard{Index: i, Table: table}
+	if c.Suffix != nil {
+		s.Table += c.Suffix(i)
+	}
+	if c.DBs != nil {
+		s.DB = c.DBs[i]
+	}
+	return s
+}
+
+// shardFunc returns the default ShardFunc of n shards.
+func shardFunc(n int) func(interface{}) (int, error) {
+	return func(key interface{}) (int, error) {
+		v := reflect.Indirect(reflect.ValueOf(key))
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i := v.Int() % int64(n)
+			if i < 0 {
+				i = -i
+			}
+			return int(i), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int(v.Uint() % uint64(n)), nil
+		case reflect.String:
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(v.String()))
+			return int(h.Sum32() % uint32(n)), nil
+		}
+		return 0, fmt.Errorf("ngorm: can't shard by a value of type %T", key)
+	}
+}
+
+//Sharding holds the shard configuration of the sharded tables. The tables
+//which aren't sharded are left untouched.
+type Sharding struct {
+	mu     sync.RWMutex
+	tables map[string]*ShardConfig
+}
+
+//NewSharding returns a Sharding without sharded tables.
+func NewSharding() *Sharding {
+	return &Sharding{tables: make(map[string]*ShardConfig)}
+}
+
+//Register shards tables with c.
+func (s *Sharding) Register(c ShardConfig, tables ...string) error {
+	if c.ShardKey == "" {
+		return errors.New("ngorm: missing shard key")
+	}
+	if c.Shards <= 0 {
+		return errors.New("ngorm: the number of shards must be positive")
+	}
+	if c.DBs != nil && len(c.DBs) != c.Shards {
+		return fmt.Errorf("ngorm: expected %d shard databases got %d", c.Shards, len(c.DBs))
+	}
+	if c.ShardFunc == nil {
+		c.ShardFunc = shardFunc(c.Shards)
+	}
+	if c.Suffix == nil && c.DBs == nil {
+		c.Suffix = func(shard int) string {
+			return fmt.Sprintf("_%02d", shard)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, table := range tables {
+		s.tables[table] = &c
+	}
+	return nil
+}
+
+//Config returns the shard configuration of table.
+func (s *Sharding) Config(table string) (*ShardConfig, bool) {
+	s.mu.RLock()
+	c, ok := s.tables[table]
+	s.mu.RUnlock()
+	return c, ok
+}
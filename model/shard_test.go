@@ -0,0 +1,84 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSharding(t *testing.T) {
+	s := NewSharding()
+	err := s.Register(ShardConfig{Shards: 2}, "orders")
+	if err == nil {
+		t.Error("expected an error for a missing shard key")
+	}
+	err = s.Register(ShardConfig{ShardKey: "user_id", Shards: 2, DBs: []SQLCommon{&sql.DB{}}}, "orders")
+	if err == nil {
+		t.Error("expected an error for a missing shard database")
+	}
+	err = s.Register(ShardConfig{ShardKey: "user_id", Shards: 4}, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Config("users"); ok {
+		t.Error("expected users not to be sharded")
+	}
+	c, ok := s.Config("orders")
+	if !ok {
+		t.Fatal("expected orders to be sharded")
+	}
+	for _, v := range []struct {
+		key   interface{}
+		table string
+	}{
+		{7, "orders_03"}, {int64(-6), "orders_02"}, {uint8(4), "orders_00"},
+	} {
+		shard, err := c.Shard("orders", v.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shard.Table != v.table || shard.DB != nil {
+			t.Errorf("%v: expected %s got %#v", v.key, v.table, shard)
+		}
+	}
+	a, err := c.Shard("orders", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := c.Shard("orders", "alice")
+	if a != b {
+		t.Errorf("expected the same shard got %v and %v", a, b)
+	}
+	_, err = c.Shard("orders", 1.5)
+	if err == nil {
+		t.Error("expected an error for a float shard key")
+	}
+	if all := c.All("orders"); len(all) != 4 || all[1].Table != "orders_01" {
+		t.Errorf("unexpected shards %v", all)
+	}
+	if _, ok := c.FallbackShard(); ok {
+		t.Error("expected no fallback table")
+	}
+	err = s.Register(ShardConfig{ShardKey: "user_id", Shards: 2, Fallback: "orders"}, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = s.Config("orders")
+	all := c.All("orders")
+	if len(all) != 3 || all[2].Table != "orders" || all[2].Index != -1 {
+		t.Errorf("expected the fallback table last got %v", all)
+	}
+
+	dbs := []SQLCommon{&sql.DB{}, &sql.DB{}}
+	err = s.Register(ShardConfig{ShardKey: "user_id", Shards: 2, DBs: dbs}, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = s.Config("users")
+	shard, err := c.Shard("users", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shard.Table != "users" || shard.DB != dbs[1] {
+		t.Errorf("expected the second database got %#v", shard)
+	}
+}
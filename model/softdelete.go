@@ -0,0 +1,137 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+//SoftDeleter defines how a column marks records as deleted. Deleting a model
+//with a soft delete column sets the column to DeletedValue instead of removing
+//the record, and queries only return records matching NotDeletedCondition.
+//
+// A field declares its strategy with the soft_delete tag
+//
+//	IsDeleted bool `gorm:"soft_delete:flag"`
+//
+// or by having a type which implements this interface. Fields named DeletedAt
+// use the timestamp strategy by default.
+type SoftDeleter interface {
+	// DeletedCondition returns the SQL condition on column matching deleted
+	// records.
+	DeletedCondition(column string) string
+
+	// NotDeletedCondition returns the SQL condition on column matching
+	// records which are not deleted.
+	NotDeletedCondition(column string) string
+
+	// DeletedValue returns the value of the column for a record deleted at
+	// now.
+	DeletedValue(now time.Time) interface{}
+
+	// NotDeletedValue returns the value of the column for records which are
+	// not deleted.
+	NotDeletedValue() interface{}
+}
+
+var softDeleteStrategies = struct {
+	mu         sync.RWMutex
+	strategies map[string]SoftDeleter
+}{strategies: map[string]SoftDeleter{
+	"timestamp": TimestampSoftDelete{},
+	"flag":      DeletedFlag(false),
+	"unix":      DeletedUnix(0),
+}}
+
+//RegisterSoftDeleteStrategy makes s selectable with the soft_delete tag under
+//name. Models are built once, so strategies should be registered before the
+//models using them are.
+//
+//	model.RegisterSoftDeleteStrategy("archived", Archived(""))
+func RegisterSoftDeleteStrategy(name string, s SoftDeleter) {
+	softDeleteStrategies.mu.Lock()
+	softDeleteStrategies.strategies[name] = s
+	softDeleteStrategies.mu.Unlock()
+}
+
+//SoftDeleteStrategy returns the strategy registered with name.
+func SoftDeleteStrategy(name string) (SoftDeleter, error) {
+	softDeleteStrategies.mu.RLock()
+	s, ok := softDeleteStrategies.strategies[name]
+	softDeleteStrategies.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("ngorm: unknown soft delete strategy %s", name)
+}
+
+//TimestampSoftDelete marks deleted records by setting a nullable timestamp to
+//the time of deletion.
+type TimestampSoftDelete struct{}
+
+//DeletedCondition implements SoftDeleter.
+func (TimestampSoftDelete) DeletedCondition(column string) string {
+	return column + " IS NOT NULL"
+}
+
+//NotDeletedCondition implements SoftDeleter.
+func (TimestampSoftDelete) NotDeletedCondition(column string) string {
+	return column + " IS NULL"
+}
+
+//DeletedValue implements SoftDeleter.
+func (TimestampSoftDelete) DeletedValue(now time.Time) interface{} {
+	return now
+}
+
+//NotDeletedValue implements SoftDeleter.
+func (TimestampSoftDelete) NotDeletedValue() interface{} {
+	return nil
+}
+
+//DeletedFlag is a boolean soft delete column, it is true for deleted records.
+type DeletedFlag bool
+
+//DeletedCondition implements SoftDeleter.
+func (DeletedFlag) DeletedCondition(column string) string {
+	return column + " = true"
+}
+
+//NotDeletedCondition implements SoftDeleter.
+func (DeletedFlag) NotDeletedCondition(column string) string {
+	return column + " = false"
+}
+
+//DeletedValue implements SoftDeleter.
+func (DeletedFlag) DeletedValue(time.Time) interface{} {
+	return true
+}
+
+//NotDeletedValue implements SoftDeleter.
+func (DeletedFlag) NotDeletedValue() interface{} {
+	return false
+}
+
+//DeletedUnix is a soft delete column holding the unix time of deletion in
+//seconds. Records which are not deleted have the value 0.
+type DeletedUnix int64
+
+//DeletedCondition implements SoftDeleter.
+func (DeletedUnix) DeletedCondition(column string) string {
+	return column + " != 0"
+}
+
+//NotDeletedCondition implements SoftDeleter.
+func (DeletedUnix) NotDeletedCondition(column string) string {
+	return column + " = 0"
+}
+
+//DeletedValue implements SoftDeleter.
+func (DeletedUnix) DeletedValue(now time.Time) interface{} {
+	return now.Unix()
+}
+
+//NotDeletedValue implements SoftDeleter.
+func (DeletedUnix) NotDeletedValue() interface{} {
+	return int64(0)
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+)
+
+//StmtCache is a least recently used cache of prepared statements keyed by
+//their SQL. A statement evicted from the cache is closed once the queries
+//using it are done.
+type StmtCache struct {
+	db     SQLCommon
+	size   int
+	mu     sync.Mutex
+	ll     *list.List
+	stmts  map[string]*list.Element
+	closed bool
+}
+
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+//NewStmtCache returns a cache of up to size statements prepared on db.
+func NewStmtCache(db SQLCommon, size int) *StmtCache {
+	return &StmtCache{
+		db:    db,
+		size:  size,
+		ll:    list.New(),
+		stmts: make(map[string]*list.Element),
+	}
+}
+
+//Get returns the statement prepared for query, preparing it when it is not
+//cached. release must be called when the statement is no longer used. The
+//statement must not be closed by the caller.
+func (c *StmtCache) Get(query string) (stmt *sql.Stmt, release func(), err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, nil, sql.ErrConnDone
+	}
+	if el, ok := c.stmts[query]; ok {
+		c.ll.MoveToFront(el)
+		defer c.mu.Unlock()
+		return c.acquire(el.Value.(*cachedStmt))
+	}
+	c.mu.Unlock()
+
+	// the statement is prepared without holding the lock, so a slow prepare
+	// doesn't hold up the queries using cached statements.
+	s, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		_ = s.Close()
+		return nil, nil, sql.ErrConnDone
+	}
+	if el, ok := c.stmts[query]; ok {
+		// prepared concurrently by another query.
+		_ = s.Close()
+		c.ll.MoveToFront(el)
+		return c.acquire(el.Value.(*cachedStmt))
+	}
+	cs := &cachedStmt{query: query, stmt: s}
+	c.stmts[query] = c.ll.PushFront(cs)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		old := el.Value.(*cachedStmt)
+		delete(c.stmts, old.query)
+		old.evicted = true
+		if old.refs == 0 {
+			_ = old.stmt.Close()
+		}
+	}
+	return c.acquire(cs)
+}
+
+// acquire returns the statement of cs, c.mu must be held.
+func (c *StmtCache) acquire(cs *cachedStmt) (*sql.Stmt, func(), error) {
+	cs.refs++
+	var once sync.Once
+	return cs.stmt, func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			cs.refs--
+			if cs.evicted && cs.refs == 0 {
+				_ = cs.stmt.Close()
+			}
+		})
+	}, nil
+}
+
+//Len returns the number of cached statements.
+func (c *StmtCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+//Close closes the cached statements. Statements still in use are closed when
+//they are released. The cache can't be used after it is closed.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		cs := el.Value.(*cachedStmt)
+		cs.evicted = true
+		if cs.refs == 0 {
+			if cerr := cs.stmt.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	c.ll.Init()
+	c.stmts = make(map[string]*list.Element)
+	c.closed = true
+	return err
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/cznic/ql/driver"
+)
+
+func TestStmtCache(t *testing.T) {
+	db, err := sql.Open("ql-mem", "stmt.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("CREATE TABLE stmts (n int64);")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewStmtCache(db, 2)
+
+	one, releaseOne, err := c.Get("SELECT 1 FROM stmts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, releaseAgain, err := c.Get("SELECT 1 FROM stmts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != one {
+		t.Error("expected the cached statement")
+	}
+	releaseAgain()
+	two, releaseTwo, err := c.Get("SELECT 2 FROM stmts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseTwo()
+	_, releaseThree, err := c.Get("SELECT 3 FROM stmts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseThree()
+	if c.Len() != 2 {
+		t.Errorf("expected %d got %d", 2, c.Len())
+	}
+
+	// one is evicted but still in use.
+	rows, err := one.Query()
+	if err != nil {
+		t.Fatalf("expected the evicted statement to be usable until released: %v", err)
+	}
+	_ = rows.Close()
+	releaseOne()
+	releaseOne()
+	if _, err = one.Query(); err == nil {
+		t.Error("expected the released statement to be closed")
+	}
+
+	err = c.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = two.Query(); err == nil {
+		t.Error("expected the statement to be closed")
+	}
+	if _, _, err = c.Get("SELECT 1 FROM stmts"); err == nil {
+		t.Error("expected an error")
+	}
+}
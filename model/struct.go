@@ -11,6 +11,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/util"
 )
 
 // All important keys
@@ -61,6 +64,9 @@ const (
 	Preload                 = "ngorm:preload"
 	HookSaveAfterAss        = "ngorm:save_after_association"
 	AssociationSource       = "ngorm:association:source"
+	UpdateVersion           = "ngorm:update_version"
+	JoinValue               = "ngorm:join_value"
+	Sharded                 = "ngorm:sharded"
 )
 
 //Model defines common fields that are used for defining SQL Tables. This is a
@@ -88,12 +94,38 @@ type Model struct {
 	DeletedAt *time.Time `sql:"index" json:"deleted_at"`
 }
 
+//Version is a version number used for optimistic locking. A model can either
+//embed it or have a field of this type.
+//
+//  type Article struct {
+//    ID    int64
+//    Title string
+//    model.Version
+//  }
+//
+// Alternatively any integer field can be tagged with `gorm:"version"`.
+//
+// The version is set to 1 when the record is created. Updates are only applied
+// when the version in the database matches the one in the model, and the
+// version is incremented after each update. When the versions don't match the
+// update fails with errmsg.ErrStaleObject. The version of records from before
+// the column was added is 0, it is checked like any other. Updates of a model
+// without primary key, which update all the matching records, increment the
+// version without checking it, and UpdateColumn and UpdateColumns neither
+// check nor increment it.
+type Version int64
+
 //Struct model definition
 type Struct struct {
 	PrimaryFields    []*StructField
 	StructFields     []*StructField
 	ModelType        reflect.Type
 	DefaultTableName string
+
+	// RelationshipErrors are the errors building the relationships of the
+	// model. The fields of the invalid relationships are left without a
+	// Relationship.
+	RelationshipErrors []error
 }
 
 // StructField model field's struct definition
@@ -113,6 +145,8 @@ type StructField struct {
 	TagSettings     map[string]string
 	Struct          reflect.StructField
 	IsForeignKey    bool
+	IsVersion       bool
+	SoftDelete      SoftDeleter
 	Relationship    *Relationship
 }
 
@@ -131,6 +165,8 @@ func (s *StructField) Clone() *StructField {
 		TagSettings:     map[string]string{},
 		Struct:          s.Struct,
 		IsForeignKey:    s.IsForeignKey,
+		IsVersion:       s.IsVersion,
+		SoftDelete:      s.SoftDelete,
 		Relationship:    s.Relationship,
 	}
 
@@ -154,6 +190,12 @@ type Relationship struct {
 	JoinTableHandler             *JoinTableHandler
 }
 
+//IsPolymorphicBelongsTo returns true for a belongs_to relationship whose
+//associated model is given by the value of the PolymorphicType field.
+func (r *Relationship) IsPolymorphicBelongsTo() bool {
+	return r.Kind == "belongs_to" && r.PolymorphicType != ""
+}
+
 //ParseTagSetting returns a map[string]string for the tags that are set.
 func ParseTagSetting(tags reflect.StructTag) map[string]string {
 	setting := map[string]string{}
@@ -173,30 +215,86 @@ func ParseTagSetting(tags reflect.StructTag) map[string]string {
 }
 
 //SafeStructsMap provide safe storage and accessing of *Struct.
+//
+// Lookups of the structs already built don't take any lock. Structs are built
+// one at a time, so a struct is built once even when several goroutines use
+// a model for the first time together.
 type SafeStructsMap struct {
-	v  []*Struct
-	mu sync.RWMutex
+	structs sync.Map
+	mu      sync.Mutex
+
+	// root and pending are set on the view of the map used while building a
+	// struct, see Build.
+	root    *SafeStructsMap
+	pending map[reflect.Type]*Struct
 }
 
-//Set safely stores value
+//Set safely stores value. When a struct of the same type is already stored
+//it is kept.
 func (s *SafeStructsMap) Set(value *Struct) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.v = append(s.v, value)
+	if s.pending != nil {
+		s.pending[value.ModelType] = value
+		return
+	}
+	s.structs.LoadOrStore(value.ModelType, value)
 }
 
 //Get retrieves the value stored with the given key.
 func (s *SafeStructsMap) Get(key reflect.Type) *Struct {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	for _, v := range s.v {
-		if v.ModelType == key {
+	if s.pending != nil {
+		if v, ok := s.pending[key]; ok {
 			return v
 		}
+		s = s.root
+	}
+	if v, ok := s.structs.Load(key); ok {
+		return v.(*Struct)
 	}
 	return nil
 }
 
+//Build returns the struct stored with key, calling build to build it when
+//there is none.
+//
+// build is passed a view of the map which must be used for the duration of
+// the build. The structs set on the view are stored once the build is done,
+// until then they are only seen through the view, so models referring to each
+// other can be built while other goroutines wait for the complete structs.
+func (s *SafeStructsMap) Build(key reflect.Type, build func(*SafeStructsMap) (*Struct, error)) (*Struct, error) {
+	if v := s.Get(key); v != nil {
+		return v, nil
+	}
+	if s.pending != nil {
+		// a struct needed to build the one being built.
+		return build(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v := s.Get(key); v != nil {
+		return v, nil
+	}
+	view := &SafeStructsMap{root: s, pending: make(map[reflect.Type]*Struct)}
+	v, err := build(view)
+	if err != nil {
+		return nil, err
+	}
+	for typ, p := range view.pending {
+		s.structs.LoadOrStore(typ, p)
+	}
+	return v, nil
+}
+
+//Reset removes all the stored structs, they are built again when they are
+//needed.
+func (s *SafeStructsMap) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.structs.Range(func(key, _ interface{}) bool {
+		s.structs.Delete(key)
+		return true
+	})
+}
+
 //NewStructsMap returns a safe map for storing *Struct objects.
 func NewStructsMap() *SafeStructsMap {
 	return &SafeStructsMap{}
@@ -225,6 +323,23 @@ func NewScope() *Scope {
 	}
 }
 
+//Reset clears the scope, including all the values stored with Set, so that
+//it can be reused for another query.
+func (s *Scope) Reset() {
+	s.mu.Lock()
+	clear(s.data)
+	s.mu.Unlock()
+	s.Value = nil
+	s.TableName = ""
+	s.v = reflect.Value{}
+	s.hasValue = false
+	s.SQL = ""
+	s.SQLVars = nil
+	s.SelectAttrs = nil
+	s.MultiExpr = false
+	s.Exprs = nil
+}
+
 func (s *Scope) ValueOf() reflect.Value {
 	if s.hasValue {
 		return s.v
@@ -291,6 +406,7 @@ type Search struct {
 	NotConditions    []map[string]interface{}
 	HavingConditions []map[string]interface{}
 	JoinConditions   []map[string]interface{}
+	JoinAssociations []string
 	InitAttrs        []interface{}
 	AssignAttrs      []interface{}
 	Selects          map[string]interface{}
@@ -299,14 +415,87 @@ type Search struct {
 	Preload          []SearchPreload
 	Offset           interface{}
 	Limit            interface{}
+	LimitPerParent   int
 	Group            string
 	TableName        string
 	TableNames       []string
 	Raw              bool
 	Unscoped         bool
+	UnscopedTenant   bool
+	OnlyTrashed      bool
 	IgnoreOrderQuery bool
+	Clauses          []interface{}
+}
+
+//Clone returns a copy of s, which can be changed without changing s.
+func (s *Search) Clone() *Search {
+	c := *s
+	c.WhereConditions = append([]map[string]interface{}(nil), s.WhereConditions...)
+	c.OrConditions = append([]map[string]interface{}(nil), s.OrConditions...)
+	c.NotConditions = append([]map[string]interface{}(nil), s.NotConditions...)
+	c.HavingConditions = append([]map[string]interface{}(nil), s.HavingConditions...)
+	c.JoinConditions = append([]map[string]interface{}(nil), s.JoinConditions...)
+	c.JoinAssociations = append([]string(nil), s.JoinAssociations...)
+	c.InitAttrs = append([]interface{}(nil), s.InitAttrs...)
+	c.AssignAttrs = append([]interface{}(nil), s.AssignAttrs...)
+	c.Omits = append([]string(nil), s.Omits...)
+	c.Orders = append([]interface{}(nil), s.Orders...)
+	c.Preload = append([]SearchPreload(nil), s.Preload...)
+	c.TableNames = append([]string(nil), s.TableNames...)
+	c.Clauses = append([]interface{}(nil), s.Clauses...)
+	if s.Selects != nil {
+		c.Selects = make(map[string]interface{}, len(s.Selects))
+		for k, v := range s.Selects {
+			c.Selects[k] = v
+		}
+	}
+	return &c
+}
+
+//Locking is a clause for row level locking of the selected rows. It is passed
+//to DB.Clauses and is rendered at the end of the SELECT statement.
+//
+//	Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}
+//
+// is rendered as FOR UPDATE SKIP LOCKED.
+type Locking struct {
+	// Strength is the lock strength, one of UPDATE, SHARE, NO KEY UPDATE or
+	// KEY SHARE.
+	Strength string
+
+	// Table when set restricts the lock to rows of the given table.
+	Table string
+
+	// Options is either empty, NOWAIT or SKIP LOCKED.
+	Options string
 }
 
+//Associations is the preload schema matching all the associations of a model.
+//It can also be used for the last level of a nested schema, like Orders.*
+//With Select and Omit it stands for all the associations of the model saved.
+const Associations = "*"
+
+//AssociationSave is how an association is handled when its model is saved.
+type AssociationSave int
+
+//The ways of saving associations. By default associations are upserted, an
+//association named in Omit is skipped and one named with the .* suffix, like
+//Company.*, is only referenced. When Select names associations the ones not
+//named are skipped.
+const (
+	//SaveUpsert creates or updates the associated records before linking
+	//them with the model.
+	SaveUpsert AssociationSave = iota
+
+	//SaveReference links the associated records, which must already exist,
+	//with the model. Only the foreign keys, or the rows of the join table,
+	//are written.
+	SaveReference
+
+	//SaveSkip leaves the association untouched.
+	SaveSkip
+)
+
 //SearchPreload is the preload search condition.
 type SearchPreload struct {
 	Schema     string
@@ -329,6 +518,18 @@ type Expr struct {
 	Args []interface{}
 }
 
+//DefaultScoper is implemented by models with a default scope, a condition
+//added to all the queries on the model unless they are unscoped. The columns
+//of the model in the condition are qualified with its table name when the
+//query needs it, so the condition stays unambiguous with joined associations.
+//
+//	func (Post) DefaultScope() model.Expr {
+//		return model.Expr{Q: "published = ?", Args: []interface{}{true}}
+//	}
+type DefaultScoper interface {
+	DefaultScope() Expr
+}
+
 //JoinTableForeignKey info that point to a key to use in join table.
 type JoinTableForeignKey struct {
 	DBName            string
@@ -339,6 +540,12 @@ type JoinTableForeignKey struct {
 type JoinTableSource struct {
 	ModelType   reflect.Type
 	ForeignKeys []JoinTableForeignKey
+
+	// PolymorphicDBName is the column of the join table storing the type of
+	// the records of ModelType, it is empty when the join table refers to a
+	// single model. The type is stored as PolymorphicValue.
+	PolymorphicDBName string
+	PolymorphicValue  string
 }
 
 // JoinTableHandler default join table handler
@@ -346,12 +553,100 @@ type JoinTableHandler struct {
 	TableName   string          `sql:"-"`
 	Source      JoinTableSource `sql:"-"`
 	Destination JoinTableSource `sql:"-"`
+
+	// Model is the type of the join model, it is nil when the join table only
+	// has the foreign keys.
+	Model reflect.Type `sql:"-"`
+}
+
+//TxCommon is a SQLCommon that executes all queries inside the database
+//transaction Tx.
+type TxCommon struct {
+	*sql.Tx
+}
+
+//Begin always returns errmsg.ErrCantStartTransaction, nested transactions are
+//not supported.
+func (t *TxCommon) Begin() (*sql.Tx, error) {
+	return nil, errmsg.ErrCantStartTransaction
+}
+
+//Close does nothing, the transaction must be ended with Commit or Rollback.
+func (t *TxCommon) Close() error {
+	return nil
+}
+
+//IsTransaction returns true if queries executed by db are inside a
+//transaction.
+func IsTransaction(db SQLCommon) bool {
+	if w, ok := db.(*SQLCommonWrapper); ok {
+		db = w.SQLCommon
+	}
+	_, ok := db.(*TxCommon)
+	return ok
+}
+
+//ExecTx executes query inside a transaction. When db is already in a
+//transaction the query is executed as part of it, otherwise a new transaction
+//is started and committed after the query succeeds.
+//
+// The transaction block of a query built with util.WrapTX is removed when db is
+// already in a transaction, ql can't roll back a transaction after nested ones
+// were committed.
+func ExecTx(db SQLCommon, query string, args ...interface{}) (sql.Result, error) {
+	if IsTransaction(db) {
+		return db.Exec(util.UnwrapTX(query), args...)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	var r sql.Result
+	if w, ok := db.(*SQLCommonWrapper); ok && w.stmts != nil {
+		r, err = w.WithTx(tx).Exec(query, args...)
+	} else {
+		r, err = tx.Exec(query, args...)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//RunTx runs fn inside a transaction on db, fn is given a SQLCommon which
+//executes its queries in the transaction. When db is already in a transaction
+//fn is run as part of it. Otherwise the transaction is committed when fn
+//succeeds and rolled back when it fails.
+func RunTx(db SQLCommon, fn func(tx SQLCommon) error) error {
+	if IsTransaction(db) {
+		return fn(db)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	var txdb SQLCommon = &TxCommon{Tx: tx}
+	if w, ok := db.(*SQLCommonWrapper); ok {
+		txdb = w.WithTx(tx)
+	}
+	err = fn(txdb)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 type SQLCommonWrapper struct {
 	SQLCommon
 	verbose bool
 	o       io.Writer
+	stmts   *StmtCache
 }
 
 func (s *SQLCommonWrapper) printQuery(w, q string, args ...interface{}) {
@@ -365,6 +660,10 @@ func (s *SQLCommonWrapper) Exec(query string, args ...interface{}) (sql.Result,
 	if s.verbose {
 		s.printQuery("EXEC", query, args...)
 	}
+	if stmt, release, ok := s.stmt(query); ok {
+		defer release()
+		return stmt.Exec(args...)
+	}
 	return s.SQLCommon.Exec(query, args...)
 }
 
@@ -372,15 +671,94 @@ func (s *SQLCommonWrapper) Query(query string, args ...interface{}) (*sql.Rows,
 	if s.verbose {
 		s.printQuery("QUERY", query, args...)
 	}
+	if stmt, release, ok := s.stmt(query); ok {
+		defer release()
+		return stmt.Query(args...)
+	}
 	return s.SQLCommon.Query(query, args...)
 }
 func (s *SQLCommonWrapper) QueryRow(query string, args ...interface{}) *sql.Row {
 	if s.verbose {
 		s.printQuery("QUERY", query, args...)
 	}
+	if stmt, release, ok := s.stmt(query); ok {
+		defer release()
+		return stmt.QueryRow(args...)
+	}
 	return s.SQLCommon.QueryRow(query, args...)
 }
 
+// stmt returns the cached statement for query, bound to the transaction when s
+// executes queries inside one. It returns false when statements are not
+// cached, or query can't be prepared, in which case query is executed as it
+// is.
+func (s *SQLCommonWrapper) stmt(query string) (*sql.Stmt, func(), bool) {
+	if s.stmts == nil {
+		return nil, nil, false
+	}
+	stmt, release, err := s.stmts.Get(query)
+	if err != nil {
+		return nil, nil, false
+	}
+	if tx, ok := s.SQLCommon.(*TxCommon); ok {
+		// the statement of the transaction is closed with it.
+		stmt = tx.Stmt(stmt)
+	}
+	return stmt, release, true
+}
+
 func (s *SQLCommonWrapper) Verbose(b bool) {
 	s.verbose = b
 }
+
+//PrepareStmt caches up to size prepared statements for the queries executed
+//through s, evicting the least recently used ones. A size of zero or less
+//turns the cache off. The statements already cached are closed.
+func (s *SQLCommonWrapper) PrepareStmt(size int) {
+	if s.stmts != nil {
+		_ = s.stmts.Close()
+		s.stmts = nil
+	}
+	if size > 0 {
+		s.stmts = NewStmtCache(s.SQLCommon, size)
+	}
+}
+
+//Stmts returns the cache of prepared statements, it is nil unless turned on
+//with PrepareStmt.
+func (s *SQLCommonWrapper) Stmts() *StmtCache {
+	return s.stmts
+}
+
+//Close closes the cached statements and the database. The statements are kept
+//when s executes queries inside a transaction, they belong to the database.
+func (s *SQLCommonWrapper) Close() error {
+	if s.stmts != nil && !IsTransaction(s) {
+		_ = s.stmts.Close()
+	}
+	return s.SQLCommon.Close()
+}
+
+//Replica returns a wrapper of the replica db with the settings of s. When s
+//caches prepared statements the statements of db are cached in a cache of the
+//same size of its own.
+func (s *SQLCommonWrapper) Replica(db SQLCommon) *SQLCommonWrapper {
+	if w, ok := db.(*SQLCommonWrapper); ok {
+		db = w.SQLCommon
+	}
+	r := &SQLCommonWrapper{SQLCommon: db, verbose: s.verbose, o: s.o}
+	if s.stmts != nil {
+		r.stmts = NewStmtCache(db, s.stmts.size)
+	}
+	return r
+}
+
+//WithTx returns a copy of s which executes queries inside tx.
+func (s *SQLCommonWrapper) WithTx(tx *sql.Tx) *SQLCommonWrapper {
+	return &SQLCommonWrapper{
+		SQLCommon: &TxCommon{Tx: tx},
+		verbose:   s.verbose,
+		o:         s.o,
+		stmts:     s.stmts,
+	}
+}
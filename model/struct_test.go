@@ -0,0 +1,119 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// modelTypes returns n distinct struct types.
+func modelTypes(n int) []reflect.Type {
+	types := make([]reflect.Type, n)
+	for i := range types {
+		types[i] = reflect.StructOf([]reflect.StructField{
+			{Name: "ID", Type: reflect.TypeOf(int64(0))},
+			{Name: fmt.Sprintf("Field%d", i), Type: reflect.TypeOf("")},
+		})
+	}
+	return types
+}
+
+func TestSafeStructsMap(t *testing.T) {
+	types := modelTypes(2)
+	s := NewStructsMap()
+	if v := s.Get(types[0]); v != nil {
+		t.Errorf("expected nil got %v", v)
+	}
+	first := &Struct{ModelType: types[0]}
+	s.Set(first)
+	s.Set(&Struct{ModelType: types[0]})
+	if v := s.Get(types[0]); v != first {
+		t.Errorf("expected the first struct stored got %v", v)
+	}
+
+	// the struct being built is only seen through the view until the build
+	// is done.
+	var built int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := s.Build(types[1], func(view *SafeStructsMap) (*Struct, error) {
+				atomic.AddInt32(&built, 1)
+				m := &Struct{ModelType: types[1]}
+				view.Set(m)
+				if s.Get(types[1]) != nil {
+					t.Error("expected the struct to be pending")
+				}
+				if view.Get(types[1]) != m || view.Get(types[0]) != first {
+					t.Error("expected the view to resolve the structs")
+				}
+				return m, nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if v == nil || v.ModelType != types[1] {
+				t.Errorf("expected %v got %v", types[1], v)
+			}
+		}()
+	}
+	wg.Wait()
+	if built != 1 {
+		t.Errorf("expected %d got %d", 1, built)
+	}
+}
+
+// linearStructsMap is the slice backed map SafeStructsMap replaced, it is
+// kept as the baseline of the benchmarks.
+type linearStructsMap struct {
+	v  []*Struct
+	mu sync.RWMutex
+}
+
+func (s *linearStructsMap) Get(key reflect.Type) *Struct {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.v {
+		if v.ModelType == key {
+			return v
+		}
+	}
+	return nil
+}
+
+func BenchmarkSafeStructsMap_Get(b *testing.B) {
+	types := modelTypes(250)
+	s := NewStructsMap()
+	linear := &linearStructsMap{}
+	for _, typ := range types {
+		s.Set(&Struct{ModelType: typ})
+		linear.v = append(linear.v, &Struct{ModelType: typ})
+	}
+	b.Run("sync.Map", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				if s.Get(types[i%len(types)]) == nil {
+					b.Fatal("expected a struct")
+				}
+				i++
+			}
+		})
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				if linear.Get(types[i%len(types)]) == nil {
+					b.Fatal("expected a struct")
+				}
+				i++
+			}
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package model
+
+import "context"
+
+//Tenancy scopes the queries on models with a tenant column to the tenant of
+//the context of the query. The rows of the other tenants can only be reached
+//with an explicit DB.UnscopedTenant.
+type Tenancy struct {
+	// Column is the tenant column, tenant_id by default.
+	Column string
+
+	// Tenant returns the tenant of ctx and false when there is none. It
+	// defaults to TenantFromContext.
+	Tenant func(ctx context.Context) (interface{}, bool)
+}
+
+//ColumnName returns the name of the tenant column.
+func (t *Tenancy) ColumnName() string {
+	if t.Column == "" {
+		return "tenant_id"
+	}
+	return t.Column
+}
+
+//TenantOf returns the tenant of ctx.
+func (t *Tenancy) TenantOf(ctx context.Context) (interface{}, bool) {
+	if t.Tenant != nil {
+		return t.Tenant(ctx)
+	}
+	return TenantFromContext(ctx)
+}
+
+type tenantKey struct{}
+
+//WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+//TenantFromContext returns the tenant set on ctx with WithTenant.
+func TenantFromContext(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
@@ -39,6 +39,10 @@ import (
 	"github.com/ngorm/ngorm/util"
 )
 
+// Associations is the preload schema matching all the associations of a
+// model, see Preload.
+const Associations = model.Associations
+
 //Opener is an interface that is used to open up connection to SQL databases.
 type Opener interface {
 	Open(dialect string, args ...interface{}) (model.SQLCommon, dialects.Dialect, error)
@@ -53,6 +57,10 @@ type DB struct {
 	cancel        func()
 	singularTable bool
 	structMap     *model.SafeStructsMap
+	resolver      *model.Resolver
+	sharding      *model.Sharding
+	tenancy       *model.Tenancy
+	joinModels    *model.JoinModels
 	e             *engine.Engine
 	err           error
 	now           func() time.Time
@@ -66,7 +74,11 @@ func (db *DB) clone() *DB {
 		cancel:        db.cancel,
 		singularTable: db.singularTable,
 		structMap:     db.structMap,
-		now:           time.Now,
+		resolver:      db.resolver,
+		sharding:      db.sharding,
+		tenancy:       db.tenancy,
+		joinModels:    db.joinModels,
+		now:           db.now,
 		e:             db.NewEngine(),
 	}
 }
@@ -107,26 +119,67 @@ func OpenWithOpener(opener Opener, dialect string, args ...interface{}) (*DB, er
 	dia.SetDB(db)
 	ctx, cancel := context.WithCancel(context.Background())
 	return &DB{
-		db:        &model.SQLCommonWrapper{SQLCommon: db},
-		dialect:   dia,
-		structMap: model.NewStructsMap(),
-		ctx:       ctx,
-		cancel:    cancel,
+		db:         &model.SQLCommonWrapper{SQLCommon: db},
+		dialect:    dia,
+		structMap:  model.NewStructsMap(),
+		resolver:   model.NewResolver(),
+		sharding:   model.NewSharding(),
+		joinModels: model.NewJoinModels(),
+		ctx:        ctx,
+		cancel:     cancel,
+		now:        time.Now,
 	}, nil
 }
 
-// NewEngine returns an initialized engine ready to kick some ass.
+// NewEngine returns an initialized engine ready to kick some ass. The context
+// set with WithContext on db is carried over.
 func (db *DB) NewEngine() *engine.Engine {
 	e := engine.Get()
 	e.StructMap = db.structMap
 	e.SingularTable = db.singularTable
 	e.Ctx = db.ctx
+	if db.e != nil && db.e.Ctx != nil {
+		e.Ctx = db.e.Ctx
+	}
 	e.Dialect = db.dialect
 	e.SQLDB = db.db
+	e.Resolver = db.resolver
+	e.Sharding = db.sharding
+	e.Tenancy = db.tenancy
+	e.JoinModels = db.joinModels
 	e.Now = db.now
 	return e
 }
 
+//Preregister builds and caches the metadata of models, so that the first
+//queries on them don't pay for it. It returns the errors of the invalid
+//relationships of the models, which are otherwise only noticed when the
+//relationships are used.
+//
+//	err := db.Preregister(&User{}, &Email{}, &Language{})
+func (db *DB) Preregister(models ...interface{}) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	var errs []error
+	for _, value := range models {
+		m, err := scope.GetModelStruct(e, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, err := range m.RelationshipErrors {
+			errs = append(errs, fmt.Errorf("%s: %v", m.ModelType.Name(), err))
+		}
+		for _, field := range m.StructFields {
+			if !field.IsNormal && !field.IsIgnored && field.Relationship == nil {
+				errs = append(errs, fmt.Errorf("%s: no relationship found for field %s",
+					m.ModelType.Name(), field.Name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 //CreateTable creates new database tables that maps to the models.
 func (db *DB) CreateTable(models ...interface{}) (sql.Result, error) {
 	query, err := db.CreateTableSQL(models...)
@@ -146,25 +199,261 @@ func (db *DB) CreateTable(models ...interface{}) (sql.Result, error) {
 //risk. Use this only in development
 func (db *DB) Verbose(b bool) {
 	db.db.Verbose(b)
+	for _, r := range db.replicas() {
+		r.Verbose(b)
+	}
+}
+
+//Replicas routes the read queries of tables to replicas of the database.
+//tables are table names or models, without them the replicas are used for all
+//the tables which have no replicas of their own. Find, First, Last, Count,
+//Pluck and preloads read from a replica chosen by the policy of replicas.
+//
+// Writes, queries inside transactions and queries locking rows are run on the
+// primary database, and so is a query with the model.UsePrimary clause. The
+// replicas are logged with Verbose and cache their prepared statements with
+// PrepareStmt like the primary database.
+//
+//	db.Replicas(model.Replicas{
+//		DBs:    []model.SQLCommon{replica1, replica2},
+//		Policy: model.Random(),
+//	}, &User{}, "orders")
+func (db *DB) Replicas(replicas model.Replicas, tables ...interface{}) error {
+	names, err := db.tableNames(tables)
+	if err != nil {
+		return err
+	}
+	dbs := make([]model.SQLCommon, len(replicas.DBs))
+	for i, r := range replicas.DBs {
+		dbs[i] = db.db.Replica(r)
+	}
+	replicas.DBs = dbs
+	db.resolver.Register(replicas, names...)
+	return nil
+}
+
+//replicas returns the wrappers of the registered replicas.
+func (db *DB) replicas() []*model.SQLCommonWrapper {
+	var wrappers []*model.SQLCommonWrapper
+	for _, r := range db.resolver.DBs() {
+		if w, ok := r.(*model.SQLCommonWrapper); ok {
+			wrappers = append(wrappers, w)
+		}
+	}
+	return wrappers
+}
+
+//Tenancy scopes the queries on the models with a tenant column to the tenant
+//of the context of the query, set with WithContext. The tenant column is
+//compared to the tenant in the WHERE clause of all the queries, and is set to
+//it on the records which are created. Updates setting it to another tenant
+//fail with errmsg.ErrWrongTenant.
+//
+//	db.Tenancy(model.Tenancy{Column: "tenant_id"})
+//	...
+//	ctx = model.WithTenant(ctx, tenantID)
+//	err = db.WithContext(ctx).Find(&invoices) // WHERE tenant_id = tenantID
+//
+// A query on a scoped model without a tenant fails with
+// errmsg.ErrMissingTenant, the records of all the tenants are only reached
+// with UnscopedTenant. Raw SQL, queries on tables without a model and joined
+// tables are not scoped.
+//
+// Tenancy configures db, like Replicas and Shard it is meant to be called
+// before db is shared. The queries already chained on db are left untouched.
+func (db *DB) Tenancy(t model.Tenancy) {
+	db.tenancy = &t
+}
+
+//Shard splits tables, given by name or model, into shards. The shard of a
+//query is chosen by the value of the shard key column, which is read from the
+//record for writes and from the where conditions otherwise. Queries on the
+//tables which aren't sharded are left untouched.
+//
+//	err := db.Shard(model.ShardConfig{ShardKey: "user_id", Shards: 8}, &Order{})
+//	...
+//	err = db.Create(&Order{UserID: 7}) // INSERT INTO orders_07
+//	err = db.Where("user_id = ?", 7).Find(&orders) // SELECT FROM orders_07
+//
+// A Find, First or Last without the shard key is run on all the shards and the
+// records are merged, sorted by the columns of Order with Offset and Limit
+// applied to the merged records, and the associations of the merged records are
+// preloaded. The records are sorted in Go, so the order can only be a list of
+// columns of the model with an optional ASC or DESC, like
+// Order("created_at DESC, id"). Orders by expressions, functions or
+// model.Expr, and grouped queries, fail with errmsg.ErrShardFanOut. The other
+// queries fail with errmsg.ErrMissingShardKey, preloads of a sharded table
+// need the shard key in their conditions.
+//
+// A record without a shard key is written to the Fallback table of the
+// configuration when there is one, instead of failing.
+//
+// CreateTable, Automigrate and DropTable handle the tables of all the shards
+// and the fallback table, for tables sharded across databases each database
+// must be migrated on its own.
+func (db *DB) Shard(c model.ShardConfig, tables ...interface{}) error {
+	names, err := db.tableNames(tables)
+	if err != nil {
+		return err
+	}
+	return db.sharding.Register(c, names...)
+}
+
+//RegisterJoinModel registers models that can be used as join tables of
+//many_to_many relationships. A relationship uses a join model by naming it in
+//the many2many tag.
+//
+//	type UserLanguage struct {
+//		UserID     int64 `gorm:"primary_key"`
+//		LanguageID int64 `gorm:"primary_key"`
+//		Level      string
+//		CreatedAt  time.Time
+//	}
+//
+//	type User struct {
+//		ID        int64
+//		Languages []Language `gorm:"many2many:UserLanguage"`
+//	}
+//
+//	err := db.RegisterJoinModel(&UserLanguage{})
+//
+// The join model must have the foreign key columns of the relationship, the
+// rest of its columns are filled when records are linked, see
+// Association.WithJoin. A many2many tag naming a type which isn't registered,
+// rather than a table, is a relationship error, see Preregister.
+//
+// The models known to db are built again after the join models are
+// registered, like Replicas and Shard it is meant to be called before db is
+// shared.
+func (db *DB) RegisterJoinModel(values ...interface{}) error {
+	err := db.joinModels.Register(values...)
+	if err != nil {
+		return err
+	}
+	db.structMap.Reset()
+	return nil
+}
+
+// tableNames returns the names of tables, which are table names or models.
+func (db *DB) tableNames(tables []interface{}) ([]string, error) {
+	var names []string
+	for _, t := range tables {
+		if name, ok := t.(string); ok {
+			names = append(names, name)
+			continue
+		}
+		e := db.NewEngine()
+		name := scope.TableName(e, t)
+		engine.Put(e)
+		if name == "" {
+			return nil, fmt.Errorf("ngorm: no table name for %T", t)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// shardTables returns the tables of the database of db which hold the records
+// of the table of m when it is sharded, nil otherwise. These are the tables of
+// the shards when the table is sharded by suffix, and the fallback table.
+func (db *DB) shardTables(m interface{}) []string {
+	if _, ok := m.(string); ok {
+		return nil
+	}
+	e := db.NewEngine()
+	defer engine.Put(e)
+	table := scope.TableName(e, m)
+	c, ok := db.sharding.Config(table)
+	if !ok {
+		return nil
+	}
+	var tables []string
+	for _, shard := range c.All(table) {
+		if shard.DB == nil {
+			tables = append(tables, shard.Table)
+		}
+	}
+	return tables
+}
+
+//PrepareStmt turns on caching of prepared statements. The SQL of each query
+//is prepared once and the statement is reused by the queries with the same
+//SQL, up to size statements are kept and the least recently used ones are
+//closed. Queries inside transactions use the cached statements with tx.Stmt.
+//
+// A size of zero or less turns the cache off. It has no effect on a DB in a
+// transaction, which uses the cache of the DB it was started from. The cache
+// is closed with Close.
+func (db *DB) PrepareStmt(size int) {
+	if model.IsTransaction(db.db) {
+		return
+	}
+	db.db.PrepareStmt(size)
+	for _, r := range db.replicas() {
+		r.PrepareStmt(size)
+	}
 }
 
 //ExecTx wraps the query execution in a Transaction. This ensure all operations
 //are Rolled back in case the execution fails.
+//
+// When db is already in a transaction started with BeginTx the query is
+// executed as part of that transaction.
 func (db *DB) ExecTx(query string, args ...interface{}) (sql.Result, error) {
-	tx, err := db.db.Begin()
-	if err != nil {
-		return nil, err
+	return model.ExecTx(db.db, query, args...)
+}
+
+//BeginTx starts a database transaction and returns a *DB which executes all
+//its queries inside the transaction. The transaction must be ended by calling
+//Commit or Rollback on the returned *DB.
+//
+//	tx, err := db.BeginTx(ctx, nil)
+//	if err != nil {
+//		return err
+//	}
+//	if err = tx.Create(&user); err != nil {
+//		_ = tx.Rollback()
+//		return err
+//	}
+//	return tx.Commit()
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*DB, error) {
+	if model.IsTransaction(db.db) {
+		return nil, errmsg.ErrCantStartTransaction
+	}
+	var tx *sql.Tx
+	var err error
+	if b, ok := db.db.SQLCommon.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+	}); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = db.db.Begin()
 	}
-	r, err := tx.Exec(query, args...)
 	if err != nil {
-		_ = tx.Rollback()
 		return nil, err
 	}
-	err = tx.Commit()
-	if err != nil {
-		return nil, err
+	ndb := db.clone()
+	ndb.db = db.db.WithTx(tx)
+	ndb.e.SQLDB = ndb.db
+	return ndb, nil
+}
+
+//Commit commits the transaction started with BeginTx.
+func (db *DB) Commit() error {
+	tx, ok := db.db.SQLCommon.(*model.TxCommon)
+	if !ok {
+		return errmsg.ErrInvalidTransaction
+	}
+	return tx.Commit()
+}
+
+//Rollback aborts the transaction started with BeginTx.
+func (db *DB) Rollback() error {
+	tx, ok := db.db.SQLCommon.(*model.TxCommon)
+	if !ok {
+		return errmsg.ErrInvalidTransaction
 	}
-	return r, nil
+	return tx.Rollback()
 }
 
 //CreateTableSQL return the sql query for creating tables for all the given
@@ -179,22 +468,19 @@ func (db *DB) CreateTableSQL(models ...interface{}) (*model.Expr, error) {
 		_, _ = buf.WriteString("BEGIN TRANSACTION; \n")
 	}
 	for _, m := range models {
-		e := db.NewEngine()
-		defer engine.Put(e)
-		for k, v := range scopeVars {
-			e.Scope.Set(k, v)
+		if tables := db.shardTables(m); tables != nil {
+			for _, table := range tables {
+				err := db.createTableSQL(&buf, m, table, scopeVars)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
 		}
-		// Firste we generate the SQL
-		err := scope.CreateTable(e, m)
+		err := db.createTableSQL(&buf, m, "", scopeVars)
 		if err != nil {
 			return nil, err
 		}
-		_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
-		if e.Scope.MultiExpr {
-			for _, expr := range e.Scope.Exprs {
-				_, _ = buf.WriteString("\t" + expr.Q + ";\n")
-			}
-		}
 	}
 	if isQL(db) {
 		_, _ = buf.WriteString("COMMIT;")
@@ -202,6 +488,29 @@ func (db *DB) CreateTableSQL(models ...interface{}) (*model.Expr, error) {
 	return &model.Expr{Q: buf.String()}, nil
 }
 
+// createTableSQL writes the queries creating the table of m to buf, named table
+// if it isn't empty.
+func (db *DB) createTableSQL(buf *bytes.Buffer, m interface{}, table string, scopeVars map[string]interface{}) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	e.Search.TableName = table
+	for k, v := range scopeVars {
+		e.Scope.Set(k, v)
+	}
+	// Firste we generate the SQL
+	err := scope.CreateTable(e, m)
+	if err != nil {
+		return err
+	}
+	_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
+	if e.Scope.MultiExpr {
+		for _, expr := range e.Scope.Exprs {
+			_, _ = buf.WriteString("\t" + expr.Q + ";\n")
+		}
+	}
+	return nil
+}
+
 func isQL(db *DB) bool {
 	return dialects.IsQL(db.Dialect())
 }
@@ -214,17 +523,19 @@ func (db *DB) DropTableSQL(models ...interface{}) (*model.Expr, error) {
 		_, _ = buf.WriteString("BEGIN TRANSACTION; \n")
 	}
 	for _, m := range models {
-		e := db.NewEngine()
-		defer engine.Put(e)
-		if n, ok := m.(string); ok {
-			e.Search.TableName = n
+		if tables := db.shardTables(m); tables != nil {
+			for _, table := range tables {
+				err := db.dropTableSQL(&buf, table)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
 		}
-		// Firste we generate the SQL
-		err := scope.DropTable(e, m)
+		err := db.dropTableSQL(&buf, m)
 		if err != nil {
 			return nil, err
 		}
-		_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
 	}
 	if isQL(db) {
 		_, _ = buf.WriteString("COMMIT;")
@@ -232,6 +543,22 @@ func (db *DB) DropTableSQL(models ...interface{}) (*model.Expr, error) {
 	return &model.Expr{Q: buf.String()}, nil
 }
 
+// dropTableSQL writes the query dropping the table of m to buf.
+func (db *DB) dropTableSQL(buf *bytes.Buffer, m interface{}) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	if n, ok := m.(string); ok {
+		e.Search.TableName = n
+	}
+	// Firste we generate the SQL
+	err := scope.DropTable(e, m)
+	if err != nil {
+		return err
+	}
+	_, _ = buf.WriteString("\t" + e.Scope.SQL + ";\n")
+	return nil
+}
+
 //DropTable drops tables that are mapped to models. You can also pass the name
 //of the table as astring and it will be handled.
 func (db *DB) DropTable(models ...interface{}) (sql.Result, error) {
@@ -271,32 +598,10 @@ func (db *DB) AutomigrateSQL(models ...interface{}) (*model.Expr, error) {
 	}
 	keys := make(map[string]bool)
 	for _, m := range models {
-		e := db.NewEngine()
-		defer engine.Put(e)
-
-		// Firste we generate the SQL
-		err := scope.Automigrate(e, m)
+		err := db.automigrateSQL(buf, m, keys)
 		if err != nil {
 			return nil, err
 		}
-		if e.Scope.SQL != "" {
-			i := strings.Index(e.Scope.SQL, "(")
-			k := e.Scope.SQL[:i]
-			if _, ok := keys[k]; !ok {
-				buf.WriteString("\t" + e.Scope.SQL + ";\n")
-				keys[k] = true
-			}
-		}
-		if e.Scope.MultiExpr {
-			for _, expr := range e.Scope.Exprs {
-				i := strings.Index(expr.Q, "(")
-				k := expr.Q[:i]
-				if _, ok := keys[k]; !ok {
-					buf.WriteString("\t" + expr.Q + ";\n")
-					keys[k] = true
-				}
-			}
-		}
 	}
 	if isQL(db) {
 		buf.WriteString("COMMIT;")
@@ -304,10 +609,62 @@ func (db *DB) AutomigrateSQL(models ...interface{}) (*model.Expr, error) {
 	return &model.Expr{Q: buf.String()}, nil
 }
 
+// automigrateSQL writes the migration queries of m to buf. keys holds the
+// tables which already have a query, they are skipped.
+func (db *DB) automigrateSQL(buf *bytes.Buffer, m interface{}, keys map[string]bool) error {
+	if tables := db.shardTables(m); tables != nil {
+		for _, table := range tables {
+			err := db.automigrateTableSQL(buf, m, table, keys)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return db.automigrateTableSQL(buf, m, "", keys)
+}
+
+// automigrateTableSQL writes the migration queries of m to buf, for the table
+// named table if it isn't empty.
+func (db *DB) automigrateTableSQL(buf *bytes.Buffer, m interface{}, table string, keys map[string]bool) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	e.Search.TableName = table
+
+	// Firste we generate the SQL
+	err := scope.Automigrate(e, m)
+	if err != nil {
+		return err
+	}
+	if e.Scope.SQL != "" {
+		i := strings.Index(e.Scope.SQL, "(")
+		k := e.Scope.SQL[:i]
+		if _, ok := keys[k]; !ok {
+			buf.WriteString("\t" + e.Scope.SQL + ";\n")
+			keys[k] = true
+		}
+	}
+	if e.Scope.MultiExpr {
+		for _, expr := range e.Scope.Exprs {
+			i := strings.Index(expr.Q, "(")
+			k := expr.Q[:i]
+			if _, ok := keys[k]; !ok {
+				buf.WriteString("\t" + expr.Q + ";\n")
+				keys[k] = true
+			}
+		}
+	}
+	return nil
+}
+
 //Close closes the database connection and sends Done signal across all
-//goroutines that subscribed to this instance context.
+//goroutines that subscribed to this instance context. The prepared statements
+//of the replicas are closed, the replicas themselves are not.
 func (db *DB) Close() error {
 	db.cancel()
+	for _, r := range db.replicas() {
+		r.PrepareStmt(0)
+	}
 	return db.db.Close()
 }
 
@@ -316,22 +673,29 @@ func (db *DB) Close() error {
 // You can hijack the execution of the generated SQL by overriding
 // model.HookCreateExec hook.
 func (db *DB) Create(value interface{}) error {
-	e := db.NewEngine()
-	defer engine.Put(e)
+	e, done := db.terminal()
+	defer done()
 	e.Scope.ContextValue(value)
 	return hooks.Create(e)
 }
 
+// terminal returns the engine for a terminal operation and the function to
+// call when it is done. The engine of a chain, which carries options like
+// Select and Omit, is recycled and a shared DB without one gets a new engine,
+// so it can be used concurrently.
+func (db *DB) terminal() (*engine.Engine, func()) {
+	if db.e == nil {
+		e := db.NewEngine()
+		return e, func() { engine.Put(e) }
+	}
+	return db.e, db.recycle
+}
+
 //CreateSQL generates SQl query for creating a new record/records for value.
 // The end query is wrapped under for ql dialectTRANSACTION block.
 func (db *DB) CreateSQL(value interface{}) (*model.Expr, error) {
-	var e *engine.Engine
-	if db.e != nil {
-		e = db.e
-	} else {
-		e = db.NewEngine()
-	}
-	defer engine.Put(e)
+	e, done := db.terminal()
+	defer done()
 	e.Scope.ContextValue(value)
 	err := hooks.CreateSQL(e)
 	if err != nil {
@@ -364,12 +728,12 @@ func (db *DB) SaveSQL(value interface{}) (*model.Expr, error) {
 
 // Save update value in database, if the value doesn't have primary key, will insert it
 func (db *DB) Save(value interface{}) error {
-	e := db.NewEngine()
-	defer engine.Put(e)
+	e, done := db.terminal()
+	defer done()
 	e.Scope.ContextValue(value)
 	field, _ := scope.PrimaryField(e, value)
 	if field == nil || field.IsBlank {
-		return db.Create(value)
+		return hooks.Create(e)
 	}
 	return hooks.Update(e)
 }
@@ -479,7 +843,10 @@ func (db *DB) First(out interface{}, where ...interface{}) error {
 	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
+	err := db.setDestination(out)
+	if err != nil {
+		return err
+	}
 	return hooks.Query(db.e)
 }
 
@@ -487,10 +854,14 @@ func (db *DB) First(out interface{}, where ...interface{}) error {
 //key.
 func (db *DB) FirstSQL(out interface{}, where ...interface{}) (*model.Expr, error) {
 	db.Set(model.OrderByPK, "ASC")
+	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
-	err := hooks.QuerySQL(db.e)
+	err := db.setDestination(out)
+	if err != nil {
+		return nil, err
+	}
+	err = hooks.QuerySQL(db.e)
 	if err != nil {
 		return nil, err
 	}
@@ -500,9 +871,13 @@ func (db *DB) FirstSQL(out interface{}, where ...interface{}) (*model.Expr, erro
 //Last finds the last record and order by primary key.
 func (db *DB) Last(out interface{}, where ...interface{}) error {
 	db.Set(model.OrderByPK, "DESC")
+	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
+	err := db.setDestination(out)
+	if err != nil {
+		return err
+	}
 	return hooks.Query(db.e)
 }
 
@@ -510,10 +885,14 @@ func (db *DB) Last(out interface{}, where ...interface{}) error {
 //key.
 func (db *DB) LastSQL(out interface{}, where ...interface{}) (*model.Expr, error) {
 	db.Set(model.OrderByPK, "DESC")
+	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
-	err := hooks.QuerySQL(db.e)
+	err := db.setDestination(out)
+	if err != nil {
+		return nil, err
+	}
+	err = hooks.QuerySQL(db.e)
 	if err != nil {
 		return nil, err
 	}
@@ -536,8 +915,11 @@ func (db *DB) FindSQL(out interface{}, where ...interface{}) (*model.Expr, error
 	}
 	defer db.recycle()
 	search.Inline(db.e, where...)
-	db.e.Scope.ContextValue(out)
-	err := hooks.QuerySQL(db.e)
+	err := db.setDestination(out)
+	if err != nil {
+		return nil, err
+	}
+	err = hooks.QuerySQL(db.e)
 	if err != nil {
 		return nil, err
 	}
@@ -545,16 +927,78 @@ func (db *DB) FindSQL(out interface{}, where ...interface{}) (*model.Expr, error
 }
 
 // Find find records that match given conditions
+//
+// out is usually a pointer to a model or a slice of models. When a model is
+// set with Model, out can be any struct whose fields match the selected
+// columns, a map[string]interface{} or a []map[string]interface{}.
+//	var names []struct{ Name string }
+//	db.Model(&User{}).Select("name").Find(&names)
+//
+// On a sharded table without the shard key in the conditions the order must
+// be by columns, see Shard.
 func (db *DB) Find(out interface{}, where ...interface{}) error {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
 	defer db.recycle()
 	search.Inline(db.e, where...)
-	db.e.Scope.ContextValue(out)
+	err := db.setDestination(out)
+	if err != nil {
+		return err
+	}
 	return hooks.Query(db.e)
 }
 
+// setDestination sets out as the value which query results are scanned into.
+//
+// When a model was set with Model and out doesn't have the same shape, the
+// model is kept for building the SQL and out is stored under
+// model.QueryDestination. This is what allows scanning into DTO structs and
+// maps.
+func (db *DB) setDestination(out interface{}) error {
+	if db.e.Scope.Value == nil {
+		if isMapValue(out) {
+			return errmsg.ErrMissingModel
+		}
+		db.e.Scope.ContextValue(out)
+		return nil
+	}
+	if isMapValue(out) || indirectType(out) != indirectType(db.e.Scope.Value) {
+		db.e.Scope.Set(model.QueryDestination, out)
+		return nil
+	}
+	db.e.Scope.ContextValue(out)
+	return nil
+}
+
+// withoutLocking returns clauses with the row locking clauses removed.
+func withoutLocking(clauses []interface{}) []interface{} {
+	var c []interface{}
+	for _, v := range clauses {
+		switch v.(type) {
+		case model.Locking, *model.Locking:
+		default:
+			c = append(c, v)
+		}
+	}
+	return c
+}
+
+// indirectType returns the type of the value after dereferencing pointers and
+// slices.
+func indirectType(v interface{}) reflect.Type {
+	typ := reflect.TypeOf(v)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+func isMapValue(v interface{}) bool {
+	typ := indirectType(v)
+	return typ != nil && typ.Kind() == reflect.Map
+}
+
 // Attrs initialize struct with argument if record not found
 func (db *DB) Attrs(attrs ...interface{}) *DB {
 	if db.e == nil {
@@ -591,15 +1035,49 @@ func (db *DB) Having(query string, values ...interface{}) *DB {
 	return db
 }
 
-// Joins specify Joins conditions
+// Joins specify Joins conditions. When query is the name of a has_one or
+// belongs_to association of the model, the association is loaded with a LEFT
+// JOIN in the same query.
+//
+//	db.Joins("Company").Find(&users)
+//
+// The columns of the association are selected as Company__name, conditions on
+// the model columns should be qualified with the table name to avoid ambiguity.
+//
+// ql supports a single outer join per query. With ql only the first joined
+// association is loaded with a LEFT JOIN, the others are preloaded with a query
+// of their own as with Preload.
 func (db *DB) Joins(query string, args ...interface{}) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
+	if len(args) == 0 && query != "" && !strings.ContainsAny(query, " \t\n") {
+		search.JoinAssociation(db.e, query)
+		return db
+	}
 	search.Join(db.e, query, args...)
 	return db
 }
 
+// LimitPerParent limits the number of records preloaded for each parent of a
+// has_many association, it is used in the preload conditions.
+//
+//	db.Preload("Comments", func(db *DB) *DB {
+//		return db.Order("created_at desc").LimitPerParent(3)
+//	}).Find(&posts)
+//
+// The limit is applied with ROW_NUMBER() OVER (PARTITION BY ...) on dialects
+// supporting window functions. With ql all the matching records are queried
+// and the ones above the limit are discarded, so the order should be given for
+// the result to be deterministic.
+func (db *DB) LimitPerParent(limit int) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.LimitPerParent(db.e, limit)
+	return db
+}
+
 // Offset specify the number of records to skip before starting to return the records
 func (db *DB) Offset(offset interface{}) *DB {
 	if db.e == nil {
@@ -624,6 +1102,16 @@ func (db *DB) Order(value interface{}, reorder ...bool) *DB {
 // Select specify fields that you want to retrieve from database when querying,
 // by default, will select all fields; When creating/updating, specify fields
 // that you want to save to database
+//
+// Associations can be selected too, the ones which are not selected are not
+// saved. With the .* suffix the associated records are only referenced, see
+// model.AssociationSave.
+//
+//	db.Select("Emails").Create(&user)
+//	db.Select("Company.*").Save(&user)
+//
+// When deleting, the selected has_one and has_many associated records are
+// deleted along with their owner, see hooks.DeleteAssociations.
 func (db *DB) Select(query interface{}, args ...interface{}) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
@@ -634,6 +1122,11 @@ func (db *DB) Select(query interface{}, args ...interface{}) *DB {
 
 // Omit specify fields that you want to ignore when saving to database for
 // creating, updating
+//
+// Omitting an association skips it, while omitting it with the .* suffix
+// saves the references to the associated records without saving them.
+//
+//	db.Omit("Company.*").Save(&user)
 func (db *DB) Omit(columns ...string) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
@@ -642,6 +1135,98 @@ func (db *DB) Omit(columns ...string) *DB {
 	return db
 }
 
+// Clauses adds extra clauses to the query. Currently supported are
+// model.Locking for row level locking, which must be used inside a
+// transaction, and model.UsePrimary to read from the primary database of a
+// table with replicas.
+//
+//	tx, err := db.BeginTx(ctx, nil)
+//	...
+//	err = tx.Clauses(model.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+//		Where("state = ?", "pending").First(&job)
+func (db *DB) Clauses(clauses ...interface{}) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Clauses(db.e, clauses...)
+	return db
+}
+
+// Unscoped disables the soft delete scoping and the default scopes of the
+// models. Queries include soft deleted records and Delete removes records
+// permanently.
+//
+//	db.Unscoped().Find(&users)
+func (db *DB) Unscoped() *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Unscoped(db.e, true)
+	return db
+}
+
+// Scopes applies the scopes to the query, in order. A scope is a reusable
+// part of a query.
+//
+//	func Active(db *DB) *DB {
+//		return db.Where("active = ?", true)
+//	}
+//
+//	db.Scopes(Active, OlderThan(18)).Find(&users)
+//
+// Like WithContext it starts a new query when db has none, so it is safe to
+// call on a DB shared by concurrent requests.
+func (db *DB) Scopes(scopes ...func(*DB) *DB) *DB {
+	if db.e == nil {
+		db = db.clone()
+	}
+	for _, fn := range scopes {
+		db = fn(db)
+	}
+	return db
+}
+
+// UnscopedTenant disables the tenant scoping, queries reach the records of
+// all the tenants. See Tenancy.
+//
+//	db.UnscopedTenant().Find(&invoices)
+//
+// Like WithContext it starts a new query when db has none, instead of storing
+// it on db, so it is safe to call on a DB shared by concurrent requests.
+func (db *DB) UnscopedTenant() *DB {
+	if db.e == nil {
+		db = db.clone()
+	}
+	search.UnscopedTenant(db.e, true)
+	return db
+}
+
+// WithContext sets the context of the query, which carries its tenant.
+//
+//	ctx = model.WithTenant(ctx, tenantID)
+//	err = db.WithContext(ctx).Find(&invoices)
+//
+// When db has no query yet a new one is returned, like with Model and Table,
+// so that concurrent requests on a shared DB never see each other's tenant.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	if db.e == nil {
+		db = db.clone()
+	}
+	db.e.Ctx = ctx
+	return db
+}
+
+// OnlyTrashed limits queries to soft deleted records.
+//
+//	db.OnlyTrashed().Find(&users)
+func (db *DB) OnlyTrashed() *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.OnlyTrashed(db.e, true)
+	return db
+}
+
 // Not filter records that don't match current conditions, similar to `Where`
 func (db *DB) Not(query interface{}, args ...interface{}) *DB {
 	if db.e == nil {
@@ -673,21 +1258,19 @@ func (db *DB) Where(query interface{}, args ...interface{}) *DB {
 // FirstOrInit find first matched record or initialize a new one with given
 //conditions (only works with struct, map conditions)
 func (db *DB) FirstOrInit(out interface{}, where ...interface{}) error {
-	if db.e == nil {
-		db.e = db.NewEngine()
-	}
-	defer db.recycle()
-	db.e.Scope.ContextValue(out)
+	e, done := db.terminal()
+	defer done()
+	e.Scope.ContextValue(out)
 	err := db.Begin().First(out, where...)
 	if err != nil {
 		if err != errmsg.ErrRecordNotFound {
 			return err
 		}
-		search.Inline(db.e, where...)
-		scope.Initialize(db.e)
+		search.Inline(e, where...)
+		scope.Initialize(e)
 		return nil
 	}
-	_, _ = scope.UpdatedAttrsWithValues(db.e, db.e.Search.AssignAttrs)
+	_, _ = scope.UpdatedAttrsWithValues(e, e.Search.AssignAttrs)
 	return nil
 }
 
@@ -697,6 +1280,14 @@ func (db *DB) Begin() *DB {
 	return db.clone()
 }
 
+// engine returns the engine of db, creating a new one if there is none.
+func (db *DB) engine() *engine.Engine {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	return db.e
+}
+
 func (db *DB) recycle() {
 	engine.Put(db.e)
 	db.e = nil
@@ -726,7 +1317,7 @@ func (db *DB) Pluck(column string, value interface{}) error {
 	if err != nil {
 		return err
 	}
-	rows, err := db.SQLCommon().Query(db.e.Scope.SQL, db.e.Scope.SQLVars...)
+	rows, err := scope.Reader(db.e).Query(db.e.Scope.SQL, db.e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
@@ -750,11 +1341,12 @@ func (db *DB) Count(value interface{}) error {
 	}
 	defer db.recycle()
 	db.e.Search.IgnoreOrderQuery = true
+	db.e.Search.Clauses = withoutLocking(db.e.Search.Clauses)
 	err := builder.PrepareQuery(db.e, db.e.Scope.Value)
 	if err != nil {
 		return err
 	}
-	return db.SQLCommon().QueryRow(db.e.Scope.SQL, db.e.Scope.SQLVars...).Scan(value)
+	return scope.Reader(db.e).QueryRow(db.e.Scope.SQL, db.e.Scope.SQLVars...).Scan(value)
 }
 
 // AddIndexSQL generates SQL to add index for columns with given name
@@ -796,9 +1388,18 @@ func (db *DB) DropTableIfExists(values ...interface{}) error {
 
 // Delete delete value match given conditions, if the value has primary key,
 //then will including the primary key as condition
+//
+// Models with a soft delete column, see model.SoftDeleter, are soft deleted.
+// Use Unscoped to delete them permanently.
+//
+//	db.Unscoped().Delete(&user)
+//
+// Associated records owned by value are deleted when they are selected.
+//
+//	db.Select("Emails").Delete(&user)
 func (db *DB) Delete(value interface{}, where ...interface{}) error {
-	e := db.NewEngine()
-	defer engine.Put(e)
+	e := db.engine()
+	defer db.recycle()
 	e.Scope.ContextValue(value)
 	search.Inline(e, where...)
 	return hooks.Delete(e)
@@ -807,8 +1408,8 @@ func (db *DB) Delete(value interface{}, where ...interface{}) error {
 // DeleteSQL  generates SQL to delete value match given conditions, if the value has primary key,
 //then will including the primary key as condition
 func (db *DB) DeleteSQL(value interface{}, where ...interface{}) (*model.Expr, error) {
-	e := db.NewEngine()
-	defer engine.Put(e)
+	e := db.engine()
+	defer db.recycle()
 	e.Scope.ContextValue(value)
 	search.Inline(e, where...)
 	err := hooks.DeleteSQL(e)
@@ -818,12 +1419,41 @@ func (db *DB) DeleteSQL(value interface{}, where ...interface{}) (*model.Expr, e
 	return &model.Expr{Q: e.Scope.SQL, Args: e.Scope.SQLVars}, nil
 }
 
+// Restore restores soft deleted records matching value and the given
+// conditions.
+//
+//	db.Restore(&user)
+func (db *DB) Restore(value interface{}, where ...interface{}) error {
+	e := db.engine()
+	defer db.recycle()
+	e.Scope.ContextValue(value)
+	search.Inline(e, where...)
+	return hooks.Restore(e)
+}
+
+// RestoreSQL generates SQL that will be executed when you use db.Restore
+func (db *DB) RestoreSQL(value interface{}, where ...interface{}) (*model.Expr, error) {
+	e := db.engine()
+	defer db.recycle()
+	e.Scope.ContextValue(value)
+	search.Inline(e, where...)
+	err := hooks.RestoreSQL(e)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Expr{Q: e.Scope.SQL, Args: e.Scope.SQLVars}, nil
+}
+
 // UpdateColumn update attributes without callbacks
+//
+// Unlike Update it doesn't check nor increment the version of a versioned
+// model, see model.Version.
 func (db *DB) UpdateColumn(attrs ...interface{}) error {
 	return db.UpdateColumns(util.ToSearchableMap(attrs...))
 }
 
-// UpdateColumns update attributes without
+// UpdateColumns update attributes without callbacks. Like UpdateColumn it
+// skips the version check of versioned models.
 func (db *DB) UpdateColumns(values interface{}) error {
 	if db.e == nil || db.e.Scope.Value == nil {
 		return errmsg.ErrMissingModel
@@ -902,22 +1532,75 @@ func (db *DB) Ping() error {
 
 // Preload preload associations with given conditions
 //    db.Preload("Orders", "state NOT IN (?)", "cancelled").Find(&users)
+//
+// The conditions of a nested schema like Orders.Items only apply to the last
+// level, each level can have its own conditions by preloading it too. A
+// condition can be a function which modifies the preload query.
+//
+//    db.Preload("Orders", func(db *DB) *DB {
+//        return db.Order("id desc").Limit(5)
+//    }).Preload("Orders.Items").Find(&users)
+//
+// Associations preloads all the associations of a model.
+//
+//    db.Preload(Associations).Find(&users)
 func (db *DB) Preload(column string, conditions ...interface{}) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
-	search.Preload(db.e, column, conditions...)
+	conds := make([]interface{}, len(conditions))
+	for i, c := range conditions {
+		if fn, ok := c.(func(*DB) *DB); ok {
+			c = db.preloadFunc(fn)
+		}
+		conds[i] = c
+	}
+	search.Preload(db.e, column, conds...)
 	return db
 }
 
-// FirstOrCreate find first matched record or create a new one with given
-//conditions (only works with struct, map conditions)
-func (db *DB) FirstOrCreate(out interface{}, where ...interface{}) error {
+// PreloadTree preloads the association column of a model referring to itself
+// to depth levels, with a query for each level. The conditions apply to all
+// the levels. This loads a subtree with a has_many association,
+//
+//    db.PreloadTree("Children", 3).First(&category, id)
+//
+// or the ancestors with a belongs_to association.
+//
+//    db.PreloadTree("Parent", 3).First(&category, id)
+func (db *DB) PreloadTree(column string, depth int, conditions ...interface{}) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
-	defer db.recycle()
-	db.e.Scope.ContextValue(out)
+	schema := column
+	for i := 0; i < depth; i++ {
+		db = db.Preload(schema, conditions...)
+		schema += "." + column
+	}
+	return db
+}
+
+// preloadFunc returns a preload condition which applies fn to the preload
+// query.
+func (db *DB) preloadFunc(fn func(*DB) *DB) hooks.PreloadFunc {
+	return func(e *engine.Engine) {
+		pdb := db.clone()
+		engine.Put(pdb.e)
+		pdb.e = e
+		if r := fn(pdb); r != nil && r.e != nil && r.e != e {
+			e.Search = r.e.Search
+		}
+	}
+}
+
+// FirstOrCreate find first matched record or create a new one with given
+//conditions (only works with struct, map conditions)
+func (db *DB) FirstOrCreate(out interface{}, where ...interface{}) error {
+	// the engine is used until the record is created or updated, and given
+	// back only once, when done.
+	e, done := db.terminal()
+	defer done()
+	e.Scope.ContextValue(out)
 	err := db.Begin().First(out, where...)
 	if err != nil {
 		if err != errmsg.ErrRecordNotFound {
@@ -925,15 +1608,17 @@ func (db *DB) FirstOrCreate(out interface{}, where ...interface{}) error {
 		}
 
 		// re use the existing engine
-		db.e.Scope.SQLVars = nil
-		db.e.Scope.SQL = ""
+		e.Scope.SQLVars = nil
+		e.Scope.SQL = ""
 
-		search.Inline(db.e, where...)
-		scope.Initialize(db.e)
-		return db.Create(out)
+		search.Inline(e, where...)
+		scope.Initialize(e)
+		return hooks.Create(e)
 	}
-	if len(db.e.Search.AssignAttrs) > 0 {
-		return db.Update(db.e.Search.AssignAttrs...)
+	if len(e.Search.AssignAttrs) > 0 {
+		e.Scope.Set(model.IgnoreProtectedAttrs, true)
+		e.Scope.Set(model.UpdateInterface, util.ToSearchableMap(e.Search.AssignAttrs))
+		return hooks.Update(e)
 	}
 	return nil
 }
@@ -975,23 +1660,46 @@ func (db *DB) AddForeignKeySQL(field string, dest string, onDelete string, onUpd
 	return sql, nil
 }
 
-// Association returns association object
+// Association returns association object. The model can be a slice of
+// records, Counts then returns the number of associated records of each record
+// and Append takes one value, or slice of values, for each record. Only the
+// rows of a many_to_many join table are inserted in a single statement, the
+// records of the other relationships are saved parent by parent.
+//
+//	a, err := db.Model(&users).Association("Languages")
+//	if err != nil {
+//		return err
+//	}
+//	counts, err := a.Counts()
 func (db *DB) Association(column string) (*Association, error) {
 	if db.e == nil || db.e.Scope.Value == nil {
 		return nil, errmsg.ErrMissingModel
 	}
-	p, err := scope.PrimaryField(db.e, db.e.Scope.Value)
-	if err != nil {
-		return nil, err
+	parents := []interface{}{db.e.Scope.Value}
+	if v := reflect.Indirect(db.e.Scope.ValueOf()); v.Kind() == reflect.Slice {
+		if v.Len() == 0 {
+			return nil, errors.New("association on an empty slice")
+		}
+		parents = parents[:0]
+		for i := 0; i < v.Len(); i++ {
+			parents = append(parents, parentAddr(v.Index(i)))
+		}
 	}
-	if p.IsBlank {
-		return nil, errors.New("primary field can not be blank")
+	for _, parent := range parents {
+		p, err := scope.PrimaryField(db.e, parent)
+		if err != nil {
+			return nil, err
+		}
+		if p.IsBlank {
+			return nil, errors.New("primary field can not be blank")
+		}
 	}
 	field, err := scope.FieldByName(db.e, db.e.Scope.Value, column)
 	if err != nil {
 		return nil, err
 	}
 	ndb := db.Begin()
+	search.Inherit(ndb.e, db.e)
 	ndb.e.Scope.ContextValue(db.e.Scope.Value)
 	ndb.e.Scope.Set(model.AssociationSource, db.e.Scope.Value)
 	if field.Relationship == nil || len(field.Relationship.ForeignFieldNames) == 0 {
@@ -1004,10 +1712,36 @@ func (db *DB) Association(column string) (*Association, error) {
 	return &Association{db: ndb, column: column, field: field}, nil
 }
 
-func (db *DB) related(source, value interface{}, foreignKeys ...string) error {
+func (db *DB) related(source, value interface{}, query []func(*DB) *DB, foreignKeys ...string) error {
+	ndb, err := db.relatedQuery(source, value, query, foreignKeys...)
+	if err != nil {
+		return err
+	}
+	return ndb.Find(value)
+}
+
+func (db *DB) relatedSQL(source, value interface{}, query []func(*DB) *DB, foreignKeys ...string) (*model.Expr, error) {
+	ndb, err := db.relatedQuery(source, value, query, foreignKeys...)
+	if err != nil {
+		return nil, err
+	}
+	return ndb.FindSQL(value)
+}
+
+// relatedQuery returns the query for the records related to source that are
+// loaded into value. The preloads, selects, order and soft delete scoping of
+// db are applied to the query.
+func (db *DB) relatedQuery(source, value interface{}, query []func(*DB) *DB, foreignKeys ...string) (*DB, error) {
 	sdb := db.Begin()
+	defer sdb.recycle()
 	sdb.e.Scope.ContextValue(source)
 	ndb := db.Begin()
+	if db.e != nil {
+		search.Inherit(ndb.e, db.e)
+	}
+	for _, q := range query {
+		ndb = q(ndb)
+	}
 	ndb.e.Scope.ContextValue(value)
 	sdb.e.Scope.Set(model.AssociationSource, source)
 
@@ -1030,7 +1764,7 @@ func (db *DB) related(source, value interface{}, foreignKeys ...string) error {
 			}
 			sql := fmt.Sprintf("%v = ?",
 				scope.Quote(ndb.e, toField.DBName))
-			return ndb.Where(sql, pfv).Find(value)
+			return ndb.Where(sql, pfv), nil
 		}
 
 		if rel := fromField.Relationship; rel != nil {
@@ -1039,17 +1773,36 @@ func (db *DB) related(source, value interface{}, foreignKeys ...string) error {
 				if isQL(db) {
 					err = scope.JoinWithQL(h, ndb.e, sdb.e.Scope.Value)
 					if err != nil {
-						return err
+						return nil, err
 					}
 				} else {
 					err = scope.JoinWith(h, ndb.e, sdb.e.Scope.Value)
 					if err != nil {
-						return err
+						return nil, err
 					}
 				}
 
-				return ndb.Find(value)
+				// joining sets the source as the scope value, we want to query
+				// the destination table.
+				ndb.e.Scope.ContextValue(value)
+				if ndb.e.Search.Selects == nil {
+					search.Select(ndb.e, scope.QualifiedColumns(ndb.e, value))
+				}
+				return ndb, nil
 			} else if rel.Kind == "belongs_to" {
+				if rel.IsPolymorphicBelongsTo() {
+					typ, err := scope.FieldByName(sdb.e, sdb.e.Scope.ValueOf(), rel.PolymorphicType)
+					if err != nil {
+						return nil, err
+					}
+					pv, err := scope.PolymorphicValue(ndb.e, rel, value)
+					if err != nil {
+						return nil, err
+					}
+					if util.ToString(typ.Field.Interface()) != pv {
+						return nil, errmsg.ErrRecordNotFound
+					}
+				}
 				for idx, foreignKey := range rel.ForeignDBNames {
 					if field, ok := scope.FieldByName(sdb.e, sdb.e.Scope.ValueOf(), foreignKey); ok == nil {
 						ndb = ndb.Where(fmt.Sprintf("%v = ?",
@@ -1057,7 +1810,7 @@ func (db *DB) related(source, value interface{}, foreignKeys ...string) error {
 							field.Field.Interface())
 					}
 				}
-				return ndb.Find(value)
+				return ndb, nil
 			} else if rel.Kind == "has_many" || rel.Kind == "has_one" {
 				for idx, foreignKey := range rel.ForeignDBNames {
 					field, err := scope.FieldByName(sdb.e, sdb.e.Scope.ValueOf(), rel.AssociationForeignDBNames[idx])
@@ -1072,27 +1825,40 @@ func (db *DB) related(source, value interface{}, foreignKeys ...string) error {
 					ndb = ndb.Where(fmt.Sprintf("%v = ?",
 						scope.Quote(ndb.e, rel.PolymorphicDBName)), rel.PolymorphicValue)
 				}
-				return ndb.Find(value)
+				return ndb, nil
 			}
 		} else {
 			pk, err := scope.PrimaryKey(sdb.e, value)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			sql := fmt.Sprintf("%v = ?",
 				scope.Quote(sdb.e, pk))
-			return ndb.Where(sql, fromField.Field.Interface()).Find(value)
+			return ndb.Where(sql, fromField.Field.Interface()), nil
 		}
-		return nil
-
+		break
 	}
-	return fmt.Errorf("invalid association %v", foreignKeys)
+	return nil, fmt.Errorf("invalid association %v", foreignKeys)
 }
 
-// Related get related associations
+// Related get related associations. The preloads, selects, order and
+// Unscoped set on db apply to the query of the related records.
+//
+//	db.Model(&user).Preload("Items").Related(&orders)
 func (db *DB) Related(value interface{}, foreignKeys ...string) error {
 	if db.e == nil || db.e.Scope.Value == nil {
 		return errmsg.ErrMissingModel
 	}
-	return db.related(db.e.Scope.Value, value, foreignKeys...)
+	defer db.recycle()
+	return db.related(db.e.Scope.Value, value, nil, foreignKeys...)
+}
+
+// RelatedSQL generates SQL query for getting the associations related to the
+// model.
+func (db *DB) RelatedSQL(value interface{}, foreignKeys ...string) (*model.Expr, error) {
+	if db.e == nil || db.e.Scope.Value == nil {
+		return nil, errmsg.ErrMissingModel
+	}
+	defer db.recycle()
+	return db.relatedSQL(db.e.Scope.Value, value, nil, foreignKeys...)
 }
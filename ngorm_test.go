@@ -1,13 +1,24 @@
 package ngorm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	_ "github.com/cznic/ql/driver"
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/fixture"
+	"github.com/ngorm/ngorm/hooks"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+	"github.com/ngorm/ql"
 )
 
 type Foo struct {
@@ -408,6 +419,84 @@ func testDBFind(t *testing.T, db *DB) {
 	}
 }
 
+type fooStuff struct {
+	Value string `gorm:"column:stuff"`
+}
+
+func TestDB_FindDestination(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFindDestination, &Foo{})
+	}
+}
+
+func testDBFindDestination(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := []string{"a", "b", "c"}
+	for _, v := range sample {
+		err := db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stuffs []fooStuff
+	err = db.Begin().Model(&Foo{}).Select("stuff").Order("stuff").Find(&stuffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stuffs) != len(sample) {
+		t.Fatalf("expected %d got %d", len(sample), len(stuffs))
+	}
+	for i, v := range sample {
+		if stuffs[i].Value != v {
+			t.Errorf("expected %s got %s", v, stuffs[i].Value)
+		}
+	}
+
+	var one fooStuff
+	err = db.Begin().Model(&Foo{}).Where("stuff = ?", "b").First(&one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.Value != "b" {
+		t.Errorf("expected b got %s", one.Value)
+	}
+
+	var rows []map[string]interface{}
+	err = db.Begin().Model(&Foo{}).Order("stuff").Find(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(sample) {
+		t.Fatalf("expected %d got %d", len(sample), len(rows))
+	}
+	if v := fmt.Sprint(rows[0]["stuff"]); v != "a" {
+		t.Errorf("expected a got %s", v)
+	}
+
+	row := map[string]interface{}{}
+	err = db.Begin().Model(&Foo{}).Where("stuff = ?", "c").First(&row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := fmt.Sprint(row["stuff"]); v != "c" {
+		t.Errorf("expected c got %s", v)
+	}
+
+	err = db.Begin().Model(&Foo{}).Where("stuff = ?", "z").First(&row)
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+	}
+
+	err = db.Begin().Find(&rows)
+	if err != errmsg.ErrMissingModel {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingModel, err)
+	}
+}
+
 func TestDB_FirstOrInit(t *testing.T) {
 	for _, d := range allTestDB() {
 		runWrapDB(t, d, testDBFirstOrInit, &Foo{})
@@ -584,309 +673,894 @@ func testDBCount(t *testing.T, db *DB) {
 	}
 }
 
-func TestDB_AddIndexSQL(t *testing.T) {
+func TestDB_BeginTx(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBAddIndexSQL, &Foo{})
+		runWrapDB(t, d, testDBBeginTx, &Foo{})
 	}
 }
 
-func testDBAddIndexSQL(t *testing.T, db *DB) {
+func testDBBeginTx(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = db.AddIndexSQL("_idx_foo_stuff", "stuff")
-	if err == nil {
-		t.Fatal("expected an error")
+	if err = db.Commit(); err != errmsg.ErrInvalidTransaction {
+		t.Errorf("expected %v got %v", errmsg.ErrInvalidTransaction, err)
 	}
-
-	sql, err := db.Model(&Foo{}).AddIndexSQL("_idx_foo_stuff", "stuff")
+	tx, err := db.BeginTx(context.Background(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddIndexSQL)
-	sql.Q = strings.TrimSpace(sql.Q)
-	if sql.Q != expect {
-		t.Errorf("expected %s got %s", expect, sql.Q)
-	}
-}
-
-func TestDB_AddIndex(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBAddIndex, &Foo{})
+	if _, err = tx.BeginTx(context.Background(), nil); err != errmsg.ErrCantStartTransaction {
+		t.Errorf("expected %v got %v", errmsg.ErrCantStartTransaction, err)
 	}
-}
-
-func testDBAddIndex(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+	err = tx.Create(&Foo{Stuff: "rollback"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	i := "idx_foo_stuff"
-	_, err = db.Model(&Foo{}).AddIndex(i, "stuff")
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	err = db.Model(&Foo{}).Count(&count)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be created")
+	if count != 0 {
+		t.Errorf("expected %d got %d", 0, count)
 	}
-}
 
-func TestDB_DeleteSQL(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBDeleteSQL)
+	tx, err = db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func testDBDeleteSQL(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+	err = tx.Create(&Foo{Stuff: "commit"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	sql, err := db.DeleteSQL(&Foo{ID: 10})
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Foo{}).Count(&count)
 	if err != nil {
 		t.Fatal(err)
 	}
-	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.DeleteSQL)
-	sql.Q = strings.TrimSpace(sql.Q)
-	if sql.Q != expect {
-		t.Errorf("expected %s got %s", expect, sql.Q)
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
 	}
 }
 
-func TestDB_Delete(t *testing.T) {
+func TestDB_Clauses(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBDelete, &Foo{})
+		runWrapDB(t, d, testDBClauses, &Foo{})
 	}
 }
 
-func testDBDelete(t *testing.T, db *DB) {
+func testDBClauses(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	f := Foo{Stuff: "halloween"}
-	err = db.Create(&f)
+	err = db.Create(&Foo{Stuff: "job"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if f.ID == 0 {
-		t.Fatalf("expected a new record to be created")
+	lock := model.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}
+	var foo Foo
+	err = db.Clauses(lock).First(&foo)
+	if dialects.IsQL(db.Dialect()) {
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		return
 	}
-
-	err = db.Delete(&f)
+	if err != errmsg.ErrLockWithoutTransaction {
+		t.Fatalf("expected %v got %v", errmsg.ErrLockWithoutTransaction, err)
+	}
+	tx, err := db.BeginTx(context.Background(), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	fu := Foo{}
-	err = db.Model(&Foo{ID: f.ID}).First(&fu)
-	if err == nil {
-		t.Fatal("expected an error")
-	}
-}
-
-func TestDB_AddUniqueIndex(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBAddUniqueIndex, &Foo{})
-	}
-}
-
-func testDBAddUniqueIndex(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	err = tx.Clauses(lock).First(&foo)
 	if err != nil {
 		t.Fatal(err)
 	}
-	i := "idx_foo_stuff"
-	ndb := db.Model(&Foo{})
-	_, err = ndb.AddUniqueIndex(i, "stuff")
+	if foo.Stuff != "job" {
+		t.Errorf("expected %s got %s", "job", foo.Stuff)
+	}
+	var count int64
+	err = tx.Model(&Foo{}).Clauses(lock).Count(&count)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be created")
-	}
-	q := ndb.e.Scope.SQL
-	q = strings.TrimSpace(q)
-	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddUniqueIndex)
-	if q != expect {
-		t.Errorf("expected %s got %s", expect, q)
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
 	}
 }
 
-func TestDB_RemoveIndex(t *testing.T) {
+type Article struct {
+	ID    int64
+	Title string
+	model.Version
+}
+
+func TestDB_OptimisticLocking(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBRemoveIndex, &Foo{})
+		runWrapDB(t, d, testDBOptimisticLocking, &Article{})
 	}
 }
 
-func testDBRemoveIndex(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+func testDBOptimisticLocking(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Article{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	i := "idx_foo_stuff"
-	ndb := db.Model(&Foo{})
-	_, err = ndb.AddUniqueIndex(i, "stuff")
+	a := Article{Title: "first"}
+	err = db.Create(&a)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be created")
+	if a.Version != 1 {
+		t.Errorf("expected %d got %d", 1, a.Version)
 	}
-	err = db.Model(&Foo{}).RemoveIndex(i)
+	var stale Article
+	err = db.First(&stale, a.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be gone")
+
+	a.Title = "second"
+	err = db.Save(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Version != 2 {
+		t.Errorf("expected %d got %d", 2, a.Version)
 	}
-}
 
-func TestDB_DropColumn(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBDropColumn, &Foo{})
+	stale.Title = "stale"
+	err = db.Save(&stale)
+	if err != errmsg.ErrStaleObject {
+		t.Errorf("expected %v got %v", errmsg.ErrStaleObject, err)
+	}
+	err = db.Model(&stale).Update("title", "stale")
+	if err != errmsg.ErrStaleObject {
+		t.Errorf("expected %v got %v", errmsg.ErrStaleObject, err)
 	}
-}
 
-func testDBDropColumn(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+	err = db.Model(&a).Update("title", "third")
 	if err != nil {
 		t.Fatal(err)
 	}
-	col := "stuff"
-	_, err = db.Model(&Foo{}).DropColumn(col)
+	if a.Version != 3 {
+		t.Errorf("expected %d got %d", 3, a.Version)
+	}
+	var got Article
+	err = db.First(&got, a.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if db.Dialect().HasColumn("foos", col) {
-		t.Error("expected column to be gone")
+	if got.Title != "third" {
+		t.Errorf("expected %s got %s", "third", got.Title)
 	}
-}
-
-func TestDB_FirstOrCreate(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBFirstOrCreate, &Foo{})
+	if got.Version != 3 {
+		t.Errorf("expected %d got %d", 3, got.Version)
 	}
-}
 
-func testDBFirstOrCreate(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+	// UpdateColumn skips the version, here to get a record from before the
+	// version column, at version 0.
+	err = db.Model(&a).UpdateColumn("version", 0)
 	if err != nil {
 		t.Fatal(err)
 	}
-	first := Foo{Stuff: "first"}
-	err = db.FirstOrCreate(&first)
+	var old, oldStale Article
+	err = db.First(&old, a.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if first.ID == 0 {
-		t.Error("expected a new record")
+	err = db.First(&oldStale, a.ID)
+	if err != nil {
+		t.Fatal(err)
 	}
-	second := Foo{}
-	err = db.Begin().Where(Foo{Stuff: first.Stuff}).FirstOrCreate(&second)
+	if old.Version != 0 {
+		t.Errorf("expected %d got %d", 0, old.Version)
+	}
+	old.Title = "fourth"
+	err = db.Save(&old)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if second.ID != first.ID {
-		t.Errorf("expected %d got %d", first.ID, second.ID)
+	if old.Version != 1 {
+		t.Errorf("expected %d got %d", 1, old.Version)
+	}
+	oldStale.Title = "stale"
+	err = db.Save(&oldStale)
+	if err != errmsg.ErrStaleObject {
+		t.Errorf("expected %v got %v", errmsg.ErrStaleObject, err)
 	}
 }
 
-func TestDB_Preload(t *testing.T) {
+type Trash struct {
+	model.Model
+	Name       string
+	TrashBinID int64
+}
+
+type TrashBin struct {
+	ID      int64
+	Name    string
+	Trashes []Trash
+}
+
+func TestDB_SoftDelete(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBPreload,
-			&fixture.User{},
-			&fixture.Email{},
-			&fixture.Language{},
-			&fixture.Company{},
-			&fixture.CreditCard{},
-			&fixture.Address{},
-		)
+		runWrapDB(t, d, testDBSoftDelete, &Trash{}, &TrashBin{})
 	}
 }
 
-func testDBPreload(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&fixture.User{},
-		&fixture.Email{},
-		&fixture.Language{},
-		&fixture.Company{},
-		&fixture.CreditCard{},
-		&fixture.Address{},
-	)
+func testDBSoftDelete(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Trash{}, &TrashBin{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	user1, err := getPreparedUser(db, "user1", "Preload")
+	bin := TrashBin{Name: "bin"}
+	err = db.Create(&bin)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = db.Begin().Save(user1)
+	for _, v := range []string{"a", "b", "c"} {
+		err = db.Create(&Trash{Name: v, TrashBinID: bin.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var a Trash
+	err = db.First(&a, "name = ?", "a")
 	if err != nil {
 		t.Fatal(err)
 	}
-	preloadDB := db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	var user fixture.User
-	err = preloadDB.Find(&user)
+	err = db.Delete(&a)
 	if err != nil {
 		t.Fatal(err)
 	}
-	checkUserHasPreloadData(db, user, t)
-
-	user2, err := getPreparedUser(db, "user2", "Preload")
+	count := func(q *DB) int64 {
+		var n int64
+		if err := q.Model(&Trash{}).Count(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(db.Begin()); n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+	var all []Trash
+	err = db.Begin().Unscoped().Find(&all)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = db.Begin().Save(user2)
+	if len(all) != 3 {
+		t.Errorf("expected %d got %d", 3, len(all))
+	}
+	var trashed []Trash
+	err = db.Begin().OnlyTrashed().Find(&trashed)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(trashed) != 1 {
+		t.Fatalf("expected %d got %d", 1, len(trashed))
+	}
+	if trashed[0].Name != "a" {
+		t.Errorf("expected %s got %s", "a", trashed[0].Name)
+	}
 
-	user3, err := getPreparedUser(db, "user3", "Preload")
+	var b TrashBin
+	err = db.Begin().Preload("Trashes").First(&b)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = db.Begin().Save(user3)
+	if len(b.Trashes) != 2 {
+		t.Errorf("expected %d got %d", 2, len(b.Trashes))
+	}
+	b = TrashBin{}
+	err = db.Begin().Unscoped().Preload("Trashes").First(&b)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	var users []fixture.User
-	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	err = preloadDB.Find(&users)
+	if len(b.Trashes) != 3 {
+		t.Errorf("expected %d got %d", 3, len(b.Trashes))
+	}
+	ass, err := db.Model(&b).Association("Trashes")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	for _, user := range users {
-		checkUserHasPreloadData(db, user, t)
+	if n, err := ass.Count(); err != nil || n != 2 {
+		t.Errorf("expected %d got %d %v", 2, n, err)
 	}
-
-	var users2 []*fixture.User
-	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	err = preloadDB.Find(&users2)
+	ass, err = db.Model(&b).Unscoped().Association("Trashes")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	for _, user := range users2 {
-		checkUserHasPreloadData(db, *user, t)
+	if n, err := ass.Count(); err != nil || n != 3 {
+		t.Errorf("expected %d got %d %v", 3, n, err)
+	}
+	var found []Trash
+	err = ass.Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 {
+		t.Errorf("expected %d got %d", 3, len(found))
 	}
 
-	var users3 []*fixture.User
-	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	err = preloadDB.Preload("Emails", "email = ?", user3.Emails[0].Email).Find(&users3)
+	err = db.Restore(&trashed[0])
 	if err != nil {
 		t.Fatal(err)
 	}
+	if trashed[0].DeletedAt != nil {
+		t.Errorf("expected deleted_at to be cleared got %v", trashed[0].DeletedAt)
+	}
+	if n := count(db.Begin()); n != 3 {
+		t.Errorf("expected %d got %d", 3, n)
+	}
 
-	for _, user := range users3 {
-		if user.Name == user3.Name {
-			if len(user.Emails) != 1 {
+	err = db.Begin().Unscoped().Delete(&trashed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	all = nil
+	err = db.Begin().Unscoped().Find(&all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected %d got %d", 2, len(all))
+	}
+}
+
+type FlagTrash struct {
+	ID        int64
+	Name      string
+	IsDeleted bool `gorm:"soft_delete"`
+}
+
+type UnixTrash struct {
+	ID        int64
+	Name      string
+	DeletedAt model.DeletedUnix
+}
+
+func TestDB_SoftDeleteStrategies(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBSoftDeleteStrategies, &FlagTrash{}, &UnixTrash{})
+	}
+}
+
+func testDBSoftDeleteStrategies(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&FlagTrash{}, &UnixTrash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := FlagTrash{Name: "flag"}
+	err = db.Create(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Delete(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags []FlagTrash
+	err = db.Begin().Find(&flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 0 {
+		t.Errorf("expected %d got %d", 0, len(flags))
+	}
+	err = db.Begin().OnlyTrashed().Find(&flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 1 {
+		t.Fatalf("expected %d got %d", 1, len(flags))
+	}
+	if !flags[0].IsDeleted {
+		t.Error("expected the record to be flagged as deleted")
+	}
+	err = db.Restore(&flags[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags[0].IsDeleted {
+		t.Error("expected the record to be restored")
+	}
+	err = db.Begin().Find(&flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 1 {
+		t.Errorf("expected %d got %d", 1, len(flags))
+	}
+
+	u := UnixTrash{Name: "unix"}
+	err = db.Create(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Delete(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unix []UnixTrash
+	err = db.Begin().Find(&unix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unix) != 0 {
+		t.Errorf("expected %d got %d", 0, len(unix))
+	}
+	err = db.Begin().Unscoped().Find(&unix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unix) != 1 {
+		t.Fatalf("expected %d got %d", 1, len(unix))
+	}
+	if unix[0].DeletedAt == 0 {
+		t.Error("expected deletion time to be set")
+	}
+}
+
+type Employer struct {
+	ID   int64
+	Name string
+}
+
+type Badge struct {
+	ID         int64
+	EmployeeID int64
+	Code       string
+}
+
+type Employee struct {
+	ID         int64
+	Name       string
+	EmployerID int64
+	Employer   Employer
+	Badge      *Badge
+}
+
+func TestDB_JoinsAssociation(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBJoinsAssociation, &Employee{}, &Employer{}, &Badge{})
+	}
+}
+
+func testDBJoinsAssociation(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Employee{}, &Employer{}, &Badge{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := Employer{Name: "acme"}
+	err = db.Create(&acme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Employee{Name: "alice", EmployerID: acme.ID}
+	err = db.Create(&alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Employee{Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Badge{EmployeeID: alice.ID, Code: "A1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var employees []Employee
+	err = db.Joins("Employer").Joins("Badge").Order("name").Find(&employees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(employees) != 2 {
+		t.Fatalf("expected %d got %d", 2, len(employees))
+	}
+	a, b := employees[0], employees[1]
+	if a.Employer.Name != "acme" || a.Employer.ID != acme.ID {
+		t.Errorf("expected %v got %v", acme, a.Employer)
+	}
+	if a.Badge == nil || a.Badge.Code != "A1" {
+		t.Errorf("expected badge A1 got %v", a.Badge)
+	}
+	if b.Employer.ID != 0 {
+		t.Errorf("expected no employer got %v", b.Employer)
+	}
+	if b.Badge != nil {
+		t.Errorf("expected no badge got %v", b.Badge)
+	}
+
+	var employee Employee
+	err = db.Joins("Employer").First(&employee, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if employee.Name != "alice" || employee.Employer.Name != "acme" {
+		t.Errorf("expected alice at acme got %s at %s", employee.Name, employee.Employer.Name)
+	}
+
+	err = db.Joins("Name").Find(&employees)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDB_AddIndexSQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAddIndexSQL, &Foo{})
+	}
+}
+
+func testDBAddIndexSQL(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.AddIndexSQL("_idx_foo_stuff", "stuff")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	sql, err := db.Model(&Foo{}).AddIndexSQL("_idx_foo_stuff", "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddIndexSQL)
+	sql.Q = strings.TrimSpace(sql.Q)
+	if sql.Q != expect {
+		t.Errorf("expected %s got %s", expect, sql.Q)
+	}
+}
+
+func TestDB_AddIndex(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAddIndex, &Foo{})
+	}
+}
+
+func testDBAddIndex(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := "idx_foo_stuff"
+	_, err = db.Model(&Foo{}).AddIndex(i, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be created")
+	}
+}
+
+func TestDB_DeleteSQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDeleteSQL)
+	}
+}
+
+func testDBDeleteSQL(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, err := db.DeleteSQL(&Foo{ID: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.DeleteSQL)
+	sql.Q = strings.TrimSpace(sql.Q)
+	if sql.Q != expect {
+		t.Errorf("expected %s got %s", expect, sql.Q)
+	}
+}
+
+func TestDB_Delete(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDelete, &Foo{})
+	}
+}
+
+func testDBDelete(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := Foo{Stuff: "halloween"}
+	err = db.Create(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ID == 0 {
+		t.Fatalf("expected a new record to be created")
+	}
+
+	err = db.Delete(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fu := Foo{}
+	err = db.Model(&Foo{ID: f.ID}).First(&fu)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDB_AddUniqueIndex(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAddUniqueIndex, &Foo{})
+	}
+}
+
+func testDBAddUniqueIndex(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := "idx_foo_stuff"
+	ndb := db.Model(&Foo{})
+	_, err = ndb.AddUniqueIndex(i, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be created")
+	}
+	q := ndb.e.Scope.SQL
+	q = strings.TrimSpace(q)
+	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddUniqueIndex)
+	if q != expect {
+		t.Errorf("expected %s got %s", expect, q)
+	}
+}
+
+func TestDB_RemoveIndex(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBRemoveIndex, &Foo{})
+	}
+}
+
+func testDBRemoveIndex(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := "idx_foo_stuff"
+	ndb := db.Model(&Foo{})
+	_, err = ndb.AddUniqueIndex(i, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be created")
+	}
+	err = db.Model(&Foo{}).RemoveIndex(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be gone")
+	}
+}
+
+func TestDB_DropColumn(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDropColumn, &Foo{})
+	}
+}
+
+func testDBDropColumn(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := "stuff"
+	_, err = db.Model(&Foo{}).DropColumn(col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Dialect().HasColumn("foos", col) {
+		t.Error("expected column to be gone")
+	}
+}
+
+func TestDB_FirstOrCreate(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFirstOrCreate, &Foo{})
+	}
+}
+
+func testDBFirstOrCreate(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := Foo{Stuff: "first"}
+	err = db.FirstOrCreate(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 {
+		t.Error("expected a new record")
+	}
+	second := Foo{}
+	err = db.Begin().Where(Foo{Stuff: first.Stuff}).FirstOrCreate(&second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected %d got %d", first.ID, second.ID)
+	}
+}
+
+func TestDB_FirstOrInit_concurrent(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFirstOrInitConcurrent, &Foo{})
+	}
+}
+
+func testDBFirstOrInitConcurrent(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"one", "two", "three", "four"}
+	for _, name := range names {
+		err = db.Create(&Foo{Stuff: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(names)*10)
+	for i := 0; i < len(names)*10; i++ {
+		name := names[i%len(names)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var foo Foo
+			err := db.FirstOrInit(&foo, Foo{Stuff: name})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if foo.ID == 0 || foo.Stuff != name {
+				errs <- fmt.Errorf("expected %s got %#v", name, foo)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if db.e != nil {
+		t.Error("expected the shared DB to have no engine")
+	}
+
+	// the engine of a chain is given back once, after the query is built.
+	q := db.Begin()
+	for _, name := range names {
+		expr, err := q.CreateSQL(&Foo{Stuff: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expr.Args) == 0 || expr.Args[len(expr.Args)-1] != name {
+			t.Errorf("expected %s to be the last argument got %v", name, expr.Args)
+		}
+	}
+}
+
+func TestDB_Preload(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreload,
+			&fixture.User{},
+			&fixture.Email{},
+			&fixture.Language{},
+			&fixture.Company{},
+			&fixture.CreditCard{},
+			&fixture.Address{},
+		)
+	}
+}
+
+func testDBPreload(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&fixture.User{},
+		&fixture.Email{},
+		&fixture.Language{},
+		&fixture.Company{},
+		&fixture.CreditCard{},
+		&fixture.Address{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user1, err := getPreparedUser(db, "user1", "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Save(user1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preloadDB := db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company")
+	var user fixture.User
+	err = preloadDB.Find(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUserHasPreloadData(db, user, t)
+
+	user2, err := getPreparedUser(db, "user2", "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Save(user2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user3, err := getPreparedUser(db, "user3", "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Save(user3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []fixture.User
+	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company")
+	err = preloadDB.Find(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users {
+		checkUserHasPreloadData(db, user, t)
+	}
+
+	var users2 []*fixture.User
+	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company")
+	err = preloadDB.Find(&users2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users2 {
+		checkUserHasPreloadData(db, *user, t)
+	}
+
+	var users3 []*fixture.User
+	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company")
+	err = preloadDB.Preload("Emails", "email = ?", user3.Emails[0].Email).Find(&users3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users3 {
+		if user.Name == user3.Name {
+			if len(user.Emails) != 1 {
 				t.Errorf("should only preload one emails for user3 when with condition")
 			}
 		} else if len(user.Emails) != 0 {
@@ -895,209 +1569,1542 @@ func testDBPreload(t *testing.T, db *DB) {
 			t.Errorf("should return an empty slice to indicate zero results")
 		}
 	}
-}
-
-func checkUserHasPreloadData(db *DB, user fixture.User, t *testing.T) {
-	u, err := getPreparedUser(db, user.Name, "Preload")
+}
+
+func checkUserHasPreloadData(db *DB, user fixture.User, t *testing.T) {
+	u, err := getPreparedUser(db, user.Name, "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.BillingAddress.Address1 != u.BillingAddress.Address1 {
+		t.Errorf("BillingAddress: expected %s got %s",
+			u.BillingAddress.Address1, user.BillingAddress.Address1)
+	}
+
+	if user.ShippingAddress.Address1 != u.ShippingAddress.Address1 {
+		t.Errorf("ShippingAddress: expected %s got %s",
+			u.ShippingAddress.Address1, user.ShippingAddress.Address1)
+	}
+
+	if user.CreditCard.Number != u.CreditCard.Number {
+		t.Errorf("CreditCard: expected %s got %s",
+			u.CreditCard.Number, user.CreditCard.Number)
+	}
+
+	if user.Company.Name != u.Company.Name {
+		t.Errorf(" Company: expected %s got %s", u.Company.Name, user.Company.Name)
+	}
+
+	if len(user.Emails) != len(u.Emails) {
+		t.Errorf("Emails: expected %d emails got %d", len(u.Emails), len(user.Emails))
+
+	} else {
+		var found int
+		for _, e1 := range u.Emails {
+			for _, e2 := range user.Emails {
+				if e1.Email == e2.Email {
+					found++
+					break
+				}
+			}
+		}
+		if found != len(u.Emails) {
+			t.Errorf("expected %d emails got %d", len(u.Emails), found)
+		}
+	}
+}
+
+func getPreparedUser(db *DB, name string, role string) (*fixture.User, error) {
+	var company fixture.Company
+	err := db.Begin().Where(fixture.Company{Name: role}).FirstOrCreate(&company)
+	if err != nil {
+		return nil, err
+	}
+	return &fixture.User{
+		Name:            name,
+		Age:             20,
+		Role:            fixture.Role{Name: role},
+		BillingAddress:  fixture.Address{Address1: fmt.Sprintf("Billing Address %v", name)},
+		ShippingAddress: fixture.Address{Address1: fmt.Sprintf("Shipping Address %v", name)},
+		CreditCard:      fixture.CreditCard{Number: fmt.Sprintf("123456%v", name)},
+		Emails: []fixture.Email{
+			{Email: fmt.Sprintf("user_%v@example1.com", name)}, {Email: fmt.Sprintf("user_%v@example2.com", name)},
+		},
+		Company: company,
+		Languages: []fixture.Language{
+			{Name: fmt.Sprintf("lang_1_%v", name)},
+			{Name: fmt.Sprintf("lang_2_%v", name)},
+		},
+	}, nil
+}
+
+func TestRelationship_Belongs_To(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, belongsTo,
+			&bUser{}, &bAddr{},
+		)
+	}
+}
+
+type Buyer struct {
+	ID        int64
+	Name      string
+	Wallet    Wallet
+	Purchases []Purchase
+}
+
+type Wallet struct {
+	ID      int64
+	BuyerID int64
+	Balance int64
+}
+
+type Purchase struct {
+	ID        int64
+	BuyerID   int64
+	Total     int64
+	LineItems []LineItem
+}
+
+type LineItem struct {
+	ID         int64
+	PurchaseID int64
+	Name       string
+}
+
+func TestDB_PreloadLevels(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadLevels,
+			&Buyer{}, &Wallet{}, &Purchase{}, &LineItem{},
+		)
+	}
+}
+
+func testDBPreloadLevels(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Buyer{}, &Wallet{}, &Purchase{}, &LineItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buyer := Buyer{
+		Name:   "buyer",
+		Wallet: Wallet{Balance: 10},
+		Purchases: []Purchase{
+			{Total: 1, LineItems: []LineItem{{Name: "a"}, {Name: "b"}}},
+			{Total: 2, LineItems: []LineItem{{Name: "c"}}},
+			{Total: 3, LineItems: []LineItem{{Name: "d"}}},
+		},
+	}
+	err = db.Begin().Save(&buyer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var all Buyer
+	err = db.Begin().Preload(Associations).First(&all, buyer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.Wallet.Balance != 10 {
+		t.Errorf("expected %d got %d", 10, all.Wallet.Balance)
+	}
+	if len(all.Purchases) != 3 {
+		t.Fatalf("expected %d got %d", 3, len(all.Purchases))
+	}
+	if len(all.Purchases[0].LineItems) != 0 {
+		t.Errorf("expected nested associations not to be preloaded got %v", all.Purchases[0].LineItems)
+	}
+
+	var nested Buyer
+	err = db.Begin().Preload("Purchases.*", "name != ?", "b").
+		Preload("Purchases", func(db *DB) *DB {
+			return db.Where("total > ?", 1).Order("total desc")
+		}).First(&nested, buyer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nested.Purchases) != 2 {
+		t.Fatalf("expected %d got %d", 2, len(nested.Purchases))
+	}
+	if nested.Purchases[0].Total != 3 {
+		t.Errorf("expected %d got %d", 3, nested.Purchases[0].Total)
+	}
+	if nested.Wallet.ID != 0 {
+		t.Errorf("expected wallet not to be preloaded got %v", nested.Wallet)
+	}
+	for _, p := range nested.Purchases {
+		if len(p.LineItems) != 1 {
+			t.Errorf("expected %d got %d", 1, len(p.LineItems))
+		}
+	}
+
+	var limited Buyer
+	err = db.Begin().Preload("Purchases", func(db *DB) *DB {
+		return db.Order("total").Limit(1)
+	}).Preload("Purchases.LineItems").First(&limited, buyer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited.Purchases) != 1 || limited.Purchases[0].Total != 1 {
+		t.Fatalf("expected the first purchase got %v", limited.Purchases)
+	}
+	if len(limited.Purchases[0].LineItems) != 2 {
+		t.Errorf("expected %d got %d", 2, len(limited.Purchases[0].LineItems))
+	}
+}
+
+func TestDB_PreloadLimitPerParent(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadLimitPerParent, &Purchase{}, &LineItem{})
+	}
+}
+
+func testDBPreloadLimitPerParent(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Purchase{}, &LineItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	purchases := []Purchase{
+		{Total: 1, LineItems: []LineItem{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+		{Total: 2, LineItems: []LineItem{{Name: "d"}}},
+		{Total: 3, LineItems: []LineItem{{Name: "e"}, {Name: "f"}}},
+	}
+	for i := range purchases {
+		err = db.Begin().Save(&purchases[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var found []Purchase
+	err = db.Begin().Preload("LineItems", func(db *DB) *DB {
+		return db.Order("name desc").LimitPerParent(2)
+	}).Order("total").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 {
+		t.Fatalf("expected %d got %d", 3, len(found))
+	}
+	expect := [][]string{{"c", "b"}, {"d"}, {"f", "e"}}
+	for i, p := range found {
+		var names []string
+		for _, item := range p.LineItems {
+			names = append(names, item.Name)
+		}
+		if !reflect.DeepEqual(names, expect[i]) {
+			t.Errorf("expected %v got %v", expect[i], names)
+		}
+	}
+}
+
+// windowDialect renders SQL like postgres, so that the window query is tested
+// without a postgres database.
+type windowDialect struct {
+	*ql.QL
+}
+
+func (windowDialect) GetName() string { return "postgres" }
+
+func (windowDialect) Quote(key string) string { return fmt.Sprintf(`"%s"`, key) }
+
+func (windowDialect) QueryFieldName(name string) string { return name + "." }
+
+func TestPreloadPerParentSQL(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = windowDialect{ql.Memory()}
+	m, err := scope.GetModelStruct(e, &Purchase{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rel *model.Relationship
+	for _, f := range m.StructFields {
+		if f.Name == "LineItems" {
+			rel = f.Relationship
+		}
+	}
+	e.Scope.ContextValue(&[]LineItem{})
+	search.Where(e, `"purchase_id" IN (?,?)`, 1, 2)
+	search.Order(e, "name desc")
+	err = hooks.PreloadPerParentSQL(e, rel, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := fixture.GetSQL("postgres", fixture.PerParentSQL)
+	if e.Scope.SQL != expect {
+		t.Errorf("expected %s got %s", expect, e.Scope.SQL)
+	}
+	if !reflect.DeepEqual(e.Scope.SQLVars, []interface{}{1, 2}) {
+		t.Errorf("expected [1 2] got %v", e.Scope.SQLVars)
+	}
+}
+
+type Category struct {
+	ID       int64
+	Name     string
+	ParentID *int64
+	Parent   *Category
+	Children []Category
+	Related  []*Category `gorm:"many2many:related_categories"`
+}
+
+func TestDB_PreloadTree(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadTree, &Category{}, "related_categories")
+	}
+}
+
+func testDBPreloadTree(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Category{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := Category{Name: "root", Children: []Category{
+		{Name: "a", Children: []Category{
+			{Name: "a1", Children: []Category{{Name: "a11"}}},
+		}},
+		{Name: "b"},
+	}}
+	err = db.Begin().Save(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tree Category
+	err = db.Begin().PreloadTree("Children", 2, func(db *DB) *DB {
+		return db.Order("name")
+	}).First(&tree, root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Name != "a" {
+		t.Fatalf("expected children [a b] got %v", tree.Children)
+	}
+	a := tree.Children[0]
+	if len(a.Children) != 1 || a.Children[0].Name != "a1" {
+		t.Fatalf("expected children [a1] got %v", a.Children)
+	}
+	if len(a.Children[0].Children) != 0 {
+		t.Errorf("expected the tree to be loaded to depth %d", 2)
+	}
+
+	var leaf Category
+	err = db.Begin().PreloadTree("Parent", 5).Where("name = ?", "a11").First(&leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ancestors []string
+	for p := leaf.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p.Name)
+	}
+	if !reflect.DeepEqual(ancestors, []string{"a1", "a", "root"}) {
+		t.Errorf("expected [a1 a root] got %v", ancestors)
+	}
+
+	assoc, err := db.Model(&tree).Association("Related")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = assoc.Append(&tree.Children[1], &Category{Name: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var related Category
+	err = db.Begin().Preload("Related", func(db *DB) *DB {
+		return db.Order("name")
+	}).First(&related, root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range related.Related {
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Errorf("expected [b c] got %v", names)
+	}
+	var b Category
+	err = db.Begin().Preload("Related").First(&b, tree.Children[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Related) != 0 {
+		t.Errorf("expected %d got %d", 0, len(b.Related))
+	}
+}
+
+func TestDB_RelatedSearch(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBRelatedSearch, &Category{}, "related_categories")
+	}
+}
+
+func testDBRelatedSearch(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Category{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := Category{Name: "root", Children: []Category{
+		{Name: "b"},
+		{Name: "a", Children: []Category{{Name: "a1"}}},
+	}}
+	err = db.Begin().Save(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var children []Category
+	err = db.Begin().Model(&root).Preload("Children").Order("name").
+		Related(&children, "Children")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[0].Name != "a" {
+		t.Fatalf("expected children [a b] got %v", children)
+	}
+	if len(children[0].Children) != 1 || children[0].Children[0].Name != "a1" {
+		t.Errorf("expected children [a1] got %v", children[0].Children)
+	}
+
+	sql, err := db.Begin().Model(&root).Order("name").RelatedSQL(&children, "Children")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.Q, "ORDER BY") {
+		t.Errorf("expected the order of the model query in %s", sql.Q)
+	}
+
+	assoc, err := db.Begin().Model(&root).Preload("Children").Association("Children")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children = nil
+	err = assoc.Order("name").Find(&children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || len(children[0].Children) != 1 {
+		t.Errorf("expected the preloaded children got %v", children)
+	}
+	sql, err = assoc.FindSQL(&children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.Q, "parent_id") {
+		t.Errorf("expected the foreign key condition in %s", sql.Q)
+	}
+}
+
+type bUser struct {
+	ID     int64
+	Addr   bAddr
+	AddrID int
+	Ship   bAddr
+	ShipID int64
+}
+
+type bAddr struct {
+	ID   int64
+	Name string
+}
+
+func belongsTo(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&bUser{}, &bAddr{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := "some name"
+	u := &bUser{
+		Addr: bAddr{Name: n},
+		Ship: bAddr{Name: n},
+	}
+	err = db.Begin().Create(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID == 0 {
+		t.Error("expected user to be created")
+	}
+	if u.AddrID == 0 {
+		t.Error("expected Addr to be created")
+	}
+	if u.ShipID == 0 {
+		t.Error("expected Ship to be created")
+	}
+}
+func TestDB_AddForeignKeySQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAddForeignKeySQL,
+			&fixture.User{},
+		)
+	}
+}
+func testAddForeignKeySQL(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&fixture.User{},
+	)
+	sql, err := db.Model(&fixture.User{}).AddForeignKeySQL("city_id", "cities(id)", "RESTRICT", "RESTRICT")
+	if isQL(db) {
+		if err == nil {
+			t.Error("expected an error")
+		}
+	} else {
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := `ALTER TABLE "users" ADD CONSTRAINT "users_city_id_cities_id_foreign" FOREIGN KEY ("city_id") REFERENCES cities(id) ON DELETE RESTRICT ON UPDATE RESTRICT;`
+		e = strings.TrimSpace(e)
+		sql = strings.TrimSpace(sql)
+		if e != sql {
+			t.Errorf("expected %s \n got %s", e, sql)
+		}
+	}
+
+}
+
+type Blog struct {
+	ID         int64  `gorm:"primary_key"`
+	Locale     string `gorm:"primary_key"`
+	Subject    string
+	Body       string
+	Tags       []Tag `gorm:"many2many:blog_tags;"`
+	SharedTags []Tag `gorm:"many2many:shared_blog_tags;ForeignKey:id;AssociationForeignKey:id"`
+	LocaleTags []Tag `gorm:"many2many:locale_blog_tags;ForeignKey:id,locale;AssociationForeignKey:id"`
+}
+
+type Tag struct {
+	ID     int64  `gorm:"primary_key"`
+	Locale string `gorm:"primary_key"`
+	Value  string
+	Blogs  []*Blog `gorm:"many2many:blogs_tags"`
+}
+
+func TestRelationship_Many_To_Many(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testRelManyToMany,
+			&Blog{},
+			&Tag{},
+		)
+	}
+}
+func testRelManyToMany(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&Blog{}, &Tag{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blog := Blog{
+		Locale:  "ZH",
+		Subject: "subject",
+		Body:    "body",
+		Tags: []Tag{
+			{Locale: "ZH", Value: "tag1"},
+			{Locale: "ZH", Value: "tag2"},
+		},
+	}
+	err = db.Begin().Save(&blog)
+	if err != nil {
+		t.Error(err)
+	}
+
+	a, err := db.Model(&blog).Association("Tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 2 {
+		t.Errorf("expected 2 got %d", c)
+	}
+}
+
+//go:generate go run ./cmd/ngorm-gen -type Planet,Moon -o planet_ngorm_test.go
+
+type Planet struct {
+	ID         int64
+	Name       string
+	Rings      *int
+	Discovered time.Time
+	Moons      []Moon
+}
+
+func TestDB_ShardFallback(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBShardFallback, &Shipment{})
+	}
+}
+
+func testDBShardFallback(t *testing.T, db *DB) {
+	err := db.Shard(model.ShardConfig{ShardKey: "user_id", Shards: 2, Fallback: "shipments"}, &Shipment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateTable(&Shipment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"shipments_00", "shipments_01", "shipments"} {
+		if !db.HasTable(table) {
+			t.Errorf("expected table %s to be created", table)
+		}
+	}
+	for _, s := range []Shipment{{UserID: 1, Item: "a"}, {Item: "b"}} {
+		err = db.Create(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	err = db.SQLCommon().QueryRow("SELECT count(*) FROM shipments").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected the shipment without a user in the fallback table got %d records", n)
+	}
+
+	var shipments []Shipment
+	err = db.Begin().Order("item").Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shipments) != 2 || shipments[0].Item != "a" || shipments[1].Item != "b" {
+		t.Errorf("expected the shipments of the shards and the fallback table got %v", shipments)
+	}
+	shipments = nil
+	err = db.Begin().Where("user_id = ?", 1).Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shipments) != 1 || shipments[0].Item != "a" {
+		t.Errorf("expected the shipment of user 1 got %v", shipments)
+	}
+
+	var b Shipment
+	err = db.Begin().Where("item = ?", "b").First(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Item = "c"
+	err = db.Save(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item string
+	err = db.SQLCommon().QueryRow("SELECT item FROM shipments").Scan(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item != "c" {
+		t.Errorf("expected the fallback record to be updated got %s", item)
+	}
+}
+
+type Moon struct {
+	ID       int64
+	PlanetID int64
+	Name     string
+}
+
+func TestDB_GeneratedScanner(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBGeneratedScanner, &Planet{}, &Moon{})
+	}
+}
+
+func testDBGeneratedScanner(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Planet{}, &Moon{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rings := 7
+	discovered := time.Date(1610, time.January, 7, 0, 0, 0, 0, time.UTC)
+	planets := []Planet{
+		{Name: "jupiter", Discovered: discovered, Moons: []Moon{{Name: "io"}, {Name: "europa"}}},
+		{Name: "saturn", Rings: &rings, Moons: []Moon{{Name: "titan"}}},
+	}
+	for i := range planets {
+		err = db.Begin().Save(&planets[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var _ model.ColumnScanner = &Planet{}
+	var _ model.FieldValuer = &Moon{}
+
+	var found []Planet
+	err = db.Begin().Preload("Moons", func(db *DB) *DB {
+		return db.Order("name")
+	}).Order("name").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected %d got %d", 2, len(found))
+	}
+	j, s := found[0], found[1]
+	if j.Name != "jupiter" || j.Rings != nil || !j.Discovered.Equal(discovered) {
+		t.Errorf("expected jupiter without rings got %v", j)
+	}
+	if s.Rings == nil || *s.Rings != rings {
+		t.Errorf("expected %d rings got %v", rings, s.Rings)
+	}
+	var moons []string
+	for _, m := range j.Moons {
+		moons = append(moons, m.Name)
+	}
+	if !reflect.DeepEqual(moons, []string{"europa", "io"}) {
+		t.Errorf("expected [europa io] got %v", moons)
+	}
+	if len(s.Moons) != 1 || s.Moons[0].PlanetID != s.ID {
+		t.Errorf("expected titan got %v", s.Moons)
+	}
+
+	var name []Planet
+	err = db.Begin().Select("name").Where("id = ?", s.ID).Find(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(name) != 1 || name[0].Name != "saturn" || name[0].ID != 0 {
+		t.Errorf("expected only the name got %v", name)
+	}
+}
+
+type Orbit struct {
+	ID       int64
+	Planet   Planet
+	TargetID int64
+	Target   interface{} `gorm:"polymorphic:Target"`
+}
+
+func TestDB_Preregister(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreregister)
+	}
+}
+
+func testDBPreregister(t *testing.T, db *DB) {
+	err := db.Preregister(&Planet{}, &Moon{}, &Category{}, &fixture.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Preregister(&Orbit{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, v := range []string{"Orbit: relationship Target: polymorphic field TargetType not found", "Orbit: no relationship found for field Planet"} {
+		if !strings.Contains(err.Error(), v) {
+			t.Errorf("expected %s in %v", v, err)
+		}
+	}
+	err = db.Preregister(1)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDB_PrepareStmt(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPrepareStmt, &Gopher{})
+	}
+}
+
+func testDBPrepareStmt(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Gopher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.PrepareStmt(2)
+	stmts := db.db.Stmts()
+	for _, name := range []string{"rob", "ken", "ian"} {
+		err = db.Create(&Gopher{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		var gophers []Gopher
+		err = db.Begin().Order("name").Find(&gophers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gophers) != 3 || gophers[0].Name != "ian" {
+			t.Errorf("expected [ian ken rob] got %v", gophers)
+		}
+	}
+	if stmts.Len() != 2 {
+		t.Errorf("expected %d got %d", 2, stmts.Len())
+	}
+	var n int
+	err = db.Model(&Gopher{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected %d got %d", 3, n)
+	}
+	if stmts.Len() != 2 {
+		t.Errorf("expected the cache to be limited to %d got %d", 2, stmts.Len())
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Begin().Where("name = ?", "ian").Delete(&Gopher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Gopher{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+
+	db.PrepareStmt(0)
+	if db.db.Stmts() != nil || stmts.Len() != 0 {
+		t.Error("expected the cache to be turned off")
+	}
+	db.PrepareStmt(10)
+	err = db.Model(&Gopher{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts = db.db.Stmts()
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmts.Len() != 0 {
+		t.Errorf("expected %d got %d", 0, stmts.Len())
+	}
+}
+
+func TestDB_Replicas(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBReplicas, &Planet{}, &Moon{})
+	}
+}
+
+func testDBReplicas(t *testing.T, db *DB) {
+	if !isQL(db) {
+		t.Skip("replicas are separate ql-mem databases")
+	}
+	_, err := db.Automigrate(&Planet{}, &Moon{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Planet{Name: "primary", Moons: []Moon{{Name: "primary moon"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replicas []model.SQLCommon
+	for _, name := range []string{"replica1", "replica2"} {
+		r, err := Open("ql-mem", name+".db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = r.Close() }()
+		_, err = r.Automigrate(&Planet{}, &Moon{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.Create(&Planet{Name: name, Moons: []Moon{{Name: name + " moon"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, r.db.SQLCommon)
+	}
+	err = db.Replicas(model.Replicas{DBs: replicas}, &Planet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// moons have no replicas, they are preloaded from the primary database.
+	for _, name := range []string{"replica1", "replica2", "replica1"} {
+		var planets []Planet
+		err = db.Begin().Preload("Moons").Find(&planets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(planets) != 1 || planets[0].Name != name {
+			t.Fatalf("expected %s got %v", name, planets)
+		}
+		if len(planets[0].Moons) != 1 || planets[0].Moons[0].Name != "primary moon" {
+			t.Errorf("expected the moons of the primary got %v", planets[0].Moons)
+		}
+	}
+	var names []string
+	err = db.Model(&Planet{}).Pluck("name", &names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "replica2" {
+		t.Errorf("expected [replica2] got %v", names)
+	}
+
+	db.PrepareStmt(8)
+	defer db.PrepareStmt(0)
+	for i := 0; i < 2; i++ {
+		var planets []Planet
+		err = db.Begin().Find(&planets)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wrappers := db.replicas()
+	if len(wrappers) != 2 {
+		t.Fatalf("expected 2 wrapped replicas got %d", len(wrappers))
+	}
+	for _, r := range wrappers {
+		if r.Stmts() == nil || r.Stmts().Len() != 1 {
+			t.Errorf("expected the replica to cache the statement of the query")
+		}
+	}
+
+	err = db.Create(&Planet{Name: "written"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = db.Model(&Planet{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected the count of a replica %d got %d", 1, n)
+	}
+	err = db.Model(&Planet{}).Clauses(model.UsePrimary).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected the count of the primary %d got %d", 2, n)
+	}
+	var written Planet
+	err = db.Begin().Clauses(model.UsePrimary).Where("name = ?", "written").First(&written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Model(&Planet{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected a transaction to read from the primary got %d records", n)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Replicas(model.Replicas{}, "planets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Planet{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected the replicas to be removed got %d records", n)
+	}
+}
+
+type Shipment struct {
+	ID      int64
+	UserID  int64
+	Item    string
+	Parcels []Parcel
+}
+
+type Parcel struct {
+	ID         int64
+	ShipmentID int64
+	Weight     int
+}
+
+func TestDB_Shard(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBShard, &Shipment{}, &Parcel{})
+	}
+}
+
+func testDBShard(t *testing.T, db *DB) {
+	err := db.Shard(model.ShardConfig{ShardKey: "user_id", Shards: 2}, &Shipment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Automigrate(&Shipment{}, &Parcel{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"shipments_00", "shipments_01"} {
+		if !db.HasTable(table) {
+			t.Errorf("expected table %s to be created", table)
+		}
+	}
+	for _, s := range []Shipment{{UserID: 1, Item: "a"}, {UserID: 2, Item: "b"}, {UserID: 3, Item: "c"}} {
+		err = db.Create(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	countShard := func(table string) int {
+		var n int
+		err := db.SQLCommon().QueryRow("SELECT count(*) FROM " + table).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := countShard("shipments_01"); n != 2 {
+		t.Errorf("expected %d records in shipments_01 got %d", 2, n)
+	}
+
+	var shipments []Shipment
+	err = db.Begin().Where("user_id = ?", 1).Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shipments) != 1 || shipments[0].Item != "a" {
+		t.Errorf("expected the shipment of user 1 got %v", shipments)
+	}
+	shipments = nil
+	err = db.Begin().Where(&Shipment{UserID: 2}).Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shipments) != 1 || shipments[0].Item != "b" {
+		t.Errorf("expected the shipment of user 2 got %v", shipments)
+	}
+	sql, err := db.Begin().Where("item = ? AND user_id = ?", "a", 1).FindSQL(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.Q, "shipments_01") {
+		t.Errorf("expected the query on shipments_01 got %s", sql.Q)
+	}
+
+	// without the shard key all the shards are queried.
+	shipments = nil
+	err = db.Begin().Order("item").Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []string
+	for _, s := range shipments {
+		items = append(items, s.Item)
+	}
+	if strings.Join(items, ",") != "a,b,c" {
+		t.Errorf("expected a,b,c got %v", items)
+	}
+	shipments = nil
+	err = db.Begin().Order("item desc").Offset(1).Limit(1).Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shipments) != 1 || shipments[0].Item != "b" {
+		t.Errorf("expected the limit to apply to all the shards got %v", shipments)
+	}
+
+	// the parcels are preloaded once, for the records left after the limit.
+	var top Shipment
+	err = db.Begin().Where("item = ?", "c").First(&top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Parcel{ShipmentID: top.ID, Weight: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	preloads := 0
+	shipments = nil
+	err = db.Begin().Preload("Parcels", func(db *DB) *DB {
+		preloads++
+		return db
+	}).Order("item desc").Limit(1).Find(&shipments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preloads != 1 {
+		t.Errorf("expected the parcels to be preloaded once got %d queries", preloads)
+	}
+	if len(shipments) != 1 || shipments[0].Item != "c" || len(shipments[0].Parcels) != 1 {
+		t.Errorf("expected shipment c with its parcel got %v", shipments)
+	}
+	var last Shipment
+	err = db.Begin().Last(&last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Item != "c" {
+		t.Errorf("expected the last shipment of all the shards got %v", last)
+	}
+	var groups []struct{ UserID int64 }
+	err = db.Model(&Shipment{}).Select("user_id").Group("user_id").Find(&groups)
+	if !errors.Is(err, errmsg.ErrShardFanOut) {
+		t.Errorf("expected %v got %v", errmsg.ErrShardFanOut, err)
+	}
+	var c Shipment
+	err = db.Begin().Where("item = ?", "c").First(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.UserID != 3 {
+		t.Errorf("expected the shipment of user 3 got %v", c)
+	}
+	err = db.Begin().Where("item = ?", "z").First(&Shipment{})
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+	}
+	var n int
+	err = db.Model(&Shipment{}).Count(&n)
+	if err != errmsg.ErrMissingShardKey {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingShardKey, err)
+	}
+
+	c.Item = "d"
+	err = db.Save(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Where("user_id = ?", 3).Delete(&Shipment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Shipment{}).Where("user_id = ?", 1).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected %d got %d", 1, n)
+	}
+	if n := countShard("shipments_01"); n != 1 {
+		t.Errorf("expected the shipment of user 3 to be deleted got %d records", n)
+	}
+}
+
+func TestDB_ShardDatabases(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBShardDatabases, &Moon{})
+	}
+}
+
+func testDBShardDatabases(t *testing.T, db *DB) {
+	if !isQL(db) {
+		t.Skip("shards are separate ql-mem databases")
+	}
+	var shards []*DB
+	var dbs []model.SQLCommon
+	for _, name := range []string{"shard0", "shard1"} {
+		s, err := Open("ql-mem", name+".db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = s.Close() }()
+		_, err = s.Automigrate(&Moon{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, s)
+		dbs = append(dbs, s.SQLCommon())
+	}
+	err := db.Shard(model.ShardConfig{ShardKey: "planet_id", Shards: 2, DBs: dbs}, &Moon{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []Moon{{PlanetID: 1, Name: "io"}, {PlanetID: 2, Name: "moon"}, {PlanetID: 1, Name: "europa"}} {
+		err = db.Create(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, expect := range []int{1, 2} {
+		var n int
+		err = shards[i].Model(&Moon{}).Count(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expect {
+			t.Errorf("shard%d: expected %d got %d", i, expect, n)
+		}
+	}
+	var moons []Moon
+	err = db.Begin().Where("planet_id = ?", 1).Order("name").Find(&moons)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if user.BillingAddress.Address1 != u.BillingAddress.Address1 {
-		t.Errorf("BillingAddress: expected %s got %s",
-			u.BillingAddress.Address1, user.BillingAddress.Address1)
+	if len(moons) != 2 || moons[0].Name != "europa" {
+		t.Errorf("expected [europa io] got %v", moons)
 	}
-
-	if user.ShippingAddress.Address1 != u.ShippingAddress.Address1 {
-		t.Errorf("ShippingAddress: expected %s got %s",
-			u.ShippingAddress.Address1, user.ShippingAddress.Address1)
+	moons = nil
+	err = db.Begin().Find(&moons)
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	if user.CreditCard.Number != u.CreditCard.Number {
-		t.Errorf("CreditCard: expected %s got %s",
-			u.CreditCard.Number, user.CreditCard.Number)
+	if len(moons) != 3 {
+		t.Errorf("expected %d got %d", 3, len(moons))
 	}
 
-	if user.Company.Name != u.Company.Name {
-		t.Errorf(" Company: expected %s got %s", u.Company.Name, user.Company.Name)
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&Moon{PlanetID: 1, Name: "ganymede"})
+	if err != errmsg.ErrShardTransaction {
+		t.Errorf("expected %v got %v", errmsg.ErrShardTransaction, err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
 	}
+}
 
-	if len(user.Emails) != len(u.Emails) {
-		t.Errorf("Emails: expected %d emails got %d", len(u.Emails), len(user.Emails))
+type Invoice struct {
+	ID       int64
+	TenantID int64
+	Amount   int
+}
 
-	} else {
-		var found int
-		for _, e1 := range u.Emails {
-			for _, e2 := range user.Emails {
-				if e1.Email == e2.Email {
-					found++
-					break
-				}
-			}
-		}
-		if found != len(u.Emails) {
-			t.Errorf("expected %d emails got %d", len(u.Emails), found)
-		}
+func TestDB_Tenancy(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBTenancy, &Invoice{}, &Gopher{})
 	}
 }
 
-func getPreparedUser(db *DB, name string, role string) (*fixture.User, error) {
-	var company fixture.Company
-	err := db.Begin().Where(fixture.Company{Name: role}).FirstOrCreate(&company)
+func testDBTenancy(t *testing.T, db *DB) {
+	db.Tenancy(model.Tenancy{})
+	_, err := db.Automigrate(&Invoice{}, &Gopher{})
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
+	}
+	ctx1 := model.WithTenant(context.Background(), int64(1))
+	ctx2 := model.WithTenant(context.Background(), int64(2))
+	for _, v := range []struct {
+		ctx    context.Context
+		amount int
+	}{
+		{ctx1, 10}, {ctx2, 20}, {ctx2, 30},
+	} {
+		i := Invoice{Amount: v.amount}
+		err = db.WithContext(v.ctx).Create(&i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tenant, _ := model.TenantFromContext(v.ctx)
+		if i.TenantID != tenant {
+			t.Errorf("expected tenant %v got %d", tenant, i.TenantID)
+		}
+	}
+	err = db.Create(&Invoice{Amount: 40})
+	if err != errmsg.ErrMissingTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingTenant, err)
+	}
+	err = db.WithContext(ctx1).Create(&Invoice{TenantID: 2, Amount: 40})
+	if err != errmsg.ErrWrongTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrWrongTenant, err)
 	}
-	return &fixture.User{
-		Name:            name,
-		Age:             20,
-		Role:            fixture.Role{Name: role},
-		BillingAddress:  fixture.Address{Address1: fmt.Sprintf("Billing Address %v", name)},
-		ShippingAddress: fixture.Address{Address1: fmt.Sprintf("Shipping Address %v", name)},
-		CreditCard:      fixture.CreditCard{Number: fmt.Sprintf("123456%v", name)},
-		Emails: []fixture.Email{
-			{Email: fmt.Sprintf("user_%v@example1.com", name)}, {Email: fmt.Sprintf("user_%v@example2.com", name)},
-		},
-		Company: company,
-		Languages: []fixture.Language{
-			{Name: fmt.Sprintf("lang_1_%v", name)},
-			{Name: fmt.Sprintf("lang_2_%v", name)},
-		},
-	}, nil
-}
 
-func TestRelationship_Belongs_To(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, belongsTo,
-			&bUser{}, &bAddr{},
-		)
+	// models without a tenant column are not scoped.
+	err = db.Create(&Gopher{Name: "rob"})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-type bUser struct {
-	ID     int64
-	Addr   bAddr
-	AddrID int
-	Ship   bAddr
-	ShipID int64
-}
+	var invoices []Invoice
+	err = db.Begin().Find(&invoices)
+	if err != errmsg.ErrMissingTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingTenant, err)
+	}
+	err = db.Begin().WithContext(ctx2).Order("amount").Find(&invoices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 2 || invoices[0].Amount != 20 {
+		t.Errorf("expected the invoices of tenant 2 got %v", invoices)
+	}
+	sql, err := db.Begin().WithContext(ctx2).Where("amount > ?", 0).FindSQL(&invoices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.Q, "tenant_id") || len(sql.Args) != 2 || sql.Args[0] != int64(2) {
+		t.Errorf("expected the query to be scoped to tenant 2 got %s %v", sql.Q, sql.Args)
+	}
+	found, err := G[Invoice](db).WithContext(ctx1).Find()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Amount != 10 {
+		t.Errorf("expected the invoice of tenant 1 got %v", found)
+	}
+	var n int
+	err = db.WithContext(ctx1).Model(&Invoice{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected %d got %d", 1, n)
+	}
 
-type bAddr struct {
-	ID   int64
-	Name string
-}
+	err = db.WithContext(ctx1).Model(&Invoice{}).Where("amount > ?", 0).Update("amount", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithContext(ctx2).Where("amount = ?", 5).Delete(&Invoice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first Invoice
+	err = db.WithContext(ctx2).FirstOrCreate(&first, Invoice{Amount: 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.TenantID != 2 {
+		t.Errorf("expected the record to be created for tenant 2 got %v", first)
+	}
 
-func belongsTo(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&bUser{}, &bAddr{},
-	)
+	// updates keep the records in their tenant.
+	err = db.WithContext(ctx1).Model(&Invoice{}).Where("amount = ?", 5).Update("tenant_id", 2)
+	if err != errmsg.ErrWrongTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrWrongTenant, err)
+	}
+	var moved Invoice
+	err = db.WithContext(ctx1).First(&moved, "amount = ?", 5)
 	if err != nil {
 		t.Fatal(err)
 	}
-	n := "some name"
-	u := &bUser{
-		Addr: bAddr{Name: n},
-		Ship: bAddr{Name: n},
+	moved.TenantID = 2
+	err = db.WithContext(ctx1).Save(&moved)
+	if err != errmsg.ErrWrongTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrWrongTenant, err)
 	}
-	err = db.Begin().Create(u)
+	blank := Invoice{ID: moved.ID, Amount: 5}
+	err = db.WithContext(ctx1).Save(&blank)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if u.ID == 0 {
-		t.Error("expected user to be created")
+	if blank.TenantID != 1 {
+		t.Errorf("expected the record to stay in tenant 1 got %v", blank)
 	}
-	if u.AddrID == 0 {
-		t.Error("expected Addr to be created")
+
+	invoices = nil
+	err = db.Begin().UnscopedTenant().Order("amount").Find(&invoices)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if u.ShipID == 0 {
-		t.Error("expected Ship to be created")
+	var amounts []int
+	for _, i := range invoices {
+		amounts = append(amounts, i.Amount)
+	}
+	if fmt.Sprint(amounts) != "[5 20 30 99]" {
+		t.Errorf("expected [5 20 30 99] got %v", amounts)
 	}
 }
-func TestDB_AddForeignKeySQL(t *testing.T) {
+
+func TestDB_Tenancy_concurrent(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testAddForeignKeySQL,
-			&fixture.User{},
-		)
+		runWrapDB(t, d, testDBTenancyConcurrent, &Invoice{})
 	}
 }
-func testAddForeignKeySQL(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&fixture.User{},
-	)
-	sql, err := db.Model(&fixture.User{}).AddForeignKeySQL("city_id", "cities(id)", "RESTRICT", "RESTRICT")
-	if isQL(db) {
-		if err == nil {
-			t.Error("expected an error")
-		}
-	} else {
+
+func testDBTenancyConcurrent(t *testing.T, db *DB) {
+	db.Tenancy(model.Tenancy{})
+	_, err := db.Automigrate(&Invoice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := []int64{1, 2}
+	for _, tenant := range tenants {
+		ctx := model.WithTenant(context.Background(), tenant)
+		err = db.WithContext(ctx).Create(&Invoice{Amount: int(tenant) * 10})
 		if err != nil {
 			t.Fatal(err)
 		}
-		e := `ALTER TABLE "users" ADD CONSTRAINT "users_city_id_cities_id_foreign" FOREIGN KEY ("city_id") REFERENCES cities(id) ON DELETE RESTRICT ON UPDATE RESTRICT;`
-		e = strings.TrimSpace(e)
-		sql = strings.TrimSpace(sql)
-		if e != sql {
-			t.Errorf("expected %s \n got %s", e, sql)
-		}
 	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		tenant := tenants[i%len(tenants)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := model.WithTenant(context.Background(), tenant)
+			var invoices []Invoice
+			var err error
+			if tenant == 1 {
+				err = db.WithContext(ctx).Find(&invoices)
+			} else {
+				err = db.UnscopedTenant().WithContext(ctx).Where("tenant_id = ?", tenant).Find(&invoices)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			if len(invoices) != 1 || invoices[0].TenantID != tenant {
+				errs <- fmt.Errorf("expected the invoice of tenant %d got %v", tenant, invoices)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if db.e != nil {
+		t.Error("expected the shared DB to have no engine")
+	}
+}
 
+type Post struct {
+	ID        int64
+	Title     string
+	Published bool
+	EditorID  int64
+	Editor    *Editor
 }
 
-type Blog struct {
-	ID         int64  `gorm:"primary_key"`
-	Locale     string `gorm:"primary_key"`
-	Subject    string
-	Body       string
-	Tags       []Tag `gorm:"many2many:blog_tags;"`
-	SharedTags []Tag `gorm:"many2many:shared_blog_tags;ForeignKey:id;AssociationForeignKey:id"`
-	LocaleTags []Tag `gorm:"many2many:locale_blog_tags;ForeignKey:id,locale;AssociationForeignKey:id"`
+type Editor struct {
+	ID        int64
+	Name      string
+	Published bool
 }
 
-type Tag struct {
-	ID     int64  `gorm:"primary_key"`
-	Locale string `gorm:"primary_key"`
-	Value  string
-	Blogs  []*Blog `gorm:"many2many:blogs_tags"`
+func (Post) DefaultScope() model.Expr {
+	return model.Expr{Q: "published = ?", Args: []interface{}{true}}
 }
 
-func TestRelationship_Many_To_Many(t *testing.T) {
+func TestDB_Scopes(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testRelManyToMany,
-			&Blog{},
-			&Tag{},
-		)
+		runWrapDB(t, d, testDBScopes, &Post{}, &Editor{})
 	}
 }
-func testRelManyToMany(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&Blog{}, &Tag{},
-	)
+
+func testDBScopes(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Post{}, &Editor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor := Editor{Name: "ann"}
+	err = db.Create(&editor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []Post{
+		{Title: "go", Published: true, EditorID: editor.ID},
+		{Title: "sql", Published: true},
+		{Title: "draft"},
+	} {
+		err = db.Create(&a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var posts []Post
+	err = db.Begin().Order("title").Find(&posts)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(posts) != 2 || posts[0].Title != "go" {
+		t.Errorf("expected the published posts got %v", posts)
+	}
 
-	blog := Blog{
-		Locale:  "ZH",
-		Subject: "subject",
-		Body:    "body",
-		Tags: []Tag{
-			{Locale: "ZH", Value: "tag1"},
-			{Locale: "ZH", Value: "tag2"},
-		},
+	// the editors have a published column too.
+	posts = nil
+	err = db.Begin().Joins("Editor").Order("title").Find(&posts)
+	if err != nil {
+		t.Fatal(err)
 	}
-	err = db.Begin().Save(&blog)
+	if len(posts) != 2 || posts[0].Editor == nil || posts[0].Editor.Name != "ann" {
+		t.Errorf("expected the published posts with their editor got %v", posts)
+	}
+	var n int
+	err = db.Model(&Post{}).Count(&n)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected %d got %d", 2, n)
+	}
+	err = db.Model(&Post{}).Unscoped().Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected %d got %d", 3, n)
 	}
 
-	a, err := db.Model(&blog).Association("Tags")
+	titled := func(title string) func(*DB) *DB {
+		return func(db *DB) *DB {
+			return db.Where("title = ?", title)
+		}
+	}
+	unscoped := func(db *DB) *DB {
+		return db.Unscoped()
+	}
+	posts = nil
+	scoped := db.Scopes(titled("draft"))
+	if db.e != nil {
+		t.Error("expected the shared DB to have no engine")
+	}
+	err = scoped.Find(&posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 0 {
+		t.Errorf("expected the draft to be out of the default scope got %v", posts)
+	}
+	err = db.Begin().Scopes(titled("draft"), unscoped).Find(&posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].Published {
+		t.Errorf("expected the draft got %v", posts)
+	}
+	found, err := G[Post](db).Scopes(titled("sql")).Find()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(found) != 1 || found[0].Title != "sql" {
+		t.Errorf("expected the sql article got %v", found)
+	}
 
-	c, err := a.Count()
+	err = db.Model(&Post{}).Where("title = ?", "draft").Update("published", true)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if c != 2 {
-		t.Errorf("expected 2 got %d", c)
+	err = db.Model(&Post{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected the update to skip the draft got %d published", n)
+	}
+	err = db.Model(&Post{}).Unscoped().Where("title = ?", "draft").Update("published", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Post{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected the draft to be published got %d published", n)
 	}
 }
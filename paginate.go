@@ -0,0 +1,321 @@
+package ngorm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+)
+
+// Page describes a page of records found with Paginate.
+type Page struct {
+	// Page is the number of the page, starting at 1.
+	Page    int
+	PerPage int
+
+	// Total is the number of records matching the query, on all the pages.
+	Total   int64
+	Pages   int
+	HasNext bool
+}
+
+// Paginator finds the records of a page, see Paginate.
+type Paginator struct {
+	db      *DB
+	page    int
+	perPage int
+}
+
+// Paginate splits the records of the query in pages of perPage records. Find
+// returns the records of page, the first page being 1, along with the total
+// number of records.
+//
+//	page, err := db.Where("active = ?", true).Order("name").Paginate(2, 20).Find(&users)
+//
+// Like WithContext it starts a new query when db has none, so it is safe to
+// call on a DB shared by concurrent requests.
+func (db *DB) Paginate(page, perPage int) *Paginator {
+	if db.e == nil {
+		db = db.clone()
+	}
+	return &Paginator{db: db, page: page, perPage: perPage}
+}
+
+// Find finds the records of the page. The records are counted with the
+// conditions of the query, without its order, limit and offset.
+func (p *Paginator) Find(out interface{}, where ...interface{}) (Page, error) {
+	db := p.db
+	defer db.recycle()
+	if p.page < 1 || p.perPage < 1 {
+		return Page{}, errmsg.ErrInvalidPage
+	}
+	search.Inline(db.e, where...)
+	var total int64
+	err := db.countAll(out).Count(&total)
+	if err != nil {
+		return Page{}, err
+	}
+	pages := int((total + int64(p.perPage) - 1) / int64(p.perPage))
+	err = db.Offset((p.page - 1) * p.perPage).Limit(p.perPage).Find(out)
+	if err != nil {
+		return Page{}, err
+	}
+	return Page{
+		Page:    p.page,
+		PerPage: p.perPage,
+		Total:   total,
+		Pages:   pages,
+		HasNext: p.page < pages,
+	}, nil
+}
+
+// countAll returns a query counting all the records matching the conditions
+// of db, out being the model when db has none.
+func (db *DB) countAll(out interface{}) *DB {
+	c := db.clone()
+	c.e.SQLDB = db.e.SQLDB
+	c.e.Search = db.e.Search.Clone()
+	c.e.Search.Limit = nil
+	c.e.Search.Offset = nil
+	c.e.Search.Preload = nil
+	c.e.Search.Selects = nil
+	c.e.Scope.Value = db.e.Scope.Value
+	if c.e.Scope.Value == nil {
+		c.e.Scope.Value = out
+	}
+	return c
+}
+
+// CursorPage describes a page of records found with PaginateCursor.
+type CursorPage struct {
+	// Next is the cursor of the next page, empty when HasNext is false.
+	Next    string
+	HasNext bool
+}
+
+// CursorPaginator finds the records after a cursor, see PaginateCursor.
+type CursorPaginator struct {
+	db      *DB
+	cursor  string
+	perPage int
+	keys    []string
+}
+
+// PaginateCursor splits the records of the query in pages of perPage records
+// ordered by the key columns, which default to the primary key. A key can be
+// followed by DESC to order by it in descending order, with ql all the keys
+// must be in the same order. The keys must identify a record, add the primary
+// key to them otherwise.
+//
+// Find returns the records following cursor, the records of the first page
+// when cursor is empty, and the cursor of the next page. Unlike Paginate the
+// records are selected by the values of the keys of the last record of the
+// previous page, so pages don't shift when records are added and the deep
+// pages are as fast as the first ones. The cursors are opaque, they are meant
+// to be handed to the clients as is.
+//
+//	page, err := db.PaginateCursor(cursor, 20, "created_at DESC", "id DESC").Find(&posts)
+//	// page.Next is the cursor of the following page.
+func (db *DB) PaginateCursor(cursor string, perPage int, keys ...string) *CursorPaginator {
+	if db.e == nil {
+		db = db.clone()
+	}
+	return &CursorPaginator{db: db, cursor: cursor, perPage: perPage, keys: keys}
+}
+
+// cursorKey is a column records are paginated by.
+type cursorKey struct {
+	column string
+	field  string
+	typ    reflect.Type
+	desc   bool
+}
+
+// Find finds the records of the page. The order of the query is replaced by
+// the order of the keys.
+func (p *CursorPaginator) Find(out interface{}, where ...interface{}) (CursorPage, error) {
+	db := p.db
+	defer db.recycle()
+	if p.perPage < 1 {
+		return CursorPage{}, errmsg.ErrInvalidPage
+	}
+	records := reflect.Indirect(reflect.ValueOf(out))
+	if records.Kind() != reflect.Slice {
+		return CursorPage{}, fmt.Errorf("ngorm: cursor pagination needs a slice, not %s", records.Kind())
+	}
+	value := db.e.Scope.Value
+	if value == nil {
+		value = out
+	}
+	keys, err := db.cursorKeys(value, p.keys)
+	if err != nil {
+		return CursorPage{}, err
+	}
+	search.Inline(db.e, where...)
+	qualifier := scope.FieldQualifier(db.e, value)
+	if p.cursor != "" {
+		values, err := decodeCursor(p.cursor, keys)
+		if err != nil {
+			return CursorPage{}, err
+		}
+		query, args := cursorCondition(keys, values, func(k cursorKey) string {
+			return qualifier + scope.Quote(db.e, k.column)
+		})
+		search.Where(db.e, query, args...)
+	}
+	order, err := cursorOrder(db, keys, qualifier)
+	if err != nil {
+		return CursorPage{}, err
+	}
+	search.Order(db.e, order, true)
+	err = db.Limit(p.perPage + 1).Find(out)
+	if err != nil {
+		return CursorPage{}, err
+	}
+	if records.Len() <= p.perPage {
+		return CursorPage{}, nil
+	}
+	records.Set(records.Slice(0, p.perPage))
+	next, err := encodeCursor(reflect.Indirect(records.Index(p.perPage-1)), keys)
+	if err != nil {
+		return CursorPage{}, err
+	}
+	return CursorPage{Next: next, HasNext: true}, nil
+}
+
+// cursorKeys returns the keys of value named by columns, the primary key when
+// there are no columns.
+func (db *DB) cursorKeys(value interface{}, columns []string) ([]cursorKey, error) {
+	m, err := scope.GetModelStruct(db.e, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		for _, f := range m.PrimaryFields {
+			columns = append(columns, f.DBName)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("ngorm: %s has no primary key to paginate by", m.ModelType)
+	}
+	keys := make([]cursorKey, 0, len(columns))
+	for _, c := range columns {
+		parts := strings.Fields(c)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("ngorm: invalid cursor key %q", c)
+		}
+		k := cursorKey{column: parts[0]}
+		if len(parts) == 2 {
+			switch strings.ToUpper(parts[1]) {
+			case "ASC":
+			case "DESC":
+				k.desc = true
+			default:
+				return nil, fmt.Errorf("ngorm: invalid cursor key %q", c)
+			}
+		}
+		for _, f := range m.StructFields {
+			if f.IsNormal && (f.DBName == k.column || f.Name == k.column) {
+				k.column = f.DBName
+				k.field = f.Name
+				k.typ = f.Struct.Type
+			}
+		}
+		if k.field == "" {
+			return nil, fmt.Errorf("ngorm: unknown cursor key %s", k.column)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// cursorOrder returns the ORDER BY expression of keys. ql only supports a
+// single direction for all the columns of ORDER BY.
+func cursorOrder(db *DB, keys []cursorKey, qualifier string) (string, error) {
+	columns := make([]string, len(keys))
+	for i, k := range keys {
+		columns[i] = qualifier + scope.Quote(db.e, k.column)
+		if k.desc != keys[0].desc && isQL(db) {
+			return "", errors.New("ngorm: ql can't order the cursor keys in different directions")
+		}
+		if k.desc && !isQL(db) {
+			columns[i] += " DESC"
+		}
+	}
+	order := strings.Join(columns, ",")
+	if keys[0].desc && isQL(db) {
+		order += " DESC"
+	}
+	return order, nil
+}
+
+// cursorCondition returns the condition matching the records after values,
+// the values of keys of the last record of the previous page.
+//
+// For the keys a, b it is a > ? OR (a = ? AND b > ?). Row values comparisons
+// are not used, they are not supported by all the databases and can't mix
+// ascending and descending keys.
+func cursorCondition(keys []cursorKey, values []interface{}, column func(cursorKey) string) (string, []interface{}) {
+	var or []string
+	var args []interface{}
+	for i, k := range keys {
+		var and []string
+		for j := 0; j < i; j++ {
+			and = append(and, column(keys[j])+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if k.desc {
+			op = " < ?"
+		}
+		and = append(and, column(k)+op)
+		args = append(args, values[i])
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+// encodeCursor returns the cursor of the records following record.
+func encodeCursor(record reflect.Value, keys []cursorKey) (string, error) {
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		f := record.FieldByName(k.field)
+		if !f.IsValid() {
+			return "", fmt.Errorf("ngorm: missing cursor key %s in %s", k.field, record.Type())
+		}
+		values[i] = f.Interface()
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the values of keys encoded in cursor, with the types of
+// the fields of the keys.
+func decodeCursor(cursor string, keys []cursorKey) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errmsg.ErrInvalidCursor
+	}
+	var raw []json.RawMessage
+	if json.Unmarshal(b, &raw) != nil || len(raw) != len(keys) {
+		return nil, errmsg.ErrInvalidCursor
+	}
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		v := reflect.New(k.typ)
+		if json.Unmarshal(raw[i], v.Interface()) != nil {
+			return nil, errmsg.ErrInvalidCursor
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
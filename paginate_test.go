@@ -0,0 +1,172 @@
+package ngorm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ngorm/ngorm/errmsg"
+)
+
+type Entry struct {
+	ID    int64
+	Title string
+	Score int
+}
+
+func createEntries(t *testing.T, db *DB, n int) {
+	_, err := db.Automigrate(&Entry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err = db.Create(&Entry{Title: string(rune('a' + i)), Score: i % 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDB_Paginate(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPaginate, &Entry{})
+	}
+}
+
+func testDBPaginate(t *testing.T, db *DB) {
+	createEntries(t, db, 7)
+	var entries []Entry
+	page, err := db.Begin().Order("title").Paginate(2, 3).Find(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Page{Page: 2, PerPage: 3, Total: 7, Pages: 3, HasNext: true}
+	if page != expect {
+		t.Errorf("expected %+v got %+v", expect, page)
+	}
+	if len(entries) != 3 || entries[0].Title != "d" || entries[2].Title != "f" {
+		t.Errorf("expected d to f got %v", entries)
+	}
+
+	entries = nil
+	page, err = db.Begin().Order("title").Paginate(3, 3).Find(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.HasNext || len(entries) != 1 || entries[0].Title != "g" {
+		t.Errorf("expected the last page got %+v %v", page, entries)
+	}
+
+	entries = nil
+	page, err = db.Model(&Entry{}).Where("score = ?", 0).Order("title").Paginate(1, 2).Find(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = Page{Page: 1, PerPage: 2, Total: 3, Pages: 2, HasNext: true}
+	if page != expect {
+		t.Errorf("expected %+v got %+v", expect, page)
+	}
+	if len(entries) != 2 || entries[0].Title != "a" || entries[1].Title != "d" {
+		t.Errorf("expected a and d got %v", entries)
+	}
+
+	found, page, err := G[Entry](db).Order("title").Paginate(5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 || page.Total != 7 || page.Pages != 4 || page.HasNext {
+		t.Errorf("expected an empty page past the end got %+v %v", page, found)
+	}
+
+	_, err = db.Begin().Paginate(0, 10).Find(&entries)
+	if err != errmsg.ErrInvalidPage {
+		t.Errorf("expected %v got %v", errmsg.ErrInvalidPage, err)
+	}
+
+	paginator := db.Paginate(1, 2)
+	if db.e != nil {
+		t.Error("expected the shared DB to have no engine")
+	}
+	entries = nil
+	_, err = paginator.Find(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_PaginateCursor(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPaginateCursor, &Entry{})
+	}
+}
+
+func testDBPaginateCursor(t *testing.T, db *DB) {
+	createEntries(t, db, 7)
+	var titles []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("expected the pages to end")
+		}
+		var entries []Entry
+		page, err := db.Begin().PaginateCursor(cursor, 3).Find(&entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			titles = append(titles, e.Title)
+		}
+		if !page.HasNext {
+			break
+		}
+		cursor = page.Next
+	}
+	if got := strings.Join(titles, ""); got != "abcdefg" {
+		t.Errorf("expected abcdefg got %s", got)
+	}
+
+	// by score then id descending, a key with duplicate values.
+	titles = nil
+	cursor = ""
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("expected the pages to end")
+		}
+		entries, page, err := G[Entry](db).Where("title != ?", "a").
+			PaginateCursor(cursor, 2, "score DESC", "id DESC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			titles = append(titles, e.Title)
+		}
+		if !page.HasNext {
+			break
+		}
+		cursor = page.Next
+	}
+	if got := strings.Join(titles, ""); got != "fcebgd" {
+		t.Errorf("expected fcebgd got %s", got)
+	}
+
+	var entries []Entry
+	if isQL(db) {
+		_, err := db.Begin().PaginateCursor("", 3, "score DESC", "id").Find(&entries)
+		if err == nil {
+			t.Error("expected an error ordering the keys in different directions")
+		}
+	}
+	_, err := db.Begin().PaginateCursor("not a cursor", 3).Find(&entries)
+	if err != errmsg.ErrInvalidCursor {
+		t.Errorf("expected %v got %v", errmsg.ErrInvalidCursor, err)
+	}
+
+	paginator := db.PaginateCursor("", 3)
+	if db.e != nil {
+		t.Error("expected the shared DB to have no engine")
+	}
+	var entry Entry
+	_, err = paginator.Find(&entry)
+	if err == nil || !strings.Contains(err.Error(), "needs a slice") {
+		t.Errorf("expected an error paginating a struct got %v", err)
+	}
+}
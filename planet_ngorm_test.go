@@ -0,0 +1,79 @@
+// Code generated by ngorm-gen. DO NOT EDIT.
+
+package ngorm
+
+import "github.com/ngorm/ngorm/model"
+
+// NGORMColumns returns the columns of the normal fields of Planet.
+func (m *Planet) NGORMColumns() []string {
+	return []string{"id", "name", "rings", "discovered"}
+}
+
+// NGORMScan implements model.ColumnScanner.
+func (m *Planet) NGORMScan(columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = model.ScanField(&m.ID)
+		case "name":
+			dest[i] = model.ScanField(&m.Name)
+		case "rings":
+			dest[i] = &m.Rings
+		case "discovered":
+			dest[i] = model.ScanField(&m.Discovered)
+		}
+	}
+	return dest
+}
+
+// NGORMValue implements model.FieldValuer.
+func (m *Planet) NGORMValue(name string) (interface{}, bool) {
+	switch name {
+	case "ID":
+		return m.ID, true
+	case "Name":
+		return m.Name, true
+	case "Rings":
+		return m.Rings, true
+	case "Discovered":
+		return m.Discovered, true
+	case "Moons":
+		return m.Moons, true
+	}
+	return nil, false
+}
+
+// NGORMColumns returns the columns of the normal fields of Moon.
+func (m *Moon) NGORMColumns() []string {
+	return []string{"id", "planet_id", "name"}
+}
+
+// NGORMScan implements model.ColumnScanner.
+func (m *Moon) NGORMScan(columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			dest[i] = model.ScanField(&m.ID)
+		case "planet_id":
+			dest[i] = model.ScanField(&m.PlanetID)
+		case "name":
+			dest[i] = model.ScanField(&m.Name)
+		}
+	}
+	return dest
+}
+
+// NGORMValue implements model.FieldValuer.
+func (m *Moon) NGORMValue(name string) (interface{}, bool) {
+	switch name {
+	case "ID":
+		return m.ID, true
+	case "PlanetID":
+		return m.PlanetID, true
+	case "Name":
+		return m.Name, true
+	}
+	return nil, false
+}
@@ -23,4 +23,14 @@ var (
 
 	//KeyName matches _ in a string
 	KeyName = regexp.MustCompile("(_*[^a-zA-Z]+_*|_+)")
+
+	//And matches the AND separating sql conditions
+	And = regexp.MustCompile(`(?i)\s+and\s+`)
+
+	//Or matches OR in sql conditions
+	Or = regexp.MustCompile(`(?i)\sor\s`)
+
+	//EqualColumn matches a condition comparing a column to a placeholder, like
+	//user_id = ? or "orders"."user_id" = ?
+	EqualColumn = regexp.MustCompile("^\\(?\\s*(?:[\"`]?\\w+[\"`]?\\.)?[\"`]?(\\w+)[\"`]?\\s*=\\s*\\?\\s*\\)?$")
 )
@@ -34,9 +34,11 @@ func SetupJoinTable(s *model.JoinTableHandler, relationship *model.Relationship,
 }
 
 //GetSearchMap return a map of  fields that are related  as in foreign keys
-//between the source model and destination model.
+//between the source model and destination model. When the model is related to
+//itself the first of sources is the source and the second the destination.
 func GetSearchMap(e *engine.Engine, s *model.JoinTableHandler, sources ...interface{}) map[string]interface{} {
 	values := map[string]interface{}{}
+	var sourceFound bool
 
 	for _, source := range sources {
 		m, err := GetModelStruct(e, source)
@@ -45,7 +47,8 @@ func GetSearchMap(e *engine.Engine, s *model.JoinTableHandler, sources ...interf
 		}
 		modelType := m.ModelType
 
-		if s.Source.ModelType == modelType {
+		if s.Source.ModelType == modelType && !sourceFound {
+			sourceFound = true
 			for _, foreignKey := range s.Source.ForeignKeys {
 				field, err := FieldByName(e, source, foreignKey.AssociationDBName)
 				if err != nil {
@@ -54,6 +57,9 @@ func GetSearchMap(e *engine.Engine, s *model.JoinTableHandler, sources ...interf
 					values[foreignKey.DBName] = field.Field.Interface()
 				}
 			}
+			if s.Source.PolymorphicDBName != "" {
+				values[s.Source.PolymorphicDBName] = s.Source.PolymorphicValue
+			}
 		} else if s.Destination.ModelType == modelType {
 			for _, foreignKey := range s.Destination.ForeignKeys {
 				field, err := FieldByName(e, source, foreignKey.AssociationDBName)
@@ -63,6 +69,9 @@ func GetSearchMap(e *engine.Engine, s *model.JoinTableHandler, sources ...interf
 					values[foreignKey.DBName] = field.Field.Interface()
 				}
 			}
+			if s.Destination.PolymorphicDBName != "" {
+				values[s.Destination.PolymorphicDBName] = s.Destination.PolymorphicValue
+			}
 		}
 	}
 	return values
@@ -144,10 +153,17 @@ func JoinWith(handler *model.JoinTableHandler, ne *engine.Engine, source interfa
 			condString = fmt.Sprintf("1 <> 1")
 		}
 
+		conditions, args := polymorphicJoinConditions(handler, ne, quotedTableName)
+		joinConditions = append(joinConditions, conditions...)
+		conditions, err = joinModelConditions(handler, ne, quotedTableName)
+		if err != nil {
+			return err
+		}
+		joinConditions = append(joinConditions, conditions...)
 		search.Join(ne,
 			fmt.Sprintf("INNER JOIN %v ON %v",
 				quotedTableName,
-				strings.Join(joinConditions, " AND ")))
+				strings.Join(joinConditions, " AND ")), args...)
 		search.Where(ne, condString, util.ToQueryValues(foreignFieldValues)...)
 		return nil
 	}
@@ -192,12 +208,65 @@ func JoinWithQL(handler *model.JoinTableHandler, ne *engine.Engine, source inter
 			for _, dbName := range foreignDBNames {
 				quotedForeignDBNames = append(quotedForeignDBNames, tableName+"."+dbName)
 			}
-			for _, q := range quotedForeignDBNames {
-				joinConditions = append(joinConditions, fmt.Sprintf("%s=?", q))
+			if len(quotedForeignDBNames) == 1 {
+				joinConditions = append(joinConditions, fmt.Sprintf("%s IN (%s)",
+					quotedForeignDBNames[0], util.ToQueryMarks(foreignFieldValues)))
+			} else {
+				// ql has no row values, each record of the source is matched
+				// on its own.
+				var records []string
+				for range foreignFieldValues {
+					var record []string
+					for _, q := range quotedForeignDBNames {
+						record = append(record, fmt.Sprintf("%s=?", q))
+					}
+					records = append(records, "("+strings.Join(record, " AND ")+")")
+				}
+				joinConditions = append(joinConditions, "("+strings.Join(records, " OR ")+")")
 			}
 		}
-		search.Where(ne, strings.Join(joinConditions, " AND "), util.ToQueryValues(foreignFieldValues)...)
+		conditions, args := polymorphicJoinConditions(handler, ne, quotedTableName)
+		joinConditions = append(joinConditions, conditions...)
+		conditions, err = joinModelConditions(handler, ne, quotedTableName)
+		if err != nil {
+			return err
+		}
+		joinConditions = append(joinConditions, conditions...)
+		search.Where(ne, strings.Join(joinConditions, " AND "),
+			append(util.ToQueryValues(foreignFieldValues), args...)...)
 		return nil
 	}
 	return errors.New("wrong source type for join table handler")
 }
+
+// polymorphicJoinConditions returns the conditions on the type columns of
+// the join table of handler, table is the name used to refer to the join
+// table.
+func polymorphicJoinConditions(handler *model.JoinTableHandler, ne *engine.Engine, table string) ([]string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	for _, side := range []model.JoinTableSource{handler.Source, handler.Destination} {
+		if side.PolymorphicDBName != "" {
+			conditions = append(conditions, fmt.Sprintf("%v.%v = ?",
+				table, Quote(ne, side.PolymorphicDBName)))
+			args = append(args, side.PolymorphicValue)
+		}
+	}
+	return conditions, args
+}
+
+// joinModelConditions returns the conditions leaving out the soft deleted rows
+// of the join model of handler, unless the query of ne is unscoped. table is
+// the name used to refer to the join table.
+func joinModelConditions(handler *model.JoinTableHandler, ne *engine.Engine, table string) ([]string, error) {
+	if handler.Model == nil || ne.Search.Unscoped {
+		return nil, nil
+	}
+	sd, err := SoftDeleteField(ne, reflect.New(handler.Model).Interface())
+	if err != nil || sd == nil {
+		return nil, err
+	}
+	return []string{sd.SoftDelete.NotDeletedCondition(table + "." + Quote(ne, sd.DBName))}, nil
+}
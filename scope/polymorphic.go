@@ -0,0 +1,84 @@
+package scope
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/util"
+)
+
+// buildRelationPolymorphic builds the polymorphic belongs_to relationship of
+// the interface field. The model refers to the associated record with the
+// <polymorphic>ID and <polymorphic>Type fields.
+func buildRelationPolymorphic(m *model.Struct, field *model.StructField) error {
+	polymorphic := field.TagSettings["POLYMORPHIC"]
+	polymorphicType := GetForeignField(polymorphic+"Type", m.StructFields)
+	if polymorphicType == nil {
+		return fmt.Errorf("polymorphic field %sType not found", polymorphic)
+	}
+	foreignKey := polymorphic + "ID"
+	if fk := field.TagSettings["FOREIGNKEY"]; fk != "" {
+		foreignKey = fk
+	}
+	foreignField := GetForeignField(foreignKey, m.StructFields)
+	if foreignField == nil {
+		return fmt.Errorf("polymorphic foreign key %s not found", foreignKey)
+	}
+	associationForeignKey := "ID"
+	if fk := field.TagSettings["ASSOCIATIONFOREIGNKEY"]; fk != "" {
+		associationForeignKey = fk
+	}
+	polymorphicType.IsForeignKey = true
+	foreignField.IsForeignKey = true
+	field.Relationship = &model.Relationship{
+		Kind:                         "belongs_to",
+		PolymorphicType:              polymorphicType.Name,
+		PolymorphicDBName:            polymorphicType.DBName,
+		ForeignFieldNames:            []string{foreignField.Name},
+		ForeignDBNames:               []string{foreignField.DBName},
+		AssociationForeignFieldNames: []string{associationForeignKey},
+		AssociationForeignDBNames:    []string{util.ToDBName(associationForeignKey)},
+	}
+	return nil
+}
+
+// PolymorphicModel returns the registered model whose records are referred to
+// with value in the type column of the polymorphic belongs_to relationship
+// rel, see model.RegisterPolymorphicModel.
+func PolymorphicModel(e *engine.Engine, rel *model.Relationship, value string) (reflect.Type, error) {
+	for _, typ := range model.PolymorphicModels() {
+		v, err := PolymorphicValue(e, rel, reflect.New(typ).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if v == value {
+			return typ, nil
+		}
+	}
+	return nil, fmt.Errorf("no polymorphic model registered for %s %q", rel.PolymorphicType, value)
+}
+
+// PolymorphicValue returns the value of the type column of the polymorphic
+// belongs_to relationship rel referring to target. This is the
+// polymorphic_value of the has_one or has_many relationship of target with
+// the same type column if there is one, or the table name of target.
+func PolymorphicValue(e *engine.Engine, rel *model.Relationship, target interface{}) (string, error) {
+	m, err := GetModelStruct(e, target)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range m.StructFields {
+		if r := f.Relationship; r != nil && !r.IsPolymorphicBelongsTo() &&
+			r.PolymorphicValue != "" && strings.EqualFold(r.PolymorphicType, rel.PolymorphicType) {
+			return r.PolymorphicValue, nil
+		}
+	}
+	// TableName caches the name in the scope of the engine, which is about
+	// the model referring to target.
+	ne := e.Clone()
+	defer engine.Put(ne)
+	return TableName(ne, target), nil
+}
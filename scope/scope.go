@@ -22,6 +22,8 @@ import (
 	"github.com/ngorm/ngorm/util"
 )
 
+var versionType = reflect.TypeOf(model.Version(0))
+
 //Quote quotes the str into an SQL string. This makes sure sql strings have ""
 //around them.
 //
@@ -122,6 +124,19 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 	if v := e.StructMap.Get(refType); v != nil {
 		return v, nil
 	}
+	return e.StructMap.Build(refType, func(sm *model.SafeStructsMap) (*model.Struct, error) {
+		structMap := e.StructMap
+		e.StructMap = sm
+		defer func() {
+			e.StructMap = structMap
+		}()
+		return buildModelStruct(e, value, refType)
+	})
+}
+
+// buildModelStruct builds the *model.Struct of refType, the type of the
+// struct of value, and stores it in e.StructMap.
+func buildModelStruct(e *engine.Engine, value interface{}, refType reflect.Type) (*model.Struct, error) {
 	var m model.Struct
 
 	m.ModelType = refType
@@ -173,6 +188,16 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 					inType = inType.Elem()
 				}
 
+				if _, ok := field.TagSettings["VERSION"]; ok || inType == versionType {
+					field.IsVersion = true
+				}
+
+				sd, err := softDeleter(field, inType)
+				if err != nil {
+					return nil, err
+				}
+				field.SoftDelete = sd
+
 				fieldValue := reflect.New(inType).Interface()
 				if _, isScanner := fieldValue.(sql.Scanner); isScanner {
 					// is scanner
@@ -187,7 +212,7 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 				} else if _, isTime := fieldValue.(*time.Time); isTime {
 					// is time
 					field.IsNormal = true
-				} else if _, ok := field.TagSettings["EMBEDDED"]; ok || fStruct.Anonymous {
+				} else if _, ok := field.TagSettings["EMBEDDED"]; (ok || fStruct.Anonymous) && !field.IsVersion {
 					// is embedded struct
 					ms, err := GetModelStruct(e, fieldValue)
 					if err != nil {
@@ -210,12 +235,26 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 					switch inType.Kind() {
 					case reflect.Slice:
 						defer func() {
-							_ = buildRelationSlice(e, value, refType, &m, field)
+							if err := buildRelationSlice(e, value, refType, &m, field); err != nil {
+								m.RelationshipErrors = append(m.RelationshipErrors, relationshipError(field, err))
+							}
 						}()
 
 					case reflect.Struct:
 						defer func() {
-							_ = buildRelationStruct(e, value, refType, &m, field)
+							if err := buildRelationStruct(e, value, refType, &m, field); err != nil {
+								m.RelationshipErrors = append(m.RelationshipErrors, relationshipError(field, err))
+							}
+						}()
+					case reflect.Interface:
+						if _, ok := field.TagSettings["POLYMORPHIC"]; !ok {
+							field.IsNormal = true
+							break
+						}
+						defer func() {
+							if err := buildRelationPolymorphic(&m, field); err != nil {
+								m.RelationshipErrors = append(m.RelationshipErrors, relationshipError(field, err))
+							}
 						}()
 					default:
 						field.IsNormal = true
@@ -229,6 +268,9 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 			} else {
 				field.DBName = util.ToDBName(fStruct.Name)
 			}
+			if field.SoftDelete == nil && !field.IsIgnored && field.DBName == "deleted_at" {
+				field.SoftDelete = model.TimestampSoftDelete{}
+			}
 			m.StructFields = append(m.StructFields, field)
 		}
 	}
@@ -244,6 +286,54 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 	return &m, nil
 }
 
+// relationshipError returns err, the error building the relationship of
+// field, with the name of the field.
+func relationshipError(field *model.StructField, err error) error {
+	return fmt.Errorf("relationship %s: %v", field.Name, err)
+}
+
+// softDeleter returns the soft delete strategy declared by the field, either
+// with the soft_delete tag or by the field type implementing
+// model.SoftDeleter.
+func softDeleter(field *model.StructField, typ reflect.Type) (model.SoftDeleter, error) {
+	if name, ok := field.TagSettings["SOFT_DELETE"]; ok {
+		if name != "SOFT_DELETE" {
+			return model.SoftDeleteStrategy(strings.ToLower(name))
+		}
+		switch typ.Kind() {
+		case reflect.Bool:
+			return model.DeletedFlag(false), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return model.DeletedUnix(0), nil
+		default:
+			return model.TimestampSoftDelete{}, nil
+		}
+	}
+	if sd, ok := reflect.Zero(typ).Interface().(model.SoftDeleter); ok {
+		return sd, nil
+	}
+	if sd, ok := reflect.New(typ).Interface().(model.SoftDeleter); ok {
+		return sd, nil
+	}
+	return nil, nil
+}
+
+//SoftDeleteField returns the soft delete column of the model, or nil when
+//records of the model are deleted permanently.
+func SoftDeleteField(e *engine.Engine, value interface{}) (*model.StructField, error) {
+	ms, err := GetModelStruct(e, value)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range ms.StructFields {
+		if field.SoftDelete != nil && field.IsNormal {
+			return field, nil
+		}
+	}
+	return nil, nil
+}
+
 //BuildRelationSlice builds relationship for a field of kind reflect.Slice. This
 //updates the ModelStruct m accordingly.
 //
@@ -281,12 +371,24 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 				}
 			}
 
+			// Post has many tags through taggings, tag polymorphic is
+			// Taggable, then taggings use TaggableID, TaggableType ('posts')
+			// to refer to the post.
+			sourceName := refType.Name()
+			if polymorphic := field.TagSettings["POLYMORPHIC"]; polymorphic != "" {
+				sourceName = polymorphic
+			}
+			destinationName := elemType.Name()
+			if polymorphic := field.TagSettings["ASSOCIATION_POLYMORPHIC"]; polymorphic != "" {
+				destinationName = polymorphic
+			}
+
 			for _, fk := range fks {
 				if foreignField := GetForeignField(fk, m.StructFields); foreignField != nil {
 					// source foreign keys (db names)
 					rel.ForeignFieldNames = append(rel.ForeignFieldNames, foreignField.DBName)
 					// join table foreign keys for source
-					joinTableDBName := util.ToDBName(refType.Name()) + "_" + foreignField.DBName
+					joinTableDBName := util.ToDBName(sourceName) + "_" + foreignField.DBName
 					rel.ForeignDBNames = append(rel.ForeignDBNames, joinTableDBName)
 				}
 			}
@@ -302,6 +404,12 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 				}
 			}
 
+			// User has many friends, the join table refers to the friends
+			// with friend_id as user_id refers to the user.
+			if elemType == refType && destinationName == sourceName {
+				destinationName = inflection.Singular(field.Name)
+			}
+
 			for _, name := range associationForeignKeys {
 				field, err := FieldByName(e, toScope, name)
 				if err != nil {
@@ -310,12 +418,46 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 				// association foreign keys (db names)
 				rel.AssociationForeignFieldNames = append(rel.AssociationForeignFieldNames, field.DBName)
 				// join table foreign keys for association
-				joinTableDBName := util.ToDBName(elemType.Name()) + "_" + field.DBName
+				joinTableDBName := util.ToDBName(destinationName) + "_" + field.DBName
 				rel.AssociationForeignDBNames = append(rel.AssociationForeignDBNames, joinTableDBName)
 			}
 
 			joinTableHandler := &model.JoinTableHandler{}
-			SetupJoinTable(joinTableHandler, rel, many2many, refType, elemType)
+			joinTableName := many2many
+			joinModel, ok := e.JoinModels.Get(many2many)
+			if ok {
+				joinTableName = TableName(e, reflect.New(joinModel).Interface())
+			} else if util.ToDBName(many2many) != many2many {
+				return fmt.Errorf("many2many %s of %s.%s is neither a registered join model nor a table name",
+					many2many, refType.Name(), field.Name)
+			}
+			SetupJoinTable(joinTableHandler, rel, joinTableName, refType, elemType)
+			if polymorphic := field.TagSettings["POLYMORPHIC"]; polymorphic != "" {
+				joinTableHandler.Source.PolymorphicDBName = util.ToDBName(polymorphic + "Type")
+				if value, ok := field.TagSettings["POLYMORPHIC_VALUE"]; ok {
+					joinTableHandler.Source.PolymorphicValue = value
+				} else {
+					joinTableHandler.Source.PolymorphicValue = TableName(e, modelValue)
+				}
+			}
+			if polymorphic := field.TagSettings["ASSOCIATION_POLYMORPHIC"]; polymorphic != "" {
+				joinTableHandler.Destination.PolymorphicDBName = util.ToDBName(polymorphic + "Type")
+				if value, ok := field.TagSettings["ASSOCIATION_POLYMORPHIC_VALUE"]; ok {
+					joinTableHandler.Destination.PolymorphicValue = value
+				} else {
+					ne := e.Clone()
+					joinTableHandler.Destination.PolymorphicValue = TableName(ne, reflect.New(elemType).Interface())
+					engine.Put(ne)
+				}
+			}
+			if ok {
+				rel.JoinTableHandler = joinTableHandler
+				err := checkJoinModel(e, joinModel, rel)
+				if err != nil {
+					return err
+				}
+				joinTableHandler.Model = joinModel
+			}
 			rel.JoinTableHandler = joinTableHandler
 			field.Relationship = rel
 		} else {
@@ -345,6 +487,16 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 				}
 			}
 
+			// Category has many children, the children refer to their parent
+			// with ParentID when there is no CategoryID field.
+			if len(fks) == 0 && len(associationForeignKeys) == 0 && elemType == refType &&
+				rel.PolymorphicType == "" {
+				if fk := selfForeignKey(m, refType); fk != "" &&
+					GetForeignField(associationType+"ID", toFields) == nil {
+					fks = []string{fk}
+				}
+			}
+
 			// if no foreign keys defined with tag
 			if len(fks) == 0 {
 				// if no association foreign keys defined with tag
@@ -410,6 +562,22 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 	return nil
 }
 
+// selfForeignKey returns the foreign key of the belongs_to relationship of
+// the model m with itself, e.g. ParentID for a Parent field. It returns an
+// empty string when the model does not refer to itself.
+func selfForeignKey(m *model.Struct, refType reflect.Type) string {
+	for _, f := range m.StructFields {
+		typ := f.Struct.Type
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ == refType && GetForeignField(f.Name+"ID", m.StructFields) != nil {
+			return f.Name + "ID"
+		}
+	}
+	return ""
+}
+
 //BuildRelationStruct builds relationship for a field of kind reflect.Struct . This
 //updates the ModelStruct m accordingly.
 //
@@ -635,7 +803,8 @@ func PrimaryFields(e *engine.Engine, value interface{}) ([]*model.Field, error)
 }
 
 //PrimaryField returns the field with name id, or any primary field that happens
-//to be the one defined by the model value.
+//to be the one defined by the model value. For composite primary keys without
+//an id field this is the first primary field.
 func PrimaryField(e *engine.Engine, value interface{}) (*model.Field, error) {
 	m, err := GetModelStruct(e, value)
 	if err != nil {
@@ -644,10 +813,9 @@ func PrimaryField(e *engine.Engine, value interface{}) (*model.Field, error) {
 	if primaryFields := m.PrimaryFields; len(primaryFields) > 0 {
 		if len(primaryFields) > 1 {
 			field, err := FieldByName(e, value, "id")
-			if err != nil {
-				return nil, err
+			if err == nil {
+				return field, nil
 			}
-			return field, nil
 		}
 		pf, err := PrimaryFields(e, value)
 		if err != nil {
@@ -658,6 +826,25 @@ func PrimaryField(e *engine.Engine, value interface{}) (*model.Field, error) {
 	return nil, errors.New("no field found")
 }
 
+//VersionField returns the field used for optimistic locking. It returns nil
+//when the model has no version field.
+func VersionField(e *engine.Engine, value interface{}) (*model.Field, error) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	fds, err := Fields(e, value)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fds {
+		if field.IsVersion {
+			return field, nil
+		}
+	}
+	return nil, nil
+}
+
 // TableName returns a string representation of the possible name of the table
 // that is mapped to the model value.
 //
@@ -694,6 +881,93 @@ func TableName(e *engine.Engine, value interface{}) string {
 	return ms.DefaultTableName
 }
 
+//DefaultScope returns the default scope of the model value, false when the
+//model doesn't implement model.DefaultScoper. The columns of the model in the
+//condition are qualified with FieldQualifier.
+func DefaultScope(e *engine.Engine, value interface{}) (model.Expr, bool, error) {
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return model.Expr{}, false, err
+	}
+	s, ok := reflect.New(m.ModelType).Interface().(model.DefaultScoper)
+	if !ok {
+		return model.Expr{}, false, nil
+	}
+	ds := s.DefaultScope()
+	ds.Q = qualifyColumns(e, value, m, ds.Q)
+	return ds, true, nil
+}
+
+//qualifyColumns prefixes the columns of m in the condition q with the field
+//qualifier of value. Qualified names, quoted names, string literals and
+//function calls are left as is.
+func qualifyColumns(e *engine.Engine, value interface{}, m *model.Struct, q string) string {
+	qualifier := FieldQualifier(e, value)
+	if qualifier == "" {
+		return q
+	}
+	columns := make(map[string]bool)
+	for _, f := range m.StructFields {
+		if f.IsNormal {
+			columns[f.DBName] = true
+		}
+	}
+	isIdent := func(c byte, first bool) bool {
+		return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			!first && c >= '0' && c <= '9'
+	}
+	var buf strings.Builder
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(q[i+1:], c)
+			if end == -1 {
+				buf.WriteString(q[i:])
+				return buf.String()
+			}
+			buf.WriteString(q[i : i+end+2])
+			i += end + 2
+		case isIdent(c, true) && (i == 0 || !isIdent(q[i-1], false) && q[i-1] != '.'):
+			j := i + 1
+			for j < len(q) && isIdent(q[j], false) {
+				j++
+			}
+			name := q[i:j]
+			if columns[name] && (j == len(q) || q[j] != '.' && q[j] != '(') {
+				buf.WriteString(qualifier + Quote(e, name))
+			} else {
+				buf.WriteString(name)
+			}
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
+
+//Reader returns the database to run the read query of e on. It is a replica
+//of the table of the query when the resolver of e has one, unless the query
+//is in a transaction, locks rows or has the model.UsePrimary clause.
+func Reader(e *engine.Engine) model.SQLCommon {
+	if e.Resolver == nil || model.IsTransaction(e.SQLDB) ||
+		model.IsUsePrimary(e.Search.Clauses) {
+		return e.SQLDB
+	}
+	for _, c := range e.Search.Clauses {
+		switch c.(type) {
+		case model.Locking, *model.Locking:
+			return e.SQLDB
+		}
+	}
+	if r, ok := e.Resolver.Replica(TableName(e, e.Scope.Value)); ok {
+		return r
+	}
+	return e.SQLDB
+}
+
 //PrimaryKey returns the name of the primary key for the model value
 func PrimaryKey(e *engine.Engine, value interface{}) (string, error) {
 	pf, err := PrimaryField(e, value)
@@ -821,6 +1095,98 @@ func Scan(rows *sql.Rows, columns []string, fields []*model.Field) {
 	}
 }
 
+//GeneratedScanner returns the scanner generated by ngorm-gen for value, a
+//pointer to a model. It returns false when value has none, or when the
+//scanner doesn't map exactly the columns the model maps to normal fields, in
+//which case the row must be scanned with Scan.
+func GeneratedScanner(e *engine.Engine, value interface{}, columns []string) (model.ColumnScanner, bool) {
+	s, ok := value.(model.ColumnScanner)
+	if !ok {
+		return nil, false
+	}
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return nil, false
+	}
+	dest := s.NGORMScan(columns)
+	if len(dest) != len(columns) {
+		return nil, false
+	}
+	for i, column := range columns {
+		normal := false
+		for _, field := range m.StructFields {
+			if field.IsNormal && field.DBName == column {
+				normal = true
+				break
+			}
+		}
+		if normal != (dest[i] != nil) {
+			return nil, false
+		}
+	}
+	return s, true
+}
+
+//ScanColumns scans the current row of rows into dest, the destinations
+//returned by a model.ColumnScanner for columns. Columns without a destination,
+//and columns repeating one already scanned, are discarded.
+func ScanColumns(rows *sql.Rows, columns []string, dest []interface{}) error {
+	var ignored interface{}
+	for i, column := range columns {
+		if dest[i] == nil {
+			dest[i] = &ignored
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if columns[j] == column {
+				dest[i] = &ignored
+				break
+			}
+		}
+	}
+	return rows.Scan(dest...)
+}
+
+//ScanMap scans the current row of rows into a map of column names to values.
+//
+// Columns which match a normal field in fields are scanned using the type of
+// the field, so a string column yields a string even when the driver hands
+// back []byte. Other columns, for instance aggregates or columns from joined
+// tables, are stored as returned by the driver. NULL values are stored as nil.
+func ScanMap(rows *sql.Rows, columns []string, fields []*model.Field) (map[string]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	for index, column := range columns {
+		values[index] = new(interface{})
+		for _, field := range fields {
+			if field.IsNormal && field.DBName == column {
+				values[index] = reflect.New(reflect.PtrTo(field.Struct.Type)).Interface()
+				break
+			}
+		}
+	}
+	err := rows.Scan(values...)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(columns))
+	for index, column := range columns {
+		v := reflect.ValueOf(values[index]).Elem()
+		if v.IsNil() {
+			result[column] = nil
+			continue
+		}
+		v = v.Elem()
+		if b, ok := v.Interface().([]byte); ok {
+			c := make([]byte, len(b))
+			copy(c, b)
+			result[column] = c
+			continue
+		}
+		result[column] = v.Interface()
+	}
+	return result, nil
+}
+
 //SetColumn sets the column value.
 func SetColumn(e *engine.Engine, column interface{}, value interface{}) error {
 	var updateAttrs = map[string]interface{}{}
@@ -879,9 +1245,14 @@ func SelectAttrs(e *engine.Engine) []string {
 	return e.Scope.SelectAttrs
 }
 
-//ChangeableField returns true if the field's value can be changed.
+//ChangeableField returns true if the field's value can be changed. Select and
+//Omit attributes naming associations only affect the association fields, see
+//AssociationSaveMode.
 func ChangeableField(e *engine.Engine, field *model.Field) bool {
-	if selectAttrs := SelectAttrs(e); len(selectAttrs) > 0 {
+	if field.Relationship != nil {
+		return AssociationSaveMode(e, field) != model.SaveSkip
+	}
+	if selectAttrs := columnAttrs(e, SelectAttrs(e)); len(selectAttrs) > 0 {
 		for _, attr := range selectAttrs {
 			if field.Name == attr || field.DBName == attr {
 				return true
@@ -899,6 +1270,67 @@ func ChangeableField(e *engine.Engine, field *model.Field) bool {
 	return true
 }
 
+//AssociationSaveMode returns how the association field is saved with the model
+//in e. An association named in Omit is skipped, and one named with the .*
+//suffix is only referenced. When Select names any attribute the associations
+//which are not named are skipped.
+//
+//	db.Select("Emails").Create(&user)
+//	db.Omit("Company.*").Save(&user)
+func AssociationSaveMode(e *engine.Engine, field *model.Field) model.AssociationSave {
+	if !ShouldSaveAssociation(e) {
+		return model.SaveSkip
+	}
+	if value, ok := field.TagSettings["SAVE_ASSOCIATIONS"]; ok && (value == "false" || value == "skip") {
+		return model.SaveSkip
+	}
+	reference := field.Name + "." + model.Associations
+	for _, attr := range e.Search.Omits {
+		switch attr {
+		case field.Name, field.DBName, model.Associations:
+			return model.SaveSkip
+		case reference:
+			return model.SaveReference
+		}
+	}
+	if selectAttrs := SelectAttrs(e); len(selectAttrs) > 0 {
+		for _, attr := range selectAttrs {
+			switch attr {
+			case field.Name, field.DBName, model.Associations:
+				return model.SaveUpsert
+			case reference:
+				return model.SaveReference
+			}
+		}
+		return model.SaveSkip
+	}
+	return model.SaveUpsert
+}
+
+// columnAttrs returns the attributes in attrs which are not about the
+// associations of the model in e.
+func columnAttrs(e *engine.Engine, attrs []string) []string {
+	var (
+		columns []string
+		m       *model.Struct
+	)
+	for _, attr := range attrs {
+		if attr == model.Associations || strings.HasSuffix(attr, "."+model.Associations) {
+			continue
+		}
+		if m == nil && e.Scope.Value != nil {
+			m, _ = GetModelStruct(e, e.Scope.Value)
+		}
+		if m != nil {
+			if f := GetForeignField(attr, m.StructFields); f != nil && f.Relationship != nil {
+				continue
+			}
+		}
+		columns = append(columns, attr)
+	}
+	return columns
+}
+
 //CreateTable generates CREATE TABLE SQL
 func CreateTable(e *engine.Engine, value interface{}) error {
 	var tags []string
@@ -965,6 +1397,9 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 		if e.Dialect.HasTable(j.TableName) {
 			return nil
 		}
+		if j.Model != nil {
+			return createJoinModelTable(e, j.Model)
+		}
 		value := reflect.New(field.Struct.Type).Interface()
 		var sqlTypes, primaryKeys []string
 		for idx, fieldName := range rel.ForeignFieldNames {
@@ -1003,6 +1438,22 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 				Quote(e, rel.AssociationForeignDBNames[idx])+" "+data)
 			primaryKeys = append(primaryKeys, Quote(e, rel.AssociationForeignDBNames[idx]))
 		}
+		for _, side := range []model.JoinTableSource{j.Source, j.Destination} {
+			if side.PolymorphicDBName == "" {
+				continue
+			}
+			data, err := e.Dialect.DataTypeOf(&model.StructField{
+				DBName:      side.PolymorphicDBName,
+				IsNormal:    true,
+				Struct:      reflect.StructField{Type: reflect.TypeOf("")},
+				TagSettings: map[string]string{"IS_JOINTABLE_FOREIGNKEY": "true"},
+			})
+			if err != nil {
+				return err
+			}
+			sqlTypes = append(sqlTypes, Quote(e, side.PolymorphicDBName)+" "+data)
+			primaryKeys = append(primaryKeys, Quote(e, side.PolymorphicDBName))
+		}
 		var primaryKeyStr string
 		if len(primaryKeys) > 0 {
 			primaryKeyStr = e.Dialect.PrimaryKey(primaryKeys)
@@ -1032,6 +1483,49 @@ func CreateJoinTable(e *engine.Engine, field *model.StructField) error {
 	return nil
 }
 
+// createJoinModelTable adds the SQL for creating the table of the join model
+// typ to e.Scope.Exprs.
+func createJoinModelTable(e *engine.Engine, typ reflect.Type) error {
+	ne := e.Clone()
+	defer engine.Put(ne)
+	err := CreateTable(ne, reflect.New(typ).Interface())
+	if err != nil {
+		return err
+	}
+	e.Scope.MultiExpr = true
+	e.Scope.Exprs = append(e.Scope.Exprs, &model.Expr{Q: ne.Scope.SQL})
+	e.Scope.Exprs = append(e.Scope.Exprs, ne.Scope.Exprs...)
+	return nil
+}
+
+// checkJoinModel returns an error if the join model typ is missing any of the
+// foreign key columns of the many_to_many relationship rel.
+func checkJoinModel(e *engine.Engine, typ reflect.Type, rel *model.Relationship) error {
+	m, err := GetModelStruct(e, reflect.New(typ).Interface())
+	if err != nil {
+		return err
+	}
+	columns := append(append([]string{}, rel.ForeignDBNames...), rel.AssociationForeignDBNames...)
+	for _, side := range []model.JoinTableSource{rel.JoinTableHandler.Source, rel.JoinTableHandler.Destination} {
+		if side.PolymorphicDBName != "" {
+			columns = append(columns, side.PolymorphicDBName)
+		}
+	}
+	for _, column := range columns {
+		found := false
+		for _, f := range m.StructFields {
+			if f.IsNormal && f.DBName == column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("join model %s has no field for column %s", typ.Name(), column)
+		}
+	}
+	return nil
+}
+
 //AutoIndex generates CREATE INDEX SQL
 func AutoIndex(e *engine.Engine, value interface{}) error {
 	var indexes = map[string][]string{}
@@ -1333,12 +1827,9 @@ func ConvertInterfaceToMap(e *engine.Engine, values interface{}, withIgnoredFiel
 //
 // Only works if the field has tag SAVE_ASSOCIATION
 func SaveFieldAsAssociation(e *engine.Engine, field *model.Field) (bool, *model.Relationship) {
-	if ChangeableField(e, field) && !field.IsBlank && !field.IsIgnored {
-		if value, ok := field.TagSettings["SAVE_ASSOCIATIONS"]; !ok || (value != "false" && value != "skip") {
-			if relationship := field.Relationship; relationship != nil {
-				return true, relationship
-			}
-		}
+	if field.Relationship != nil && !field.IsBlank && !field.IsIgnored &&
+		AssociationSaveMode(e, field) != model.SaveSkip {
+		return true, field.Relationship
 	}
 	return false, nil
 }
@@ -1369,3 +1860,63 @@ func ToQueryCondition(e *engine.Engine, columns []string) string {
 	}
 	return strings.Join(newColumns, ",")
 }
+
+//QualifiedColumns returns the columns of value qualified with its table name
+//and aliased to the column name. This avoids picking up columns of the other
+//tables when joining.
+func QualifiedColumns(e *engine.Engine, value interface{}) string {
+	table := QuotedTableName(e, value)
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return "*"
+	}
+	var columns []string
+	for _, field := range m.StructFields {
+		if field.IsNormal && !field.IsIgnored {
+			column := Quote(e, field.DBName)
+			columns = append(columns, fmt.Sprintf("%v.%v AS %v", table, column, column))
+		}
+	}
+	if len(columns) == 0 {
+		return "*"
+	}
+	return strings.Join(columns, ", ")
+}
+
+//FieldQualifier returns the prefix used for the columns of value in
+//conditions. This is the table name for dialects that support qualified
+//columns. Dialects which don't, like ql, only get the prefix when the query
+//joins associations, since the column names would be ambiguous otherwise.
+func FieldQualifier(e *engine.Engine, value interface{}) string {
+	quotedTableName := QuotedTableName(e, value)
+	q := e.Dialect.QueryFieldName(quotedTableName)
+	if q == "" && len(e.Search.JoinAssociations) > 0 {
+		return quotedTableName + "."
+	}
+	return q
+}
+
+//JoinedColumn returns the name under which the column of an association
+//loaded with a join is selected.
+func JoinedColumn(association, column string) string {
+	return association + "__" + column
+}
+
+//JoinedFields returns the fields of value with the column names of the
+//association loaded with a join, so they can be passed to Scan.
+func JoinedFields(e *engine.Engine, value interface{}, association string) ([]*model.Field, error) {
+	fds, err := Fields(e, value)
+	if err != nil {
+		return nil, err
+	}
+	var fields []*model.Field
+	for _, f := range fds {
+		if !f.IsNormal || f.IsIgnored {
+			continue
+		}
+		sf := f.StructField.Clone()
+		sf.DBName = JoinedColumn(association, f.DBName)
+		fields = append(fields, &model.Field{StructField: sf, Field: f.Field, IsBlank: f.IsBlank})
+	}
+	return fields, nil
+}
@@ -1,9 +1,13 @@
 package scope
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/fixture"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ql"
@@ -104,3 +108,221 @@ func TestTableName(t *testing.T) {
 	}
 
 }
+
+type taggedVersion struct {
+	ID       int64
+	Revision uint `gorm:"version"`
+}
+
+func TestVersionField(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	field, err := VersionField(e, &taggedVersion{Revision: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field == nil {
+		t.Fatal("expected version field")
+	}
+	if field.DBName != "revision" {
+		t.Errorf("expected %s got %s", "revision", field.DBName)
+	}
+	field, err = VersionField(e, &fixture.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field != nil {
+		t.Errorf("expected nil got %s", field.Name)
+	}
+}
+
+type archived string
+
+func (archived) DeletedCondition(column string) string    { return column + " != ''" }
+func (archived) NotDeletedCondition(column string) string { return column + " = ''" }
+func (archived) DeletedValue(time.Time) interface{}       { return "archived" }
+func (archived) NotDeletedValue() interface{}             { return "" }
+
+type softDeleteModels struct {
+	timestamp struct {
+		ID        int64
+		DeletedAt *time.Time
+	}
+	flag struct {
+		ID      int64
+		Removed bool `gorm:"soft_delete"`
+	}
+	unix struct {
+		ID      int64
+		Removed int64 `gorm:"soft_delete:unix"`
+	}
+	custom struct {
+		ID     int64
+		Status archived
+	}
+	none struct {
+		ID   int64
+		Name string
+	}
+}
+
+func TestSoftDeleteField(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	var m softDeleteModels
+	sample := []struct {
+		value    interface{}
+		strategy model.SoftDeleter
+	}{
+		{&m.timestamp, model.TimestampSoftDelete{}},
+		{&m.flag, model.DeletedFlag(false)},
+		{&m.unix, model.DeletedUnix(0)},
+		{&m.custom, archived("")},
+		{&m.none, nil},
+	}
+	for _, v := range sample {
+		field, err := SoftDeleteField(e, v.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.strategy == nil {
+			if field != nil {
+				t.Errorf("expected nil got %s", field.Name)
+			}
+			continue
+		}
+		if field == nil {
+			t.Fatalf("expected soft delete field for %T", v.value)
+		}
+		if field.SoftDelete != v.strategy {
+			t.Errorf("expected %#v got %#v", v.strategy, field.SoftDelete)
+		}
+	}
+
+	type unknown struct {
+		ID      int64
+		Removed int64 `gorm:"soft_delete:magic"`
+	}
+	if _, err := GetModelStruct(e, &unknown{}); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := SoftDeleteField(e, &unknown{}); err == nil {
+		t.Error("expected an error")
+	}
+	model.RegisterSoftDeleteStrategy("magic", model.DeletedUnix(0))
+	field, err := SoftDeleteField(fixture.TestEngine(), &unknown{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field == nil || field.SoftDelete != model.DeletedUnix(0) {
+		t.Errorf("expected the registered strategy got %v", field)
+	}
+}
+
+func TestGetModelStruct_concurrent(t *testing.T) {
+	structMap := model.NewStructsMap()
+	structs := make([]*model.Struct, 20)
+	var wg sync.WaitGroup
+	for i := range structs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e := fixture.TestEngine()
+			e.StructMap = structMap
+			m, err := GetModelStruct(e, &fixture.User{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			structs[i] = m
+		}(i)
+	}
+	wg.Wait()
+	for _, m := range structs {
+		if m != structs[0] {
+			t.Fatal("expected the struct to be built once")
+		}
+	}
+	for _, field := range structs[0].StructFields {
+		if field.Name == "Emails" && field.Relationship == nil {
+			t.Error("expected the relationships to be built")
+		}
+	}
+}
+
+type publishedPost struct {
+	ID        int64
+	Title     string
+	Published bool
+}
+
+func (publishedPost) DefaultScope() model.Expr {
+	return model.Expr{
+		Q:    `published = ? AND "published" AND lower(title) != 'title' AND p.published`,
+		Args: []interface{}{true},
+	}
+}
+
+func TestDefaultScope(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	ds, ok, err := DefaultScope(e, &publishedPost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `published = ? AND "published" AND lower(title) != 'title' AND p.published`
+	if !ok || ds.Q != expect {
+		t.Errorf("expected %s got %s", expect, ds.Q)
+	}
+
+	// ql qualifies the columns of queries joining associations.
+	e.Search.JoinAssociations = []string{"Author"}
+	ds, _, err = DefaultScope(e, &publishedPost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `published_posts.published = ? AND "published" AND lower(published_posts.title) != 'title' AND p.published`
+	if ds.Q != expect {
+		t.Errorf("expected %s got %s", expect, ds.Q)
+	}
+
+	_, ok, err = DefaultScope(e, &fixture.User{})
+	if ok || err != nil {
+		t.Errorf("expected no default scope got %v %v", ok, err)
+	}
+	_, _, err = DefaultScope(e, 1)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestTenant(t *testing.T) {
+	type invoice struct {
+		ID       int64
+		TenantID int64
+	}
+	type broken struct {
+		ID       int64
+		TenantID int64
+		Removed  int64 `gorm:"soft_delete:unregistered"`
+	}
+	e := fixture.TestEngine()
+	e.Tenancy = &model.Tenancy{}
+	_, _, err := Tenant(e, &invoice{})
+	if err != errmsg.ErrMissingTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingTenant, err)
+	}
+	e.Ctx = model.WithTenant(context.Background(), int64(1))
+	field, tenant, err := Tenant(e, &invoice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if field == nil || field.DBName != "tenant_id" || tenant != int64(1) {
+		t.Errorf("expected tenant_id and 1 got %v %v", field, tenant)
+	}
+
+	// the queries on a model which can't be built are not run unscoped.
+	if _, _, err := Tenant(e, &broken{}); err == nil {
+		t.Error("expected an error")
+	}
+}
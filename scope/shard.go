@@ -0,0 +1,403 @@
+package scope
+
+import (
+	"bytes"
+	"cmp"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/regexes"
+	"github.com/ngorm/ngorm/util"
+)
+
+//Route routes the query of e on a sharded table to its shard. The shard is
+//chosen by the value of the shard key in the where conditions of e, or in the
+//fields of e.Scope.Value when useValue is true, which is the case for writes.
+//
+// When the shard key isn't found a write is routed to the fallback table of
+// the sharded table, if it has one. Otherwise all the shards of the table are
+// returned, the query must then be run on each of them. Nothing is returned for
+// a table which isn't sharded, or a query which was already routed.
+func Route(e *engine.Engine, useValue bool) ([]model.Shard, error) {
+	if e.Sharding == nil {
+		return nil, nil
+	}
+	if _, ok := e.Scope.Get(model.Sharded); ok {
+		return nil, nil
+	}
+	table := TableName(e, e.Scope.Value)
+	c, ok := e.Sharding.Config(table)
+	if !ok {
+		return nil, nil
+	}
+	var keys []interface{}
+	if useValue {
+		keys = valueShardKeys(e, c.ShardKey)
+	}
+	if len(keys) == 0 {
+		if key, ok := whereShardKey(e, c.ShardKey); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		if f, ok := c.FallbackShard(); ok && useValue {
+			return nil, UseShard(e, f)
+		}
+		return c.All(table), nil
+	}
+	shard, err := c.Shard(table, keys[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys[1:] {
+		s, err := c.Shard(table, key)
+		if err != nil {
+			return nil, err
+		}
+		if s.Index != shard.Index {
+			return nil, fmt.Errorf("ngorm: the records of %s belong to different shards", table)
+		}
+	}
+	return nil, UseShard(e, shard)
+}
+
+//UseShard runs the query of e on shard.
+func UseShard(e *engine.Engine, shard model.Shard) error {
+	if shard.DB != nil {
+		if model.IsTransaction(e.SQLDB) {
+			return errmsg.ErrShardTransaction
+		}
+		e.SQLDB = shard.DB
+	}
+	e.Search.TableName = shard.Table
+	e.Scope.Set(model.Sharded, shard)
+	return nil
+}
+
+// valueShardKeys returns the values of the shard key column of the records in
+// e.Scope.Value, a struct or a slice of structs.
+func valueShardKeys(e *engine.Engine, column string) []interface{} {
+	v := reflect.Indirect(e.Scope.ValueOf())
+	var records []reflect.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		records = append(records, v)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			records = append(records, reflect.Indirect(v.Index(i)))
+		}
+	}
+	var keys []interface{}
+	for _, record := range records {
+		if record.Kind() != reflect.Struct || !record.CanAddr() {
+			return nil
+		}
+		field, err := FieldByName(e, record.Addr().Interface(), column)
+		if err != nil || field.IsBlank {
+			return nil
+		}
+		keys = append(keys, field.Field.Interface())
+	}
+	return keys
+}
+
+// whereShardKey returns the value of the shard key column from the where
+// conditions of e. Only conditions which match a single value of the column
+// are used, and none when the search has OR conditions.
+func whereShardKey(e *engine.Engine, column string) (interface{}, bool) {
+	if len(e.Search.OrConditions) > 0 {
+		return nil, false
+	}
+	for _, c := range e.Search.WhereConditions {
+		args, _ := c["args"].([]interface{})
+		if key, ok := conditionShardKey(e, column, c["query"], args); ok {
+			if v := reflect.ValueOf(key); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+				continue
+			}
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func conditionShardKey(e *engine.Engine, column string, query interface{}, args []interface{}) (interface{}, bool) {
+	switch q := query.(type) {
+	case string:
+		if regexes.Or.MatchString(q) {
+			return nil, false
+		}
+		n := 0
+		for _, part := range regexes.And.Split(q, -1) {
+			part = strings.TrimSpace(part)
+			if m := regexes.EqualColumn.FindStringSubmatch(part); m != nil &&
+				m[1] == column && n < len(args) {
+				return args[n], true
+			}
+			n += strings.Count(part, "?")
+		}
+	case map[string]interface{}:
+		v, ok := q[column]
+		return v, ok
+	default:
+		v := reflect.Indirect(reflect.ValueOf(query))
+		if v.Kind() != reflect.Struct {
+			return nil, false
+		}
+		field, err := FieldByName(e, query, column)
+		if err != nil || field.IsBlank {
+			return nil, false
+		}
+		return field.Field.Interface(), true
+	}
+	return nil, false
+}
+
+//SortShardRecords sorts records, the slice of the records found in all the
+//shards of a query, by the order of the query. Only orders by columns, with an
+//optional direction, are supported.
+func SortShardRecords(e *engine.Engine, records reflect.Value) error {
+	keys, err := shardOrderKeys(e)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	var cmpErr error
+	sort.SliceStable(records.Interface(), func(i, j int) bool {
+		for _, k := range keys {
+			c, err := compareValues(
+				shardRecordValue(records.Index(i), k),
+				shardRecordValue(records.Index(j), k))
+			if err != nil {
+				cmpErr = err
+				return false
+			}
+			if c != 0 {
+				return (c < 0) != k.desc
+			}
+		}
+		return false
+	})
+	return cmpErr
+}
+
+//ShardLimit returns the offset and the limit of the query of e, -1 when they
+//aren't set.
+func ShardLimit(e *engine.Engine) (offset, limit int, err error) {
+	offset, err = limitValue(e.Search.Offset)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err = limitValue(e.Search.Limit)
+	return offset, limit, err
+}
+
+func limitValue(v interface{}) (int, error) {
+	if v == nil {
+		return -1, nil
+	}
+	switch n := reflect.Indirect(reflect.ValueOf(v)); n.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(n.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(n.Uint()), nil
+	case reflect.String:
+		return strconv.Atoi(n.String())
+	}
+	return 0, fmt.Errorf("ngorm: invalid limit %v", v)
+}
+
+// shardOrderKey is a column the records of the shards are merged by.
+type shardOrderKey struct {
+	column string
+	field  string
+	desc   bool
+}
+
+// shardOrderKeys returns the columns of the order of the query of e, which
+// includes the primary key for First and Last.
+func shardOrderKeys(e *engine.Engine) ([]shardOrderKey, error) {
+	var terms []string
+	for _, o := range e.Search.Orders {
+		s, ok := o.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: order by %v", errmsg.ErrShardFanOut, o)
+		}
+		terms = append(terms, strings.Split(s, ",")...)
+	}
+	if by, ok := e.Scope.Get(model.OrderByPK); ok {
+		if pf, err := PrimaryField(e, e.Scope.Value); err == nil {
+			terms = append(terms, pf.DBName+" "+fmt.Sprint(by))
+		}
+	}
+	m, err := GetModelStruct(e, e.Scope.Value)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]shardOrderKey, 0, len(terms))
+	for _, term := range terms {
+		parts := strings.Fields(term)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("%w: order by %s", errmsg.ErrShardFanOut, term)
+		}
+		column := parts[0]
+		if i := strings.LastIndex(column, "."); i != -1 {
+			column = column[i+1:]
+		}
+		k := shardOrderKey{column: strings.Trim(column, "\"`")}
+		if len(parts) == 2 {
+			switch strings.ToUpper(parts[1]) {
+			case "ASC":
+			case "DESC":
+				k.desc = true
+			default:
+				return nil, fmt.Errorf("%w: order by %s", errmsg.ErrShardFanOut, term)
+			}
+		}
+		for _, f := range m.StructFields {
+			if f.IsNormal && (f.DBName == k.column || f.Name == k.column) {
+				k.column = f.DBName
+				k.field = f.Name
+			}
+		}
+		keys = append(keys, k)
+	}
+	// the direction of ql applies to all the columns of ORDER BY.
+	if dialects.IsQL(e.Dialect) && len(keys) > 0 {
+		for i := range keys {
+			keys[i].desc = keys[len(keys)-1].desc
+		}
+	}
+	return keys, nil
+}
+
+// shardRecordValue returns the value of the column of k in record, a struct
+// or a map.
+func shardRecordValue(record reflect.Value, k shardOrderKey) reflect.Value {
+	record = reflect.Indirect(record)
+	switch record.Kind() {
+	case reflect.Map:
+		return record.MapIndex(reflect.ValueOf(k.column))
+	case reflect.Struct:
+		if k.field != "" {
+			if v := record.FieldByName(k.field); v.IsValid() {
+				return v
+			}
+		}
+		return record.FieldByNameFunc(func(name string) bool {
+			return util.ToDBName(name) == k.column
+		})
+	}
+	return reflect.Value{}
+}
+
+// compareValues compares the values of a column, NULL values are last.
+func compareValues(a, b reflect.Value) (int, error) {
+	x, err := orderValue(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := orderValue(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case x == nil && y == nil:
+		return 0, nil
+	case x == nil:
+		return 1, nil
+	case y == nil:
+		return -1, nil
+	}
+	switch xv := x.(type) {
+	case int64:
+		if yv, ok := y.(int64); ok {
+			return cmp.Compare(xv, yv), nil
+		}
+	case uint64:
+		if yv, ok := y.(uint64); ok {
+			return cmp.Compare(xv, yv), nil
+		}
+	case float64:
+		if yv, ok := y.(float64); ok {
+			return cmp.Compare(xv, yv), nil
+		}
+	case string:
+		if yv, ok := y.(string); ok {
+			return strings.Compare(xv, yv), nil
+		}
+	case []byte:
+		if yv, ok := y.([]byte); ok {
+			return bytes.Compare(xv, yv), nil
+		}
+	case bool:
+		if yv, ok := y.(bool); ok && xv != yv {
+			if xv {
+				return 1, nil
+			}
+			return -1, nil
+		} else if ok {
+			return 0, nil
+		}
+	case time.Time:
+		if yv, ok := y.(time.Time); ok {
+			return xv.Compare(yv), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: can't compare %T and %T", errmsg.ErrShardFanOut, x, y)
+}
+
+// orderValue returns the value of v as one of the types compareValues
+// compares, nil for NULL.
+func orderValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, fmt.Errorf("%w: the ordered columns must be selected", errmsg.ErrShardFanOut)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if valuer, ok := v.Interface().(driver.Valuer); ok {
+			return valuerValue(valuer)
+		}
+		v = v.Elem()
+	}
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		return valuerValue(valuer)
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: can't order by a value of type %s", errmsg.ErrShardFanOut, v.Type())
+}
+
+func valuerValue(valuer driver.Valuer) (interface{}, error) {
+	v, err := valuer.Value()
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return orderValue(reflect.ValueOf(v))
+}
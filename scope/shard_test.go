@@ -0,0 +1,79 @@
+package scope
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/fixture"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ql"
+)
+
+type shardRecord struct {
+	ID    int64
+	Score *int
+}
+
+func TestSortShardRecords(t *testing.T) {
+	one, two := 1, 2
+	records := []shardRecord{
+		{ID: 1, Score: &one}, {ID: 2}, {ID: 3, Score: &two}, {ID: 4, Score: &one},
+	}
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	e.Scope.Value = &records
+	e.Search.Orders = []interface{}{"score", "id"}
+	err := SortShardRecords(e, reflect.ValueOf(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 4, 3, 2}) {
+		t.Errorf("expected [1 4 3 2] got %v", ids)
+	}
+
+	// the direction of the last column applies to all the columns with ql.
+	e.Search.Orders = []interface{}{`"score",id DESC`}
+	err = SortShardRecords(e, reflect.ValueOf(records))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = ids[:0]
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{2, 3, 4, 1}) {
+		t.Errorf("expected [2 3 4 1] got %v", ids)
+	}
+
+	e.Search.Orders = []interface{}{&model.Expr{Q: "score + ?", Args: []interface{}{1}}}
+	err = SortShardRecords(e, reflect.ValueOf(records))
+	if !errors.Is(err, errmsg.ErrShardFanOut) {
+		t.Errorf("expected %v got %v", errmsg.ErrShardFanOut, err)
+	}
+}
+
+func TestShardLimit(t *testing.T) {
+	e := fixture.TestEngine()
+	offset, limit, err := ShardLimit(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != -1 || limit != -1 {
+		t.Errorf("expected no offset and limit got %d %d", offset, limit)
+	}
+	e.Search.Offset = "5"
+	e.Search.Limit = uint(10)
+	offset, limit, err = ShardLimit(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 5 || limit != 10 {
+		t.Errorf("expected 5 and 10 got %d %d", offset, limit)
+	}
+}
@@ -0,0 +1,71 @@
+package scope
+
+import (
+	"fmt"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/model"
+)
+
+//Tenant returns the tenant column of the model value and the tenant the query
+//of e is scoped to. The field is nil when the queries on value aren't scoped,
+//because the model has no tenant column or the query is unscoped. It fails
+//with errmsg.ErrMissingTenant when the context of e has no tenant, and with the
+//error of GetModelStruct when value isn't a model, so that the query isn't run
+//unscoped.
+func Tenant(e *engine.Engine, value interface{}) (*model.StructField, interface{}, error) {
+	if e.Tenancy == nil || e.Search.UnscopedTenant || value == nil {
+		return nil, nil, nil
+	}
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	column := e.Tenancy.ColumnName()
+	for _, field := range m.StructFields {
+		if field.IsNormal && field.DBName == column {
+			tenant, ok := e.Tenancy.TenantOf(e.Ctx)
+			if !ok {
+				return nil, nil, errmsg.ErrMissingTenant
+			}
+			return field, tenant, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+//SetTenant sets the tenant column of the record in e.Scope.Value to the
+//tenant of the query. It fails with errmsg.ErrWrongTenant when the record
+//belongs to another tenant.
+func SetTenant(e *engine.Engine) error {
+	sf, tenant, err := Tenant(e, e.Scope.Value)
+	if err != nil || sf == nil {
+		return err
+	}
+	field, err := FieldByName(e, e.Scope.Value, sf.Name)
+	if err != nil {
+		return err
+	}
+	if !field.IsBlank {
+		if fmt.Sprint(field.Field.Interface()) != fmt.Sprint(tenant) {
+			return errmsg.ErrWrongTenant
+		}
+		return nil
+	}
+	return field.Set(tenant)
+}
+
+//CheckTenant fails with errmsg.ErrWrongTenant when value, set on column of the
+//record in e.Scope.Value, is a tenant other than the one of the query. This
+//keeps updates from moving records to another tenant.
+func CheckTenant(e *engine.Engine, column string, value interface{}) error {
+	sf, tenant, err := Tenant(e, e.Scope.Value)
+	if err != nil || sf == nil || sf.DBName != column {
+		return err
+	}
+	if fmt.Sprint(value) != fmt.Sprint(tenant) {
+		return errmsg.ErrWrongTenant
+	}
+	return nil
+}
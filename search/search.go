@@ -64,6 +64,11 @@ func Limit(e *engine.Engine, limit interface{}) {
 	e.Search.Limit = limit
 }
 
+//LimitPerParent limits the number of records preloaded for each parent.
+func LimitPerParent(e *engine.Engine, limit int) {
+	e.Search.LimitPerParent = limit
+}
+
 //Offset add search OFFSET
 func Offset(e *engine.Engine, offset interface{}) {
 	e.Search.Offset = offset
@@ -90,6 +95,17 @@ func Join(e *engine.Engine, query interface{}, values ...interface{}) {
 	e.Search.JoinConditions = append(e.Search.JoinConditions, map[string]interface{}{"query": query, "args": values})
 }
 
+//JoinAssociation adds the has_one or belongs_to association name to be loaded
+//with a LEFT JOIN in the same query as the model.
+func JoinAssociation(e *engine.Engine, name string) {
+	for _, n := range e.Search.JoinAssociations {
+		if n == name {
+			return
+		}
+	}
+	e.Search.JoinAssociations = append(e.Search.JoinAssociations, name)
+}
+
 //Preload add preloading condition
 func Preload(e *engine.Engine, schema string, values ...interface{}) {
 	var preloads []model.SearchPreload
@@ -112,11 +128,51 @@ func Unscoped(e *engine.Engine, b bool) {
 	e.Search.Unscoped = b
 }
 
+//UnscopedTenant disables the tenant scoping of the search.
+func UnscopedTenant(e *engine.Engine, b bool) {
+	e.Search.UnscopedTenant = b
+}
+
+//OnlyTrashed limits the search to soft deleted records.
+func OnlyTrashed(e *engine.Engine, b bool) {
+	e.Search.OnlyTrashed = b
+}
+
+//Scoping copies the soft delete scoping of src to dst. This is used when
+//querying records related to the ones in src, for instance when preloading.
+//
+// Related records are not trashed together with their owner, so when src is
+// limited to trashed records dst includes all of them.
+func Scoping(dst, src *engine.Engine) {
+	dst.Search.Unscoped = src.Search.Unscoped || src.Search.OnlyTrashed
+	dst.Search.UnscopedTenant = src.Search.UnscopedTenant
+}
+
+//Inherit copies the preloads, selects and order of src to dst along with the
+//soft delete scoping. This is used when the records related to the model of
+//src are queried, so the query on the model applies to them.
+func Inherit(dst, src *engine.Engine) {
+	Scoping(dst, src)
+	dst.Search.Preload = append(dst.Search.Preload, src.Search.Preload...)
+	dst.Search.Orders = append(dst.Search.Orders, src.Search.Orders...)
+	if src.Search.Selects != nil {
+		dst.Search.Selects = make(map[string]interface{}, len(src.Search.Selects))
+		for k, v := range src.Search.Selects {
+			dst.Search.Selects[k] = v
+		}
+	}
+}
+
 //Table set the search table name.
 func Table(e *engine.Engine, name string) {
 	e.Search.TableName = name
 }
 
+//Clauses adds extra clauses to the search.
+func Clauses(e *engine.Engine, clauses ...interface{}) {
+	e.Search.Clauses = append(e.Search.Clauses, clauses...)
+}
+
 //Inline add Where clause if any.
 func Inline(e *engine.Engine, values ...interface{}) {
 	if len(values) > 0 {
@@ -166,13 +166,32 @@ func MakeSlice(elemType reflect.Type) interface{} {
 	return slice.Interface()
 }
 
+// fieldValuer is model.FieldValuer, implemented by models with field
+// extractors generated by ngorm-gen.
+type fieldValuer interface {
+	NGORMValue(name string) (interface{}, bool)
+}
+
 // GetValueFromFields return given fields's value
 func GetValueFromFields(value reflect.Value, fieldNames []string) (results []interface{}) {
 	// If value is a nil pointer, Indirect returns a zero Value!
 	// Therefor we need to check for a zero value,
 	// as FieldByName could panic
 	if value = reflect.Indirect(value); value.IsValid() {
+		var valuer fieldValuer
+		if value.CanAddr() {
+			valuer, _ = value.Addr().Interface().(fieldValuer)
+		}
 		for _, fieldName := range fieldNames {
+			if valuer != nil {
+				if result, ok := valuer.NGORMValue(fieldName); ok {
+					if r, ok := result.(driver.Valuer); ok {
+						result, _ = r.Value()
+					}
+					results = append(results, result)
+					continue
+				}
+			}
 			if fieldValue := value.FieldByName(fieldName); value.IsValid() {
 				result := fieldValue.Interface()
 				if r, ok := result.(driver.Valuer); ok {
@@ -236,6 +255,17 @@ func WrapTX(tx string) string {
 	return buf.String()
 }
 
+// UnwrapTX returns the queries of a transaction block built with WrapTX, or
+// tx as it is when it isn't one.
+func UnwrapTX(tx string) string {
+	q := strings.TrimSpace(tx)
+	if !strings.HasPrefix(q, "BEGIN TRANSACTION;") || !strings.HasSuffix(q, "COMMIT;") {
+		return tx
+	}
+	q = strings.TrimPrefix(q, "BEGIN TRANSACTION;")
+	return strings.TrimSpace(strings.TrimSuffix(q, "COMMIT;"))
+}
+
 // ColumnAsArray returns an array of column values
 func ColumnAsArray(columns []string, values ...interface{}) (results [][]interface{}) {
 	var indirectValue reflect.Value
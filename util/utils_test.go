@@ -26,3 +26,13 @@ func TestToDBNameGenerateFriendlyName(t *testing.T) {
 		}
 	}
 }
+
+func TestUnwrapTX(t *testing.T) {
+	q := "DELETE FROM users WHERE id = $1"
+	if s := UnwrapTX(WrapTX(q)); s != q+";" {
+		t.Errorf("expected %s; got %s", q, s)
+	}
+	if s := UnwrapTX(q); s != q {
+		t.Errorf("expected %s got %s", q, s)
+	}
+}